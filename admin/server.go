@@ -0,0 +1,292 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package admin implements the admin HTTP server of statreceiver, for health
+// checks and looking into a running pipeline. It serves
+//
+//   - /healthz, which answers 200 while the process runs.
+//   - /readyz, which answers 200 once the configuration is loaded, and so all
+//     sources are bound, while no destination writing to another service
+//     failed its last write. Destinations that didn't write yet, like ones
+//     without metrics, are ready. Otherwise it answers 503 with the reasons.
+//   - /debug/pprof/, the net/http/pprof profiles, except the command line,
+//     which holds the --var values.
+//   - /config, the loaded configuration with the passwords of URLs and
+//     password, token and secret parameters redacted, and the SHA-256 of the
+//     configuration as loaded in the X-Config-Sha256 header.
+//   - /status, JSON with the build version and commit, the name and hash of
+//     the configuration and the state of the components that have one, like
+//     the fill levels of buffers and the last flush of destinations, the zero
+//     time if they didn't write yet.
+//
+// The endpoints are not authenticated, and the profiles and the status show
+// the internals of the process, so the server should only listen on
+// localhost or another address that only administrators reach.
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver"
+)
+
+// Error is the class of admin server errors.
+var Error = errs.Class("admin")
+
+// Build identifies the running binary.
+type Build struct {
+	Version string `json:"version,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+}
+
+// Component is a value created by a configuration, with the name of the
+// constructor that created it, like "mbuf".
+type Component struct {
+	Type  string
+	Value interface{}
+}
+
+// Pipeline is a loaded configuration and the components it created.
+type Pipeline struct {
+	// Name is where the configuration was read from.
+	Name       string
+	Config     []byte
+	Components []Component
+}
+
+// Server serves the admin endpoints.
+type Server struct {
+	build Build
+	mux   *http.ServeMux
+
+	mu       sync.Mutex
+	pipeline *Pipeline
+	hash     string
+}
+
+// NewServer creates a Server for the binary build. It isn't ready until
+// SetPipeline is called.
+func NewServer(build Build) *Server {
+	server := &Server{build: build, mux: http.NewServeMux()}
+	server.mux.HandleFunc("/healthz", server.healthz)
+	server.mux.HandleFunc("/readyz", server.readyz)
+	server.mux.HandleFunc("/config", server.config)
+	server.mux.HandleFunc("/status", server.status)
+	// the command line is left out, pprof.Index answers 404 for it.
+	server.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	server.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	server.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	server.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return server
+}
+
+// SetPipeline sets the loaded configuration.
+func (server *Server) SetPipeline(pipeline Pipeline) {
+	sum := sha256.Sum256(pipeline.Config)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.pipeline = &pipeline
+	server.hash = hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP implements http.Handler.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+// Serve serves the admin endpoints on listener until ctx is canceled.
+func (server *Server) Serve(ctx context.Context, listener net.Listener) error {
+	httpServer := &http.Server{Handler: server}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = httpServer.Shutdown(shutdownCtx)
+		case <-done:
+		}
+	}()
+
+	err := httpServer.Serve(listener)
+	if errs.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return Error.Wrap(err)
+}
+
+func (server *Server) loaded() (*Pipeline, string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.pipeline, server.hash
+}
+
+func (server *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+func (server *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	pipeline, _ := server.loaded()
+	var problems []string
+	if pipeline == nil {
+		problems = append(problems, "configuration is not loaded")
+	} else {
+		for _, component := range named(pipeline.Components) {
+			sink, ok := component.Value.(statreceiver.Sink)
+			if !ok {
+				continue
+			}
+			if status := sink.SinkStatus(); status.LastError != "" {
+				problems = append(problems, component.name+": "+status.LastError)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, strings.Join(problems, "\n"))
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+func (server *Server) config(w http.ResponseWriter, r *http.Request) {
+	pipeline, hash := server.loaded()
+	if pipeline == nil {
+		http.Error(w, "configuration is not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Config-Sha256", hash)
+	_, _ = w.Write(redact(pipeline.Config))
+}
+
+var (
+	// redactUserinfo matches the user and password of URLs, like
+	// "postgres://user:password@".
+	redactUserinfo = regexp.MustCompile(`(?i)([a-z][a-z0-9+.-]*://[^/\s:@"']*:)[^@/\s"']*@`)
+	// redactParams matches parameters holding credentials, in URL queries,
+	// options or DSNs, like Influx's "p=password".
+	redactParams = regexp.MustCompile(`(?i)\b((?:password|passwd|pass|pwd|secret|token|p)=)[^&\s"',;]*`)
+)
+
+// redact returns config with the credentials it holds replaced.
+func redact(config []byte) []byte {
+	config = redactUserinfo.ReplaceAll(config, []byte("${1}REDACTED@"))
+	return redactParams.ReplaceAll(config, []byte("${1}REDACTED"))
+}
+
+// Status is the JSON served at /status.
+type Status struct {
+	Build      Build             `json:"build"`
+	Config     *ConfigStatus     `json:"config,omitempty"`
+	Components []ComponentStatus `json:"components"`
+}
+
+// ConfigStatus identifies the loaded configuration.
+type ConfigStatus struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// ComponentStatus is the state of a component. Components are named by their
+// type and the order they were created in, like "mbuf#2" for the second
+// mbuf.
+type ComponentStatus struct {
+	Name   string                    `json:"name"`
+	Buffer *statreceiver.BufferStats `json:"buffer,omitempty"`
+	Sink   *statreceiver.SinkStatus  `json:"sink,omitempty"`
+	Batch  *statreceiver.BatchStats  `json:"batch,omitempty"`
+	Lua    *statreceiver.LuaStats    `json:"lua,omitempty"`
+	// Endpoints are the Influx endpoints of influxmulti.
+	Endpoints []statreceiver.InfluxEndpointHealth `json:"endpoints,omitempty"`
+}
+
+func (server *Server) status(w http.ResponseWriter, r *http.Request) {
+	pipeline, hash := server.loaded()
+	status := Status{Build: server.build, Components: []ComponentStatus{}}
+	if pipeline != nil {
+		status.Config = &ConfigStatus{Name: pipeline.Name, SHA256: hash}
+		for _, component := range named(pipeline.Components) {
+			if state, ok := componentStatus(component); ok {
+				status.Components = append(status.Components, state)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(status)
+}
+
+// componentStatus returns the state of a component, and false if it has
+// none.
+func componentStatus(component namedComponent) (ComponentStatus, bool) {
+	status := ComponentStatus{Name: component.name}
+	ok := false
+	if buffer, isBuffer := component.Value.(interface {
+		Stats() statreceiver.BufferStats
+	}); isBuffer {
+		stats := buffer.Stats()
+		status.Buffer, ok = &stats, true
+	}
+	if sink, isSink := component.Value.(statreceiver.Sink); isSink {
+		sinkStatus := sink.SinkStatus()
+		status.Sink, ok = &sinkStatus, true
+	}
+	if batcher, isBatcher := component.Value.(interface {
+		Stats() statreceiver.BatchStats
+	}); isBatcher {
+		stats := batcher.Stats()
+		status.Batch, ok = &stats, true
+	}
+	if stage, isStage := component.Value.(interface {
+		Stats() statreceiver.LuaStats
+	}); isStage {
+		stats := stage.Stats()
+		status.Lua, ok = &stats, true
+	}
+	if multi, isMulti := component.Value.(*statreceiver.InfluxMultiDest); isMulti {
+		status.Endpoints, ok = multi.Health(), true
+	}
+	return status, ok
+}
+
+type namedComponent struct {
+	Component
+	name string
+}
+
+// named numbers the components of every type in the order they were
+// created.
+func named(components []Component) []namedComponent {
+	counts := map[string]int{}
+	rv := make([]namedComponent, 0, len(components))
+	for _, component := range components {
+		counts[component.Type]++
+		rv = append(rv, namedComponent{
+			Component: component,
+			name:      fmt.Sprintf("%s#%d", component.Type, counts[component.Type]),
+		})
+	}
+	return rv
+}
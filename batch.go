@@ -0,0 +1,210 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// BatchError is the class of errors of destinations writing metrics in
+// batches.
+var BatchError = errs.Class("batch")
+
+// permanentError is a write error that retrying can't fix, like a batch the
+// service rejects. Batchers drop the batch instead of retrying it.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as permanent.
+func permanent(err error) error { return permanentError{err: err} }
+
+// isPermanent returns whether err was marked as permanent.
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// BatchStats describes the backlog of a destination that writes metrics in
+// batches.
+type BatchStats struct {
+	Pending   int
+	Dropped   int64
+	LastFlush time.Time
+	LastError string
+}
+
+// metricBatcher collects metrics in memory and hands them to a write
+// function in batches, whenever a batch is full or the flush interval passes.
+// Unless the write function keeps them itself, batches that fail to be
+// written are kept and retried on the next flush. At most 100 batches are
+// kept; metrics beyond that are dropped.
+type metricBatcher struct {
+	name  string
+	batch int
+	retry bool
+	write func(ctx context.Context, batch []Metric) error
+
+	mu        sync.Mutex
+	pending   []Metric
+	dropped   int
+	total     int64
+	lastFlush time.Time
+	lastErr   error
+
+	clock   Clock
+	full    chan struct{}
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// newMetricBatcher creates a metricBatcher and starts its flushing
+// goroutine. Use close to stop it.
+//
+// With retry, the metrics of a failed write are retried. Without it, write
+// is responsible for the metrics it was given even when it fails, and it is
+// also called by flushes without pending metrics, so it can retry its own.
+func newMetricBatcher(name string, batch int, interval time.Duration, retry bool, write func(ctx context.Context, batch []Metric) error) *metricBatcher {
+	if batch <= 0 {
+		batch = 1
+	}
+	b := &metricBatcher{
+		name:  name,
+		batch: batch,
+		retry: retry,
+		write: write,
+		clock: currentClock(),
+		full:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+	b.stopped.Add(1)
+	go b.run(interval)
+	return b
+}
+
+// add queues a metric, copying the key.
+func (b *metricBatcher) add(application, instance string, key []byte, val float64, ts time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pending) >= 100*b.batch {
+		b.dropped++
+		b.total++
+		return BatchError.New("%s metric buffer overrun", b.name)
+	}
+	b.pending = append(b.pending, Metric{
+		Application: application,
+		Instance:    instance,
+		Key:         append([]byte(nil), key...),
+		Val:         val,
+		TS:          ts,
+	})
+	if len(b.pending) >= b.batch {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// drop counts metrics the write function dropped.
+func (b *metricBatcher) drop(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropped += n
+	b.total += int64(n)
+}
+
+// Stats returns the current backlog.
+func (b *metricBatcher) Stats() BatchStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BatchStats{
+		Pending:   len(b.pending),
+		Dropped:   b.total,
+		LastFlush: b.lastFlush,
+	}
+	if b.lastErr != nil {
+		stats.LastError = b.lastErr.Error()
+	}
+	return stats
+}
+
+// SinkStatus implements Sink.
+func (b *metricBatcher) SinkStatus() SinkStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return newSinkStatus(b.lastFlush, b.lastErr)
+}
+
+// close stops the flushing goroutine and flushes one last time.
+func (b *metricBatcher) close() error {
+	close(b.stop)
+	b.stopped.Wait()
+	return b.Flush()
+}
+
+func (b *metricBatcher) run(interval time.Duration) {
+	defer b.stopped.Done()
+
+	tick := b.clock.After(interval)
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-tick:
+			tick = b.clock.After(interval)
+		case <-b.full:
+		}
+		if err := b.Flush(); err != nil {
+			log.Printf("failed flushing %s: %v", b.name, err)
+		}
+	}
+}
+
+// Flush writes all pending metrics. If the write fails, the metrics are kept
+// and retried on the next flush, if the batcher retries and the error is not
+// permanent.
+func (b *metricBatcher) Flush() error {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	dropped := b.dropped
+	b.dropped = 0
+	b.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("%s buffer full, dropped %d metrics", b.name, dropped)
+	}
+	if len(batch) == 0 && b.retry {
+		return nil
+	}
+
+	err := b.write(context.Background(), batch)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastErr = err
+	if err != nil {
+		switch {
+		case b.retry && isPermanent(err):
+			log.Printf("%s dropped %d metrics it can't write: %v", b.name, len(batch), err)
+			b.total += int64(len(batch))
+		case b.retry:
+			b.pending = append(batch, b.pending...)
+		}
+		return err
+	}
+	b.lastFlush = b.clock.Now()
+	return nil
+}
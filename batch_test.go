@@ -0,0 +1,153 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder is a write function of a metricBatcher recording the keys of
+// the batches it gets. It fails while failures is positive.
+type batchRecorder struct {
+	mu       sync.Mutex
+	batches  [][]string
+	failures int
+}
+
+func (r *batchRecorder) write(ctx context.Context, batch []Metric) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("write failed")
+	}
+	keys := make([]string, 0, len(batch))
+	for _, m := range batch {
+		keys = append(keys, string(m.Key))
+	}
+	r.batches = append(r.batches, keys)
+	return nil
+}
+
+func (r *batchRecorder) written() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]string(nil), r.batches...)
+}
+
+// newManualBatcher creates a metricBatcher without the flushing goroutine,
+// so only explicit flushes write.
+func newManualBatcher(batch int, write func(ctx context.Context, batch []Metric) error) *metricBatcher {
+	return &metricBatcher{
+		name:  "test",
+		batch: batch,
+		retry: true,
+		write: write,
+		clock: currentClock(),
+		full:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+}
+
+func TestMetricBatcher_Retry(t *testing.T) {
+	recorder := &batchRecorder{failures: 2}
+	b := newManualBatcher(10, recorder.write)
+	ts := time.Unix(1600000000, 0)
+
+	key := []byte("a")
+	require.NoError(t, b.add("app", "inst", key, 1, ts))
+	// the key is copied.
+	key[0] = 'x'
+	require.NoError(t, b.add("app", "inst", []byte("b"), 1, ts))
+	require.Error(t, b.Flush())
+	require.Equal(t, 2, b.Stats().Pending)
+	require.NotEmpty(t, b.SinkStatus().LastError)
+
+	// failed metrics are retried before the ones added after the failure.
+	require.NoError(t, b.add("app", "inst", []byte("c"), 1, ts))
+	require.Error(t, b.Flush())
+	require.NoError(t, b.add("app", "inst", []byte("d"), 1, ts))
+	require.NoError(t, b.Flush())
+
+	require.Equal(t, [][]string{{"a", "b", "c", "d"}}, recorder.written())
+	stats := b.Stats()
+	require.Zero(t, stats.Pending)
+	require.Empty(t, stats.LastError)
+	require.False(t, stats.LastFlush.IsZero())
+
+	// flushing without pending metrics doesn't write.
+	require.NoError(t, b.Flush())
+	require.Len(t, recorder.written(), 1)
+}
+
+func TestMetricBatcher_Drop(t *testing.T) {
+	recorder := &batchRecorder{failures: 1}
+	b := newManualBatcher(1, recorder.write)
+	ts := time.Unix(1600000000, 0)
+
+	// at most 100 batches are kept.
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.add("app", "inst", []byte("kept"), 1, ts))
+	}
+	err := b.add("app", "inst", []byte("dropped"), 1, ts)
+	require.Error(t, err)
+	require.True(t, BatchError.Has(err))
+	require.Equal(t, BatchStats{Pending: 100, Dropped: 1}, b.Stats())
+
+	// metrics kept for a retry still count against the limit.
+	require.Error(t, b.Flush())
+	require.Error(t, b.add("app", "inst", []byte("dropped"), 1, ts))
+	require.Equal(t, int64(2), b.Stats().Dropped)
+
+	require.NoError(t, b.Flush())
+	written := recorder.written()
+	require.Len(t, written, 1)
+	require.Len(t, written[0], 100)
+	require.NotContains(t, written[0], "dropped")
+	require.NoError(t, b.add("app", "inst", []byte("new"), 1, ts))
+}
+
+func TestMetricBatcher_FlushWhenFull(t *testing.T) {
+	recorder := &batchRecorder{}
+	b := newMetricBatcher("test", 2, time.Hour, true, recorder.write)
+	ts := time.Unix(1600000000, 0)
+
+	require.NoError(t, b.add("app", "inst", []byte("a"), 1, ts))
+	require.NoError(t, b.add("app", "inst", []byte("b"), 1, ts))
+	require.Eventually(t, func() bool { return len(recorder.written()) == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, []string{"a", "b"}, recorder.written()[0])
+
+	// close writes what is left.
+	require.NoError(t, b.add("app", "inst", []byte("c"), 1, ts))
+	require.NoError(t, b.close())
+	require.Equal(t, [][]string{{"a", "b"}, {"c"}}, recorder.written())
+}
+
+func TestMetricBatcher_Permanent(t *testing.T) {
+	var calls int
+	b := newManualBatcher(10, func(ctx context.Context, batch []Metric) error {
+		calls++
+		return permanent(errors.New("rejected"))
+	})
+	ts := time.Unix(1600000000, 0)
+
+	require.NoError(t, b.add("app", "inst", []byte("a"), 1, ts))
+	require.NoError(t, b.add("app", "inst", []byte("b"), 1, ts))
+	require.Error(t, b.Flush())
+
+	// the batch is dropped, not retried, but the failure is reported.
+	stats := b.Stats()
+	require.Equal(t, 0, stats.Pending)
+	require.Equal(t, int64(2), stats.Dropped)
+	require.Equal(t, "rejected", stats.LastError)
+	require.True(t, stats.LastFlush.IsZero())
+	require.NoError(t, b.Flush())
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package capture reads and writes statreceiver capture files, the packets
+// and receive times written by the fileout destination.
+//
+// A capture starts with an 8 byte header: the magic "SRCAP", a version byte
+// (currently 1) and two reserved bytes that are zero. Records follow, each
+//
+//	length  uint32, big endian, the number of packet bytes
+//	crc     uint32, big endian, CRC-32C (Castagnoli) of the ts and packet
+//	ts      int64, big endian, receive time in unix nanoseconds
+//	packet  length bytes
+//
+// Records are never larger than MaxPacket. Readers skip records with a bad
+// checksum by searching for the next valid record, and treat a partial record
+// at the end of the file, as left by a crash, as the end of the capture.
+//
+// In Python, a capture can be read with
+//
+//	import struct
+//	header = f.read(8); assert header[:5] == b"SRCAP"
+//	while (h := f.read(16)) and len(h) == 16:
+//	    length, crc, ts = struct.unpack(">IIq", h)
+//	    packet = f.read(length)
+//
+// checking the crc with the crc32c package if needed.
+// Captures may be compressed with gzip or zstd as a whole.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+const (
+	// Magic starts every capture.
+	Magic = "SRCAP"
+	// Version is the version of the format written.
+	Version = 1
+	// MaxPacket is the largest packet a record may hold.
+	MaxPacket = 1 << 20
+
+	headerSize = 8
+	recordSize = 16
+)
+
+// Error is the class of capture errors.
+var Error = errs.Class("capture")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Record is a captured packet.
+type Record struct {
+	TS   time.Time
+	Data []byte
+}
+
+// IsCapture returns whether prefix, the first bytes of a file, is the start of
+// a capture rather than an older gob encoded one.
+func IsCapture(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, []byte(Magic))
+}
+
+// Writer writes a capture. A Writer can't be used after a failed write: the
+// record may have been written partially, so later writes return the same
+// error.
+type Writer struct {
+	w       io.Writer
+	started bool
+	err     error
+	buf     []byte
+}
+
+// NewWriter creates a Writer. The header is written with the first record.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes a record.
+func (w *Writer) Write(ts time.Time, data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(data) > MaxPacket {
+		return Error.New("packet of %d bytes too large", len(data))
+	}
+
+	buf := w.buf[:0]
+	if !w.started {
+		buf = append(buf, Magic...)
+		buf = append(buf, Version, 0, 0)
+	}
+	start := len(buf)
+	buf = append(buf, make([]byte, recordSize)...)
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[start+8:], uint64(ts.UnixNano()))
+	buf = append(buf, data...)
+	binary.BigEndian.PutUint32(buf[start+4:], crc32.Checksum(buf[start+8:], castagnoli))
+	w.buf = buf
+	w.started = true
+
+	if _, err := w.w.Write(buf); err != nil {
+		w.err = Error.Wrap(err)
+		return w.err
+	}
+	return nil
+}
+
+// Reader reads a capture.
+type Reader struct {
+	r       *bufio.Reader
+	skipped int64
+	corrupt int64
+}
+
+// NewReader creates a Reader, reading and checking the header.
+func NewReader(r io.Reader) (*Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok || br.Size() < recordSize+MaxPacket {
+		br = bufio.NewReaderSize(r, recordSize+MaxPacket)
+	}
+
+	var header [headerSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, Error.New("reading header: %v", err)
+	}
+	if !IsCapture(header[:]) {
+		return nil, Error.New("not a capture")
+	}
+	if header[len(Magic)] != Version {
+		return nil, Error.New("unsupported version %d", header[len(Magic)])
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next valid record. It returns io.EOF at the end of the
+// capture.
+func (r *Reader) Next() (Record, error) {
+	resyncing := false
+	for {
+		head, err := r.r.Peek(recordSize)
+		if err != nil {
+			return Record{}, r.end(len(head), resyncing, err)
+		}
+
+		length := binary.BigEndian.Uint32(head)
+		if length <= MaxPacket {
+			record, err := r.r.Peek(recordSize + int(length))
+			if err != nil && err != io.EOF {
+				return Record{}, Error.Wrap(err)
+			}
+			// a record running past the end is either a partial last record
+			// or a corrupt length, so it is skipped like a bad checksum.
+			if err == nil && crc32.Checksum(record[8:], castagnoli) == binary.BigEndian.Uint32(record[4:]) {
+				rec := Record{
+					TS:   time.Unix(0, int64(binary.BigEndian.Uint64(record[8:]))),
+					Data: append([]byte(nil), record[recordSize:]...),
+				}
+				_, _ = r.r.Discard(len(record))
+				return rec, nil
+			}
+		}
+
+		// search for the next valid record one byte further.
+		if !resyncing {
+			resyncing = true
+			r.corrupt++
+		}
+		_, _ = r.r.Discard(1)
+		r.skipped++
+	}
+}
+
+// end handles reaching the end of the capture with n bytes of a partial
+// record left, which are counted as corrupt unless already resyncing.
+func (r *Reader) end(n int, resyncing bool, err error) error {
+	if err != io.EOF {
+		return Error.Wrap(err)
+	}
+	if n > 0 {
+		if !resyncing {
+			r.corrupt++
+		}
+		r.skipped += int64(n)
+		_, _ = r.r.Discard(n)
+	}
+	return io.EOF
+}
+
+// Skipped returns the number of bytes skipped because they were not part of
+// a valid record.
+func (r *Reader) Skipped() int64 { return r.skipped }
+
+// Corrupt returns the number of corrupt or partial records encountered.
+func (r *Reader) Corrupt() int64 { return r.corrupt }
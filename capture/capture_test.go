@@ -0,0 +1,108 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package capture_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver/capture"
+)
+
+func write(t *testing.T, packets ...string) []byte {
+	var buf bytes.Buffer
+	w := capture.NewWriter(&buf)
+	for i, packet := range packets {
+		require.NoError(t, w.Write(time.Unix(1600000000, int64(i)), []byte(packet)))
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, data []byte) ([]string, *capture.Reader) {
+	r, err := capture.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	var packets []string
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return packets, r
+		}
+		require.NoError(t, err)
+		packets = append(packets, string(rec.Data))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := write(t, "first", "", "third")
+	require.True(t, capture.IsCapture(data))
+
+	r, err := capture.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	for i, expected := range []string{"first", "", "third"} {
+		rec, err := r.Next()
+		require.NoError(t, err)
+		require.Equal(t, expected, string(rec.Data))
+		require.Equal(t, time.Unix(1600000000, int64(i)).UnixNano(), rec.TS.UnixNano())
+	}
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, r.Corrupt())
+
+	require.Error(t, capture.NewWriter(io.Discard).Write(time.Now(), make([]byte, capture.MaxPacket+1)))
+}
+
+func TestCorrupt(t *testing.T) {
+	data := write(t, "first", "second", "third")
+	// flip a byte of the second packet.
+	data[bytes.Index(data, []byte("second"))] ^= 0xff
+
+	packets, r := readAll(t, data)
+	require.Equal(t, []string{"first", "third"}, packets)
+	require.EqualValues(t, 1, r.Corrupt())
+	require.EqualValues(t, 16+6, r.Skipped())
+
+	// a corrupt length reaching past the end does not hide later records.
+	data = write(t, "first", "second", "third")
+	data[bytes.Index(data, []byte("second"))-16] = 0x0f
+
+	packets, _ = readAll(t, data)
+	require.Equal(t, []string{"first", "third"}, packets)
+}
+
+func TestTruncated(t *testing.T) {
+	data := write(t, "first", "second")
+	packets, r := readAll(t, data[:len(data)-3])
+	require.Equal(t, []string{"first"}, packets)
+	require.EqualValues(t, 1, r.Corrupt())
+}
+
+func TestHeader(t *testing.T) {
+	_, err := capture.NewReader(bytes.NewReader([]byte("gob data")))
+	require.Error(t, err)
+
+	data := write(t, "first")
+	data[len(capture.Magic)] = capture.Version + 1
+	_, err = capture.NewReader(bytes.NewReader(data))
+	require.Error(t, err)
+}
+
+type failWriter struct{ calls int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return 0, errs.New("disk full")
+}
+
+func TestWriteError(t *testing.T) {
+	w := &failWriter{}
+	cw := capture.NewWriter(w)
+	require.Error(t, cw.Write(time.Unix(1600000000, 0), []byte("a")))
+	require.Error(t, cw.Write(time.Unix(1600000000, 1), []byte("b")))
+	require.Equal(t, 1, w.calls)
+}
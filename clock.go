@@ -0,0 +1,51 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time of the components that pace packets or write on an
+// interval: FileSource replays, the batching destinations, Graphite and
+// StatsD. Network deadlines always use the system clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After is like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+var (
+	clockMu sync.Mutex
+	clock   Clock = systemClock{}
+)
+
+// SetClock makes the components created afterwards use c instead of the
+// system clock, and returns a function restoring the previous clock. It is
+// meant for tests, like with statreceivertest.Clock.
+func SetClock(c Clock) (restore func()) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	previous := clock
+	clock = c
+	return func() {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		clock = previous
+	}
+}
+
+// currentClock returns the clock for a new component.
+func currentClock() Clock {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	return clock
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zeebo/admission/v3/admproto"
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver"
+)
+
+var captureFlags struct {
+	From        string
+	Until       string
+	Application string
+	Instance    string
+	Compression string
+	Top         int
+}
+
+func newCaptureCmd() *cobra.Command {
+	captureCmd := &cobra.Command{
+		Use:   "capture",
+		Short: "inspect and convert capture files written by fileout",
+		Long: "Inspect and convert capture files written by fileout. Capture paths may be\n" +
+			"a file, a directory or a glob pattern of rotated captures.",
+	}
+
+	statsCmd := &cobra.Command{
+		Use:   "stats <capture>",
+		Short: "print packet count, time range and top applications and instances",
+		Args:  cobra.ExactArgs(1),
+		RunE:  captureStats,
+	}
+	statsCmd.Flags().IntVar(&captureFlags.Top, "top", 10, "number of applications and instances to list")
+
+	dumpCmd := &cobra.Command{
+		Use:   "dump <capture>",
+		Short: "print decoded packets as JSON lines",
+		Args:  cobra.ExactArgs(1),
+		RunE:  captureDump,
+	}
+
+	filterCmd := &cobra.Command{
+		Use:   "filter <capture> <output>",
+		Short: "write the packets matching an application, instance and time range",
+		Args:  cobra.ExactArgs(2),
+		RunE:  captureFilter,
+	}
+	filterCmd.Flags().StringVar(&captureFlags.Application, "application", "", "regular expression applications must match")
+	filterCmd.Flags().StringVar(&captureFlags.Instance, "instance", "", "regular expression instances must match")
+
+	mergeCmd := &cobra.Command{
+		Use:   "merge <output> <capture>...",
+		Short: "combine captures into one, ordered by timestamp",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  captureMerge,
+	}
+
+	for _, cmd := range []*cobra.Command{statsCmd, dumpCmd, filterCmd} {
+		cmd.Flags().StringVar(&captureFlags.From, "from", "", "skip packets recorded before this RFC 3339 time")
+		cmd.Flags().StringVar(&captureFlags.Until, "until", "", "stop at the first packet recorded at or after this RFC 3339 time")
+	}
+	for _, cmd := range []*cobra.Command{filterCmd, mergeCmd} {
+		cmd.Flags().StringVar(&captureFlags.Compression, "compression", "none", "compression of the output: none, gzip or zstd")
+	}
+
+	captureCmd.AddCommand(statsCmd, dumpCmd, filterCmd, mergeCmd)
+	return captureCmd
+}
+
+// openCapture opens a capture for reading, restricted to the time range
+// flags.
+func openCapture(path string) (*statreceiver.FileSource, error) {
+	var opts []string
+	if captureFlags.From != "" {
+		opts = append(opts, "from="+captureFlags.From)
+	}
+	if captureFlags.Until != "" {
+		opts = append(opts, "until="+captureFlags.Until)
+	}
+	return statreceiver.NewFileSource(path, opts...)
+}
+
+// createCapture creates a capture for writing with the compression flag.
+func createCapture(path string) (*statreceiver.FileDest, error) {
+	return statreceiver.NewFileDest(path, "compression="+captureFlags.Compression, "flush=0")
+}
+
+// eachPacket calls fn for every packet of a capture.
+func eachPacket(path string, fn func(data []byte, ts time.Time) error) (err error) {
+	source, err := openCapture(path)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errs.Combine(err, source.Close()) }()
+
+	for {
+		data, ts, err := source.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(data, ts); err != nil {
+			return err
+		}
+	}
+}
+
+// decodedPacket is a packet as printed by dump.
+type decodedPacket struct {
+	TS          time.Time         `json:"ts"`
+	Size        int               `json:"size"`
+	Application string            `json:"application,omitempty"`
+	Instance    string            `json:"instance,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Metrics     []decodedMetric   `json:"metrics,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+type decodedMetric struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// decodePacket decodes an admission packet. Invalid packets have Error set.
+func decodePacket(data []byte, ts time.Time) decodedPacket {
+	p := decodedPacket{TS: ts, Size: len(data)}
+
+	fail := func(err error) decodedPacket {
+		p.Error = err.Error()
+		return p
+	}
+
+	data, err := admproto.CheckChecksum(data)
+	if err != nil {
+		return fail(err)
+	}
+
+	var scratch [10 * 1024]byte
+	r := admproto.NewReaderWith(scratch[:])
+	data, app, inst, numHeaders, err := r.Begin(data)
+	if err != nil {
+		return fail(err)
+	}
+	p.Application, p.Instance = string(app), string(inst)
+
+	for i := 0; i < numHeaders; i++ {
+		var key, val []byte
+		data, key, val, err = r.NextHeader(data)
+		if err != nil {
+			return fail(err)
+		}
+		if p.Headers == nil {
+			p.Headers = map[string]string{}
+		}
+		p.Headers[string(key)] = string(val)
+	}
+
+	for len(data) > 0 {
+		var key []byte
+		var val float64
+		data, key, val, err = r.Next(data)
+		if err != nil {
+			return fail(err)
+		}
+		m := decodedMetric{Key: string(key), Value: val}
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			// JSON has no representation for these.
+			m.Value = fmt.Sprint(val)
+		}
+		p.Metrics = append(p.Metrics, m)
+	}
+	return p
+}
+
+func captureStats(cmd *cobra.Command, args []string) error {
+	var packets, invalid, metrics, bytes int
+	var first, last time.Time
+	applications := map[string]int{}
+	instances := map[string]int{}
+
+	err := eachPacket(args[0], func(data []byte, ts time.Time) error {
+		packets++
+		bytes += len(data)
+		if first.IsZero() || ts.Before(first) {
+			first = ts
+		}
+		if ts.After(last) {
+			last = ts
+		}
+
+		p := decodePacket(data, ts)
+		if p.Error != "" {
+			invalid++
+			return nil
+		}
+		metrics += len(p.Metrics)
+		applications[p.Application]++
+		instances[p.Application+" "+p.Instance]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "packets:  %d (%d invalid)\n", packets, invalid)
+	fmt.Fprintf(out, "metrics:  %d\n", metrics)
+	fmt.Fprintf(out, "bytes:    %d\n", bytes)
+	if packets > 0 {
+		fmt.Fprintf(out, "first:    %s\n", first.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(out, "last:     %s\n", last.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(out, "duration: %s\n", last.Sub(first))
+	}
+	printTop(out, "applications", applications, captureFlags.Top)
+	printTop(out, "instances", instances, captureFlags.Top)
+	return nil
+}
+
+// printTop prints the n names with the most packets.
+func printTop(out io.Writer, title string, counts map[string]int, n int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+
+	fmt.Fprintf(out, "\ntop %s (%d total):\n", title, len(counts))
+	for _, name := range names {
+		fmt.Fprintf(out, "  %8d  %s\n", counts[name], name)
+	}
+}
+
+func captureDump(cmd *cobra.Command, args []string) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	return eachPacket(args[0], func(data []byte, ts time.Time) error {
+		return enc.Encode(decodePacket(data, ts))
+	})
+}
+
+func captureFilter(cmd *cobra.Command, args []string) (err error) {
+	dest, err := createCapture(args[1])
+	if err != nil {
+		return err
+	}
+	defer func() { err = errs.Combine(err, dest.Close()) }()
+
+	filter, err := statreceiver.NewPacketFilter(captureFlags.Application, captureFlags.Instance, nil, dest)
+	if err != nil {
+		return err
+	}
+
+	return eachPacket(args[0], func(data []byte, ts time.Time) error {
+		// invalid packets never match.
+		if p := decodePacket(data, ts); p.Error != "" {
+			return nil
+		}
+		return filter.Packet(data, ts)
+	})
+}
+
+func captureMerge(cmd *cobra.Command, args []string) (err error) {
+	dest, err := createCapture(args[0])
+	if err != nil {
+		return err
+	}
+	defer func() { err = errs.Combine(err, dest.Close()) }()
+
+	type head struct {
+		source *statreceiver.FileSource
+		data   []byte
+		ts     time.Time
+	}
+	var heads []*head
+	defer func() {
+		for _, h := range heads {
+			err = errs.Combine(err, h.source.Close())
+		}
+	}()
+
+	advance := func(h *head) (bool, error) {
+		data, ts, err := h.source.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+		h.data, h.ts = data, ts
+		return err == nil, err
+	}
+
+	var active []*head
+	for _, path := range args[1:] {
+		source, err := openCapture(path)
+		if err != nil {
+			return err
+		}
+		h := &head{source: source}
+		heads = append(heads, h)
+		ok, err := advance(h)
+		if err != nil {
+			return err
+		}
+		if ok {
+			active = append(active, h)
+		}
+	}
+
+	// captures are ordered by time, so repeatedly taking the earliest packet
+	// of all captures orders the output.
+	for len(active) > 0 {
+		earliest := 0
+		for i, h := range active {
+			if h.ts.Before(active[earliest].ts) {
+				earliest = i
+			}
+		}
+		h := active[earliest]
+		if err := dest.Packet(h.data, h.ts); err != nil {
+			return err
+		}
+		ok, err := advance(h)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			active = append(active[:earliest], active[earliest+1:]...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+// writeCapture writes packets to a capture at path, with the timestamps in
+// seconds since 1600000000.
+func writeCapture(t *testing.T, path string, packets [][]byte, seconds ...int) {
+	dest, err := statreceiver.NewFileDest(path, "flush=0")
+	require.NoError(t, err)
+	for i, data := range packets {
+		require.NoError(t, dest.Packet(data, time.Unix(1600000000+int64(seconds[i]), 0)))
+	}
+	require.NoError(t, dest.Close())
+}
+
+// readCapture returns the packets of a capture.
+func readCapture(t *testing.T, path string) (packets []statreceiver.Packet) {
+	source, err := statreceiver.NewFileSource(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+	for {
+		data, ts, err := source.Next()
+		if err == io.EOF {
+			return packets
+		}
+		require.NoError(t, err)
+		packets = append(packets, statreceiver.Packet{Data: append([]byte(nil), data...), TS: ts})
+	}
+}
+
+// runCapture runs a capture subcommand with flags, returning its output.
+func runCapture(t *testing.T, run func(cmd *cobra.Command, args []string) error, args []string, flags ...func()) string {
+	captureFlags.From, captureFlags.Until = "", ""
+	captureFlags.Application, captureFlags.Instance = "", ""
+	captureFlags.Compression, captureFlags.Top = "none", 10
+	for _, flag := range flags {
+		flag()
+	}
+
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	require.NoError(t, run(cmd, args))
+	return out.String()
+}
+
+func packetOf(application string) []byte {
+	return statreceivertest.EncodePacket(application, "inst", nil, statreceivertest.Value{Key: "m value", Val: 1})
+}
+
+func TestCaptureMerge(t *testing.T) {
+	dir := t.TempDir()
+	a, b, merged := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "merged")
+	writeCapture(t, a, [][]byte{packetOf("a1"), packetOf("a3"), packetOf("a5")}, 1, 3, 5)
+	writeCapture(t, b, [][]byte{packetOf("b2"), packetOf("b3"), packetOf("b4")}, 2, 3, 4)
+
+	runCapture(t, captureMerge, []string{merged, a, b})
+
+	var order []string
+	for _, p := range readCapture(t, merged) {
+		order = append(order, decodePacket(p.Data, p.TS).Application)
+	}
+	// packets at the same time keep the order of the captures.
+	require.Equal(t, []string{"a1", "b2", "a3", "b3", "b4", "a5"}, order)
+}
+
+func TestCaptureFilter(t *testing.T) {
+	dir := t.TempDir()
+	capture, filtered := filepath.Join(dir, "capture"), filepath.Join(dir, "filtered")
+	writeCapture(t, capture, [][]byte{
+		packetOf("satellite"),
+		packetOf("storagenode"),
+		[]byte("invalid"),
+		packetOf("satellite"),
+		packetOf("satellite-api"),
+	}, 1, 2, 3, 4, 5)
+
+	runCapture(t, captureFilter, []string{capture, filtered}, func() {
+		captureFlags.Application = "^satellite$"
+		captureFlags.From = time.Unix(1600000002, 0).UTC().Format(time.RFC3339)
+	})
+
+	packets := readCapture(t, filtered)
+	require.Len(t, packets, 1)
+	require.Equal(t, "satellite", decodePacket(packets[0].Data, packets[0].TS).Application)
+	require.Equal(t, time.Unix(1600000004, 0), packets[0].TS)
+}
+
+func TestCaptureStats(t *testing.T) {
+	capture := filepath.Join(t.TempDir(), "capture")
+	writeCapture(t, capture, [][]byte{packetOf("satellite"), []byte("invalid"), packetOf("satellite")}, 1, 2, 3)
+
+	out := runCapture(t, captureStats, []string{capture})
+	require.Contains(t, out, "packets:  3 (1 invalid)\n")
+	require.Contains(t, out, "metrics:  2\n")
+	require.Contains(t, out, "duration: 2s\n")
+	require.Contains(t, out, "top applications (1 total):\n         2  satellite\n")
+
+	out = runCapture(t, captureDump, []string{capture})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], `"application":"satellite"`)
+	require.Contains(t, lines[1], `"error":`)
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"io"
+	"reflect"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/admin"
+	"storj.io/statreceiver/luacfg"
+)
+
+// components returns the constructors of statreceiver.Stages and of deliver
+// and mdeliver, by the names configurations call them with. Deliveries started
+// by deliver and mdeliver are added to deliveries, stages that need closing on
+// shutdown to closers, and everything created to created, for the admin
+// server.
+func components(deliveries *[]*statreceiver.Delivery, closers *[]io.Closer, created *[]admin.Component) map[string]interface{} {
+	constructors := map[string]interface{}{
+		"deliver": func(source statreceiver.Source, dest statreceiver.PacketDest) *statreceiver.Delivery {
+			delivery := statreceiver.Deliver(source, dest)
+			*deliveries = append(*deliveries, delivery)
+			return delivery
+		},
+		"mdeliver": func(source statreceiver.MetricSource, dest statreceiver.MetricDest) *statreceiver.Delivery {
+			delivery := statreceiver.DeliverMetrics(source, dest)
+			*deliveries = append(*deliveries, delivery)
+			return delivery
+		},
+	}
+	for name, stage := range statreceiver.Stages() {
+		constructors[name] = stage.New
+		if stage.Closes {
+			constructors[name] = closeOnExit(closers, stage.New)
+		}
+	}
+	for name, constructor := range constructors {
+		constructors[name] = record(created, name, constructor)
+	}
+	return constructors
+}
+
+// record wraps a constructor so that the values it successfully returns are
+// added to created as components of type name.
+func record(created *[]admin.Component, name string, constructor interface{}) interface{} {
+	return onCreate(constructor, func(value interface{}) {
+		*created = append(*created, admin.Component{Type: name, Value: value})
+	})
+}
+
+// closeOnExit wraps a constructor so that the values it successfully returns
+// are added to closers. Components are created after the destinations they
+// are given, so closing closers in reverse lets buffers deliver to
+// destinations that are still open.
+func closeOnExit(closers *[]io.Closer, constructor interface{}) interface{} {
+	return onCreate(constructor, func(value interface{}) {
+		if closer, ok := value.(io.Closer); ok {
+			*closers = append(*closers, closer)
+		}
+	})
+}
+
+// onCreate wraps a constructor so that created is called with the values it
+// successfully returns.
+func onCreate(constructor interface{}, created func(value interface{})) interface{} {
+	fn := reflect.ValueOf(constructor)
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		if fn.Type().IsVariadic() {
+			results = fn.CallSlice(args)
+		} else {
+			results = fn.Call(args)
+		}
+		if luacfg.ReturnsError(fn.Type()) && !results[len(results)-1].IsNil() {
+			return results
+		}
+		created(results[0].Interface())
+		return results
+	}).Interface()
+}
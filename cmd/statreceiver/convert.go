@@ -0,0 +1,55 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver/pipecfg"
+)
+
+func newConvertCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "convert <input> <output>",
+		Short: "convert a configuration between Lua, YAML and JSON",
+		Long: "Convert a configuration between Lua, YAML and JSON, by the extensions of the\n" +
+			"paths. Lua scripts can only be converted if they consist of assignments and\n" +
+			"calls of components, and assignments of values and tables their functions\n" +
+			"use, which are copied into the functions. os.getenv, vars, secret and\n" +
+			"string.format become env, var, secret and concat values. Comments are dropped.",
+		Args: cobra.ExactArgs(2),
+		RunE: convert,
+	}
+}
+
+func convert(cmd *cobra.Command, args []string) (err error) {
+	inFormat, ok := pipecfg.FormatOf(args[0])
+	if !ok {
+		return errs.New("unknown format of %s: expected .lua, .yaml, .yml or .json", args[0])
+	}
+	outFormat, ok := pipecfg.FormatOf(args[1])
+	if !ok {
+		return errs.New("unknown format of %s: expected .lua, .yaml, .yml or .json", args[1])
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer func() { err = errs.Combine(err, in.Close()) }()
+
+	cfg, err := pipecfg.Decode(args[0], in, inFormat)
+	if err != nil {
+		return err
+	}
+	data, err := pipecfg.Encode(cfg, outFormat)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(args[1], data, 0644)
+}
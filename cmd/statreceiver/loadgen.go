@@ -0,0 +1,275 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zeebo/admission/v3/admproto"
+	"github.com/zeebo/errs"
+
+	"storj.io/private/process"
+	"storj.io/statreceiver"
+)
+
+var loadgenFlags struct {
+	Applications int
+	Instances    int
+	Keys         int
+	Headers      int
+	Rate         float64
+	Duration     time.Duration
+	Count        int
+	Report       time.Duration
+	MinRate      float64
+	Seed         int64
+}
+
+// maxUDPPacket is the largest packet udpin reads.
+const maxUDPPacket = 10 * 1024
+
+func newLoadgenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "loadgen <target>",
+		Short: "send synthesized admission packets to benchmark a configuration",
+		Long: "Send synthesized admission packets to a target, which is one of\n\n" +
+			"  udp://host:port  packets for udpin\n" +
+			"  tcp://host:port  parsed metrics for forwardin, which acknowledges them\n" +
+			"  file://path      a capture for filein, timestamped at the given rate\n\n" +
+			"The achieved rate is reported, and with --min-rate loadgen fails if it\n" +
+			"could not send that many packets per second. Over tcp only packets the\n" +
+			"receiver acknowledged count as sent, and the rate is measured once all\n" +
+			"were acknowledged, while over udp the receiver may still drop packets it\n" +
+			"can't keep up with.",
+		Args: cobra.ExactArgs(1),
+		RunE: loadgen,
+	}
+	flags := cmd.Flags()
+	flags.IntVar(&loadgenFlags.Applications, "applications", 1, "number of applications")
+	flags.IntVar(&loadgenFlags.Instances, "instances", 10, "number of instances per application")
+	flags.IntVar(&loadgenFlags.Keys, "keys", 20, "number of keys per packet")
+	flags.IntVar(&loadgenFlags.Headers, "headers", 0, "number of headers per packet")
+	flags.Float64Var(&loadgenFlags.Rate, "rate", 1000, "packets per second, 0 for as fast as possible")
+	flags.DurationVar(&loadgenFlags.Duration, "duration", 10*time.Second, "how long to send for, 0 for no limit")
+	flags.IntVar(&loadgenFlags.Count, "count", 0, "number of packets to send, 0 for no limit")
+	flags.DurationVar(&loadgenFlags.Report, "report", time.Second, "how often to report progress, 0 to only report at the end")
+	flags.Float64Var(&loadgenFlags.MinRate, "min-rate", 0, "fail unless at least this many packets per second were sent, or acknowledged over tcp")
+	flags.Int64Var(&loadgenFlags.Seed, "seed", 0, "seed for the random metric values")
+	return cmd
+}
+
+// packetGenerator synthesizes admission packets, cycling through the
+// applications and instances.
+type packetGenerator struct {
+	rng    *rand.Rand
+	writer admproto.Writer
+	keys   []string
+	next   int
+	buf    []byte
+}
+
+func newPacketGenerator() *packetGenerator {
+	g := &packetGenerator{
+		rng:    rand.New(rand.NewSource(loadgenFlags.Seed)),
+		writer: admproto.NewWriterWith(admproto.Options{FloatEncoding: admproto.Float64Encoding}),
+	}
+	for i := 0; i < loadgenFlags.Keys; i++ {
+		g.keys = append(g.keys, fmt.Sprintf("loadgen,scope=storj.io/statreceiver,name=metric%d value", i))
+	}
+	return g
+}
+
+// packet returns the next packet. It is only valid until the next call.
+func (g *packetGenerator) packet() ([]byte, error) {
+	app := g.next / loadgenFlags.Instances
+	inst := g.next % loadgenFlags.Instances
+	g.next = (g.next + 1) % (loadgenFlags.Applications * loadgenFlags.Instances)
+
+	g.writer.Reset()
+	buf, err := g.writer.Begin(g.buf[:0], fmt.Sprintf("loadgen-%d", app),
+		[]byte(fmt.Sprintf("instance-%d", inst)), loadgenFlags.Headers)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < loadgenFlags.Headers; i++ {
+		buf, err = g.writer.AppendHeader(buf, []byte(fmt.Sprintf("header%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range g.keys {
+		buf, err = g.writer.Append(buf, key, g.rng.Float64()*1000)
+		if err != nil {
+			return nil, err
+		}
+	}
+	g.buf = admproto.AddChecksum(buf)
+	return g.buf, nil
+}
+
+// loadgenTarget opens the destination of a target. lost returns how many of
+// the packets the destination accepted were dropped later, once it is
+// closed.
+func loadgenTarget(target string) (dest statreceiver.PacketDest, closer io.Closer, file bool, lost func() int64, err error) {
+	scheme, address := "", target
+	if i := strings.Index(target, "://"); i >= 0 {
+		scheme, address = target[:i], target[i+3:]
+	}
+
+	none := func() int64 { return 0 }
+	switch scheme {
+	case "udp":
+		udp, err := statreceiver.NewUDPDest(address)
+		return udp, udp, false, none, err
+	case "tcp":
+		forward, err := statreceiver.NewForwardDest(address)
+		if err != nil {
+			return nil, nil, false, nil, err
+		}
+		counter := &forwardCounter{ForwardDest: forward}
+		return statreceiver.NewParser(counter), forward, false, counter.lost, nil
+	case "file":
+		fileDest, err := statreceiver.NewFileDest(address, "flush=0")
+		return fileDest, fileDest, true, none, err
+	default:
+		return nil, nil, false, nil, errs.New("invalid target %q: expected udp://, tcp:// or file://", target)
+	}
+}
+
+// forwardCounter counts the metrics a ForwardDest rejects right away, to tell
+// them apart from the ones it drops later because they weren't acknowledged.
+type forwardCounter struct {
+	*statreceiver.ForwardDest
+	rejected int64
+}
+
+// Metric implements statreceiver.MetricDest.
+func (c *forwardCounter) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	err := c.ForwardDest.Metric(application, instance, key, val, ts)
+	if err != nil {
+		c.rejected++
+	}
+	return err
+}
+
+// lost returns how many packets were accepted, but some of their metrics
+// were never acknowledged.
+func (c *forwardCounter) lost() int64 {
+	dropped := c.Stats().Dropped - c.rejected
+	if dropped <= 0 || loadgenFlags.Keys == 0 {
+		return 0
+	}
+	return (dropped + int64(loadgenFlags.Keys) - 1) / int64(loadgenFlags.Keys)
+}
+
+func loadgen(cmd *cobra.Command, args []string) (err error) {
+	if loadgenFlags.Applications <= 0 || loadgenFlags.Instances <= 0 {
+		return errs.New("--applications and --instances must be positive")
+	}
+	if loadgenFlags.Rate < 0 {
+		return errs.New("--rate must not be negative")
+	}
+
+	dest, closer, file, lost, err := loadgenTarget(args[0])
+	if err != nil {
+		return err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			err = errs.Combine(err, closer.Close())
+		}
+	}()
+	if file && loadgenFlags.Duration == 0 && loadgenFlags.Count == 0 {
+		return errs.New("--duration or --count is required for a capture")
+	}
+
+	ctx, cancel := process.Ctx(cmd)
+	defer cancel()
+
+	gen := newPacketGenerator()
+	udp := strings.HasPrefix(args[0], "udp://")
+	out := cmd.OutOrStdout()
+
+	var sent, failed, bytes int64
+	var lastSent int64
+	start := time.Now()
+	lastReport := start
+	report := func(now time.Time) {
+		fmt.Fprintf(out, "sent %d packets (%d failed, %d bytes), %.0f packets/s\n",
+			sent, failed, bytes, float64(sent-lastSent)/now.Sub(lastReport).Seconds())
+		lastSent, lastReport = sent, now
+	}
+
+	for i := 0; loadgenFlags.Count == 0 || i < loadgenFlags.Count; i++ {
+		// captures are written as fast as possible with timestamps at the
+		// requested rate, so replaying them reproduces it.
+		ts := time.Now()
+		if loadgenFlags.Rate > 0 {
+			due := start.Add(time.Duration(float64(i) / loadgenFlags.Rate * float64(time.Second)))
+			if file {
+				ts = due
+			} else if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
+				ts = time.Now()
+			}
+		}
+		if ctx.Err() != nil || (loadgenFlags.Duration > 0 && ts.Sub(start) >= loadgenFlags.Duration) {
+			break
+		}
+
+		packet, err := gen.packet()
+		if err != nil {
+			return err
+		}
+		if udp && len(packet) > maxUDPPacket {
+			return errs.New("packets of %d bytes are larger than udpin reads, use fewer keys", len(packet))
+		}
+
+		if err := dest.Packet(packet, ts); err != nil {
+			failed++
+		} else {
+			sent++
+			bytes += int64(len(packet))
+		}
+
+		if now := time.Now(); loadgenFlags.Report > 0 && now.Sub(lastReport) >= loadgenFlags.Report {
+			report(now)
+		}
+	}
+
+	// flush before measuring, so buffered packets count against the rate,
+	// and don't count packets that were dropped instead.
+	closed = true
+	if err := closer.Close(); err != nil {
+		return err
+	}
+	if n := lost(); n > 0 {
+		if n > sent {
+			n = sent
+		}
+		sent -= n
+		failed += n
+	}
+
+	elapsed := time.Since(start)
+	rate := float64(sent) / elapsed.Seconds()
+	fmt.Fprintf(out, "total: %d packets (%d failed, %d bytes) in %s, %.0f packets/s\n",
+		sent, failed, bytes, elapsed.Round(time.Millisecond), rate)
+
+	if loadgenFlags.MinRate > 0 && rate < loadgenFlags.MinRate {
+		return errs.New("achieved %.0f packets/s, below the minimum of %.0f", rate, loadgenFlags.MinRate)
+	}
+	return nil
+}
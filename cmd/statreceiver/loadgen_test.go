@@ -0,0 +1,136 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+// setLoadgenFlags resets loadgenFlags to small test values and applies flags.
+func setLoadgenFlags(flags ...func()) {
+	loadgenFlags.Applications, loadgenFlags.Instances = 2, 3
+	loadgenFlags.Keys, loadgenFlags.Headers = 4, 2
+	loadgenFlags.Rate, loadgenFlags.Duration, loadgenFlags.Count = 1000, 0, 6
+	loadgenFlags.Report, loadgenFlags.MinRate, loadgenFlags.Seed = 0, 0, 1
+	for _, flag := range flags {
+		flag()
+	}
+}
+
+func runLoadgen(target string) (string, error) {
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	err := loadgen(cmd, []string{target})
+	return out.String(), err
+}
+
+func TestLoadgenPacket(t *testing.T) {
+	setLoadgenFlags()
+	gen := newPacketGenerator()
+
+	recorder := statreceivertest.NewMetricRecorder()
+	parser := statreceiver.NewParser(recorder)
+	ts := time.Unix(1600000000, 0)
+
+	var apps, insts []string
+	for i := 0; i < 6; i++ {
+		packet, err := gen.packet()
+		require.NoError(t, err)
+		require.NoError(t, parser.Packet(packet, ts))
+
+		decoded := decodePacket(packet, ts)
+		require.Empty(t, decoded.Error)
+		require.Equal(t, map[string]string{"header0": "value0", "header1": "value1"}, decoded.Headers)
+		apps = append(apps, decoded.Application)
+		insts = append(insts, decoded.Instance)
+	}
+	require.Equal(t, []string{"loadgen-0", "loadgen-0", "loadgen-0", "loadgen-1", "loadgen-1", "loadgen-1"}, apps)
+	require.Equal(t, []string{"instance-0", "instance-1", "instance-2", "instance-0", "instance-1", "instance-2"}, insts)
+
+	metrics := recorder.Metrics()
+	require.Len(t, metrics, 6*4)
+	for i, m := range metrics[:4] {
+		require.Equal(t, fmt.Sprintf("loadgen,scope=storj.io/statreceiver,name=metric%d value", i), string(m.Key))
+		require.True(t, m.Val >= 0 && m.Val < 1000)
+	}
+}
+
+func TestLoadgenFile(t *testing.T) {
+	setLoadgenFlags()
+	path := filepath.Join(t.TempDir(), "capture")
+
+	out, err := runLoadgen("file://" + path)
+	require.NoError(t, err)
+	require.Contains(t, out, "total: 6 packets (0 failed")
+
+	packets := readCapture(t, path)
+	require.Len(t, packets, 6)
+
+	recorder := statreceivertest.NewMetricRecorder()
+	parser := statreceiver.NewParser(recorder)
+	for i, p := range packets {
+		require.NoError(t, parser.Packet(p.Data, p.TS))
+		// timestamps follow the requested rate.
+		require.Equal(t, time.Duration(i)*time.Millisecond, p.TS.Sub(packets[0].TS))
+	}
+	metrics := recorder.Metrics()
+	require.Len(t, metrics, 6*4)
+	last := metrics[len(metrics)-1]
+	require.Equal(t, "loadgen-1", last.Application)
+	require.Equal(t, "instance-2", last.Instance)
+	require.Equal(t, "loadgen,scope=storj.io/statreceiver,name=metric3 value", string(last.Key))
+}
+
+func TestLoadgenMinRate(t *testing.T) {
+	setLoadgenFlags(func() { loadgenFlags.MinRate = 1e15 })
+	path := filepath.Join(t.TempDir(), "capture")
+
+	out, err := runLoadgen("file://" + path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "below the minimum")
+	// the capture is still written and reported.
+	require.Contains(t, out, "total: 6 packets")
+	require.Len(t, readCapture(t, path), 6)
+}
+
+func TestLoadgenTCP(t *testing.T) {
+	setLoadgenFlags()
+	source, err := statreceiver.NewForwardSource("127.0.0.1:0")
+	require.NoError(t, err)
+
+	// packets count once forwardin acknowledged their metrics.
+	out, err := runLoadgen("tcp://" + source.Addr().String())
+	require.NoError(t, err)
+	require.Contains(t, out, "total: 6 packets (0 failed")
+	for i := 0; i < 6*4; i++ {
+		_, err := source.NextMetric()
+		require.NoError(t, err)
+	}
+
+	// without a receiver, the packets aren't acknowledged.
+	require.NoError(t, source.Close())
+	_, err = runLoadgen("tcp://" + source.Addr().String())
+	require.Error(t, err)
+}
+
+func TestLoadgenInvalid(t *testing.T) {
+	setLoadgenFlags(func() { loadgenFlags.Count = 0 })
+	_, err := runLoadgen("file://" + filepath.Join(t.TempDir(), "capture"))
+	require.Error(t, err)
+
+	setLoadgenFlags()
+	_, err = runLoadgen("http://localhost")
+	require.Error(t, err)
+}
@@ -4,11 +4,15 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -18,13 +22,19 @@ import (
 	"storj.io/common/fpath"
 	"storj.io/private/cfgstruct"
 	"storj.io/private/process"
+	"storj.io/private/version"
 	"storj.io/statreceiver"
+	"storj.io/statreceiver/admin"
 	"storj.io/statreceiver/luacfg"
+	"storj.io/statreceiver/pipecfg"
 )
 
 // Config is the set of configuration values we care about.
 var Config struct {
-	Input string `default:"" help:"path to configuration file"`
+	Input string   `default:"" help:"path to configuration file, a Lua script or a .yaml, .yml or .json pipeline"`
+	Path  string   `default:"" help:"directories to search for Lua modules, separated by the path list separator"`
+	Var   []string `help:"key=value to set vars.key in the script, or {var: key} in a declarative pipeline, may be repeated"`
+	Admin string   `default:"" help:"address for the unauthenticated admin http server with health checks, profiles and pipeline state, like localhost:9100, disabled if empty"`
 }
 
 func main() {
@@ -38,11 +48,17 @@ func main() {
 	defaults := cfgstruct.DefaultsFlag(cmd)
 	process.Bind(cmd, &Config, defaults, cfgstruct.ConfDir(defaultConfDir))
 	cmd.Flags().String("config", filepath.Join(defaultConfDir, "config.yaml"), "path to configuration")
+	cmd.AddCommand(newCaptureCmd(), newLoadgenCmd(), newConvertCmd())
 	process.Exec(cmd)
 }
 
 // Main is the real main method.
 func Main(cmd *cobra.Command, args []string) error {
+	// declarative pipelines have no modules.
+	if format, ok := pipecfg.FormatOf(Config.Input); ok && format != pipecfg.Lua && Config.Path != "" {
+		return errs.New("--path only applies to Lua scripts, not %s", Config.Input)
+	}
+
 	var input io.Reader
 	switch Config.Input {
 	case "":
@@ -63,47 +79,116 @@ func Main(cmd *cobra.Command, args []string) error {
 		input = inputFile
 	}
 
-	scope := luacfg.NewScope()
-	err := errs.Combine(
-		scope.RegisterVal("deliver", statreceiver.Deliver),
-		scope.RegisterVal("filein", statreceiver.NewFileSource),
-		scope.RegisterVal("fileout", statreceiver.NewFileDest),
-		scope.RegisterVal("udpin", statreceiver.NewUDPSource),
-		scope.RegisterVal("udpout", statreceiver.NewUDPDest),
-		scope.RegisterVal("parse", statreceiver.NewParser),
-		scope.RegisterVal("print", statreceiver.NewPrinter),
-		scope.RegisterVal("packetprint", statreceiver.NewPacketPrinter),
-		scope.RegisterVal("pcopy", statreceiver.NewPacketCopier),
-		scope.RegisterVal("mcopy", statreceiver.NewMetricCopier),
-		scope.RegisterVal("pbuf", statreceiver.NewPacketBuffer),
-		scope.RegisterVal("mbuf", statreceiver.NewMetricBuffer),
-		scope.RegisterVal("packetfilter", statreceiver.NewPacketFilter),
-		scope.RegisterVal("headermultivalmatcher", statreceiver.NewHeaderMultiValMatcher),
-		scope.RegisterVal("appfilter", statreceiver.NewApplicationFilter),
-		scope.RegisterVal("instfilter", statreceiver.NewInstanceFilter),
-		scope.RegisterVal("keyfilter", statreceiver.NewKeyFilter),
-		scope.RegisterVal("filterfile", statreceiver.NewPatternFile),
-		scope.RegisterVal("sanitize", statreceiver.NewSanitizer),
-		scope.RegisterVal("graphite", statreceiver.NewGraphiteDest),
-		scope.RegisterVal("influx", statreceiver.NewInfluxDest),
-		scope.RegisterVal("db", statreceiver.NewDBDest),
-		scope.RegisterVal("pbufprep", statreceiver.NewPacketBufPrep),
-		scope.RegisterVal("mbufprep", statreceiver.NewMetricBufPrep),
-		scope.RegisterVal("versionsplit", statreceiver.NewVersionSplit),
-		scope.RegisterVal("zeroinstanceif", statreceiver.NewInstanceZeroerIf),
-		scope.RegisterVal("zeroinstanceifnot", statreceiver.NewInstanceZeroerIfNot),
-		scope.RegisterVal("eventkit", statreceiver.NewEventkit),
-	)
-	if err != nil {
-		return err
+	ctx, cancel := process.Ctx(cmd)
+	defer cancel()
+
+	var adminServer *admin.Server
+	if Config.Admin != "" {
+		listener, err := net.Listen("tcp", Config.Admin)
+		if err != nil {
+			return err
+		}
+		adminServer = admin.NewServer(build())
+		go func() {
+			if err := adminServer.Serve(ctx, listener); err != nil {
+				log.Printf("Admin server failed: %v", err)
+			}
+		}()
+		log.Printf("Admin server listening on %s", listener.Addr())
 	}
 
-	err = scope.Run(input)
+	data, err := ioutil.ReadAll(input)
 	if err != nil {
 		return err
 	}
 
+	// the process stops once all deliveries finished, which happens when all
+	// sources are files. buffers and destinations are closed on shutdown, the
+	// buffers first, so buffered metrics are not lost.
+	var deliveries []*statreceiver.Delivery
+	var closers []io.Closer
+	var created []admin.Component
+
+	scope := luacfg.NewScope()
+	if Config.Path != "" {
+		scope.AddPath(filepath.SplitList(Config.Path)...)
+	}
+	vars := map[string]string{}
+	for _, v := range Config.Var {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return errs.New("invalid --var %q: expected key=value", v)
+		}
+		scope.SetVar(parts[0], parts[1])
+		vars[parts[0]] = parts[1]
+	}
+
+	constructors := components(&deliveries, &closers, &created)
+	if format, ok := pipecfg.FormatOf(Config.Input); ok && format != pipecfg.Lua {
+		cfg, err := pipecfg.Decode(Config.Input, bytes.NewReader(data), format)
+		if err != nil {
+			return err
+		}
+		if _, err := pipecfg.Compile(cfg, constructors, vars); err != nil {
+			return err
+		}
+	} else {
+		var group errs.Group
+		for name, constructor := range constructors {
+			group.Add(scope.RegisterVal(name, constructor))
+		}
+		if err := group.Err(); err != nil {
+			return err
+		}
+		if err := scope.RunNamed(Config.Input, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	if adminServer != nil {
+		adminServer.SetPipeline(admin.Pipeline{Name: Config.Input, Config: data, Components: created})
+	}
+
 	log.Printf("Started")
 
-	select {}
+	select {
+	case <-ctx.Done():
+	case <-finished(deliveries):
+		log.Printf("All sources finished")
+	}
+
+	var group errs.Group
+	for _, delivery := range deliveries {
+		group.Add(delivery.Close())
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		group.Add(closers[i].Close())
+	}
+	return group.Err()
+}
+
+// build returns the version and commit the binary was built with, which are
+// set with linker flags.
+func build() admin.Build {
+	var build admin.Build
+	if !version.Build.Version.IsZero() {
+		build.Version = version.Build.Version.String()
+	}
+	build.Commit = version.Build.CommitHash
+	return build
+}
+
+// finished returns a channel that is closed once all deliveries are done. It
+// returns nil if there are none.
+func finished(deliveries []*statreceiver.Delivery) <-chan struct{} {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, delivery := range deliveries {
+			<-delivery.Done()
+		}
+		close(done)
+	}()
+	return done
 }
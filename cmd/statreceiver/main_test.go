@@ -0,0 +1,60 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+)
+
+func TestRun_DeclarativeVars(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.cap")
+	dest, err := statreceiver.NewFileDest(in)
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Packet([]byte("packet"), ts))
+	require.NoError(t, dest.Close())
+
+	// the paths come from a var and the environment.
+	require.NoError(t, os.Setenv("STATRECEIVER_TEST_DIR", dir))
+	defer func() { require.NoError(t, os.Unsetenv("STATRECEIVER_TEST_DIR")) }()
+	pipeline := filepath.Join(dir, "pipeline.yaml")
+	require.NoError(t, ioutil.WriteFile(pipeline, []byte(`
+run:
+  - type: deliver
+    args:
+      - {type: filein, args: [{var: in}]}
+      - {type: fileout, args: [{concat: [{env: STATRECEIVER_TEST_DIR}, /out.cap]}]}
+`), 0644))
+
+	Config.Input, Config.Var, Config.Path = pipeline, []string{"in=" + in}, ""
+	require.NoError(t, Main(&cobra.Command{}, nil))
+	packets := readCapture(t, filepath.Join(dir, "out.cap"))
+	require.Len(t, packets, 1)
+	require.Equal(t, []byte("packet"), packets[0].Data)
+
+	// without the var, the pipeline can't be built.
+	Config.Var = nil
+	err = Main(&cobra.Command{}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "var in is not set")
+
+	// declarative pipelines have no modules.
+	Config.Input, Config.Var, Config.Path = "pipeline.json", nil, "lib"
+	err = Main(&cobra.Command{}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--path only applies to Lua scripts")
+}
@@ -4,6 +4,7 @@
 package statreceiver
 
 import (
+	"errors"
 	"io"
 	"log"
 	"sync/atomic"
@@ -14,19 +15,56 @@ type closerfunc func() error
 
 func (f closerfunc) Close() error { return f() }
 
+// Delivery is a running Deliver or DeliverMetrics.
+type Delivery struct {
+	done     uint32
+	finished chan struct{}
+}
+
+func newDelivery() *Delivery {
+	return &Delivery{finished: make(chan struct{})}
+}
+
+// Close stops delivery. The source is still asked for one more packet or
+// metric, so close the source afterwards.
+func (d *Delivery) Close() error {
+	atomic.StoreUint32(&d.done, 1)
+	return nil
+}
+
+// Done returns a channel that is closed once the source reached its end, like
+// a file source after its last packet, or after Close.
+func (d *Delivery) Done() <-chan struct{} { return d.finished }
+
+func (d *Delivery) stopped() bool { return atomic.LoadUint32(&d.done) != 0 }
+
 // Deliver kicks off a goroutine that reads packets from source and delivers them
 // to dest. To stop delivery, call Close on the return value then close the source.
-func Deliver(source Source, dest PacketDest) io.Closer {
-	done := new(uint32)
+// Delivery stops by itself when the source returns io.EOF.
+func Deliver(source Source, dest PacketDest) *Delivery {
+	d := newDelivery()
 
 	go func() {
-		for atomic.LoadUint32(done) == 0 {
-			data, ts, err := source.Next()
+		defer close(d.finished)
+		senders, _ := source.(SenderSource)
+		for !d.stopped() {
+			var data []byte
+			var ts time.Time
+			var sender string
+			var err error
+			if senders != nil {
+				data, ts, sender, err = senders.NextFrom()
+			} else {
+				data, ts, err = source.Next()
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
 			if err != nil {
 				log.Printf("failed getting packet: %v", err)
 				continue
 			}
-			err = dest.Packet(data, ts)
+			err = sendPacket(dest, data, ts, sender)
 			if err != nil {
 				log.Printf("failed delivering packet: %v", err)
 				continue
@@ -34,10 +72,35 @@ func Deliver(source Source, dest PacketDest) io.Closer {
 		}
 	}()
 
-	return closerfunc(func() error {
-		atomic.StoreUint32(done, 1)
-		return nil
-	})
+	return d
+}
+
+// DeliverMetrics is like Deliver, but reads metrics from a MetricSource and
+// delivers them to a MetricDest. Delivery stops when the source returns
+// io.EOF.
+func DeliverMetrics(source MetricSource, dest MetricDest) *Delivery {
+	d := newDelivery()
+
+	go func() {
+		defer close(d.finished)
+		for !d.stopped() {
+			m, err := source.NextMetric()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				log.Printf("failed getting metric: %v", err)
+				continue
+			}
+			err = dest.Metric(m.Application, m.Instance, m.Key, m.Val, m.TS)
+			if err != nil {
+				log.Printf("failed delivering metric: %v", err)
+				continue
+			}
+		}
+	}()
+
+	return d
 }
 
 // Source reads incoming packets.
@@ -45,11 +108,40 @@ type Source interface {
 	Next() (data []byte, ts time.Time, err error)
 }
 
+// SenderSource is a Source that knows where packets come from, like the
+// address of the host that sent a datagram.
+type SenderSource interface {
+	Source
+	NextFrom() (data []byte, ts time.Time, sender string, err error)
+}
+
+// MetricSource reads incoming metrics, for sources that produce already
+// parsed metrics rather than packets.
+type MetricSource interface {
+	NextMetric() (Metric, error)
+}
+
 // PacketDest handles packets.
 type PacketDest interface {
 	Packet(data []byte, ts time.Time) error
 }
 
+// SenderPacketDest is a PacketDest that keeps track of where packets come
+// from. Deliver passes it the sender of a SenderSource.
+type SenderPacketDest interface {
+	PacketDest
+	PacketFrom(data []byte, ts time.Time, sender string) error
+}
+
+// sendPacket passes a packet to dest, with the sender if dest keeps track of
+// it.
+func sendPacket(dest PacketDest, data []byte, ts time.Time, sender string) error {
+	if senders, ok := dest.(SenderPacketDest); ok {
+		return senders.PacketFrom(data, ts, sender)
+	}
+	return dest.Packet(data, ts)
+}
+
 // MetricDest handles metrics.
 type MetricDest interface {
 	Metric(application, instance string, key []byte, val float64, ts time.Time) error
@@ -6,6 +6,8 @@ package statreceiver
 import (
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zeebo/errs"
@@ -22,13 +24,18 @@ func NewPacketCopier(dest ...PacketDest) *PacketCopier {
 	return &PacketCopier{dest: dest}
 }
 
-var _ PacketDest = (*PacketCopier)(nil)
+var _ SenderPacketDest = (*PacketCopier)(nil)
 
 // Packet implements the PacketDest interface.
 func (p *PacketCopier) Packet(data []byte, ts time.Time) (ferr error) {
+	return p.PacketFrom(data, ts, "")
+}
+
+// PacketFrom implements the SenderPacketDest interface.
+func (p *PacketCopier) PacketFrom(data []byte, ts time.Time, sender string) (ferr error) {
 	var errlist errs.Group
 	for _, dest := range p.dest {
-		errlist.Add(dest.Packet(data, ts))
+		errlist.Add(sendPacket(dest, data, ts, sender))
 	}
 	return errlist.Err()
 }
@@ -58,43 +65,86 @@ func (m *MetricCopier) Metric(application, instance string,
 
 // Packet represents a single packet.
 type Packet struct {
-	Data []byte
-	TS   time.Time
+	Data   []byte
+	TS     time.Time
+	Sender string
 }
 
 // PacketBuffer is a packet buffer. It has a given buffer size and allows
 // packets to buffer in memory to deal with potentially variable processing
 // speeds. PacketBuffers drop packets if the buffer is full.
 type PacketBuffer struct {
-	ch chan Packet
+	dropped int64
+	ch      chan Packet
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
 }
 
-// NewPacketBuffer makes a packet buffer with a buffer size of bufsize.
-func NewPacketBuffer(p PacketDest, bufsize int) *PacketBuffer {
+// NewPacketBuffer makes a packet buffer with a buffer size of bufsize. Use
+// Close to deliver the buffered packets and stop.
+func NewPacketBuffer(p PacketDest, bufsize int) (*PacketBuffer, error) {
+	if bufsize < 0 {
+		return nil, errs.New("invalid packet buffer size %d", bufsize)
+	}
 	ch := make(chan Packet, bufsize)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for pkt := range ch {
-			err := p.Packet(pkt.Data, pkt.TS)
+			err := sendPacket(p, pkt.Data, pkt.TS, pkt.Sender)
 			if err != nil {
 				log.Printf("failed delivering buffered packet: %v", err)
 			}
 		}
 	}()
-	return &PacketBuffer{ch: ch}
+	return &PacketBuffer{ch: ch, done: done}, nil
 }
 
-var _ PacketDest = (*PacketBuffer)(nil)
+var _ SenderPacketDest = (*PacketBuffer)(nil)
 
 // Packet implements the PacketDest interface.
 func (p *PacketBuffer) Packet(data []byte, ts time.Time) error {
+	return p.PacketFrom(data, ts, "")
+}
+
+// PacketFrom implements the SenderPacketDest interface.
+func (p *PacketBuffer) PacketFrom(data []byte, ts time.Time, sender string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return errs.New("packet buffer closed")
+	}
+
 	select {
-	case p.ch <- Packet{Data: data, TS: ts}:
+	case p.ch <- Packet{Data: data, TS: ts, Sender: sender}:
 		return nil
 	default:
+		atomic.AddInt64(&p.dropped, 1)
 		return fmt.Errorf("packet buffer overrun")
 	}
 }
 
+// Stats returns how full the buffer is.
+func (p *PacketBuffer) Stats() BufferStats {
+	return BufferStats{Len: len(p.ch), Cap: cap(p.ch), Dropped: atomic.LoadInt64(&p.dropped)}
+}
+
+// Close stops accepting packets and waits until the buffered ones are
+// delivered.
+func (p *PacketBuffer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.ch)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+	return nil
+}
+
 // Metric represents a single metric.
 type Metric struct {
 	Application string
@@ -108,14 +158,25 @@ type Metric struct {
 // metrics to buffer in memory to deal with potentially variable processing
 // speeds. MetricBuffers drop metrics if the buffer is full.
 type MetricBuffer struct {
-	name string
-	ch   chan Metric
+	dropped int64
+	name    string
+	ch      chan Metric
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
 }
 
-// NewMetricBuffer makes a metric buffer with a buffer size of bufsize.
-func NewMetricBuffer(name string, p MetricDest, bufsize int) *MetricBuffer {
+// NewMetricBuffer makes a metric buffer with a buffer size of bufsize. Use
+// Close to deliver the buffered metrics and stop.
+func NewMetricBuffer(name string, p MetricDest, bufsize int) (*MetricBuffer, error) {
+	if bufsize < 0 {
+		return nil, errs.New("invalid %s metric buffer size %d", name, bufsize)
+	}
 	ch := make(chan Metric, bufsize)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for pkt := range ch {
 			err := p.Metric(pkt.Application, pkt.Instance, pkt.Key, pkt.Val, pkt.TS)
 			if err != nil {
@@ -126,7 +187,8 @@ func NewMetricBuffer(name string, p MetricDest, bufsize int) *MetricBuffer {
 	return &MetricBuffer{
 		name: name,
 		ch:   ch,
-	}
+		done: done,
+	}, nil
 }
 
 var _ MetricDest = (*MetricBuffer)(nil)
@@ -134,6 +196,12 @@ var _ MetricDest = (*MetricBuffer)(nil)
 // Metric implements the MetricDest interface.
 func (p *MetricBuffer) Metric(application, instance string, key []byte,
 	val float64, ts time.Time) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return errs.New("%s metric buffer closed", p.name)
+	}
+
 	select {
 	case p.ch <- Metric{
 		Application: application,
@@ -143,10 +211,30 @@ func (p *MetricBuffer) Metric(application, instance string, key []byte,
 		TS:          ts}:
 		return nil
 	default:
+		atomic.AddInt64(&p.dropped, 1)
 		return fmt.Errorf("%s metric buffer overrun", p.name)
 	}
 }
 
+// Stats returns how full the buffer is.
+func (p *MetricBuffer) Stats() BufferStats {
+	return BufferStats{Len: len(p.ch), Cap: cap(p.ch), Dropped: atomic.LoadInt64(&p.dropped)}
+}
+
+// Close stops accepting metrics and waits until the buffered ones are
+// delivered.
+func (p *MetricBuffer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.ch)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+	return nil
+}
+
 // PacketBufPrep prepares a packet destination for a packet buffer.
 // By default, packet memory is reused, which would cause data race conditions
 // when a buffer is also used. PacketBufPrep copies the memory to make sure
@@ -160,11 +248,16 @@ func NewPacketBufPrep(dest PacketDest) *PacketBufPrep {
 	return &PacketBufPrep{dest: dest}
 }
 
-var _ PacketDest = (*PacketBufPrep)(nil)
+var _ SenderPacketDest = (*PacketBufPrep)(nil)
 
 // Packet implements the PacketDest interface.
 func (p *PacketBufPrep) Packet(data []byte, ts time.Time) error {
-	return p.dest.Packet(append([]byte(nil), data...), ts)
+	return p.PacketFrom(data, ts, "")
+}
+
+// PacketFrom implements the SenderPacketDest interface.
+func (p *PacketBufPrep) PacketFrom(data []byte, ts time.Time, sender string) error {
+	return sendPacket(p.dest, append([]byte(nil), data...), ts, sender)
 }
 
 // MetricBufPrep prepares a metric destination for a metric buffer.
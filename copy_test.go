@@ -0,0 +1,86 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+// blockingDest blocks every metric until release is closed.
+type blockingDest struct {
+	release chan struct{}
+}
+
+func (d blockingDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	<-d.release
+	return nil
+}
+
+func TestMetricBuffer_Stats(t *testing.T) {
+	dest := blockingDest{release: make(chan struct{})}
+	buffer, err := statreceiver.NewMetricBuffer("test", dest, 2)
+	require.NoError(t, err)
+
+	// the first metric is taken by the delivering goroutine, the next two
+	// fill the buffer and the last one is dropped.
+	require.NoError(t, buffer.Metric("app", "inst", []byte("k value"), 1, time.Now()))
+	require.Eventually(t, func() bool { return buffer.Stats().Len == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, buffer.Metric("app", "inst", []byte("k value"), 2, time.Now()))
+	require.NoError(t, buffer.Metric("app", "inst", []byte("k value"), 3, time.Now()))
+	require.Error(t, buffer.Metric("app", "inst", []byte("k value"), 4, time.Now()))
+
+	require.Equal(t, statreceiver.BufferStats{Len: 2, Cap: 2, Dropped: 1}, buffer.Stats())
+	close(dest.release)
+	require.Eventually(t, func() bool { return buffer.Stats().Len == 0 }, time.Second, time.Millisecond)
+}
+
+func TestMetricBuffer_Close(t *testing.T) {
+	dest := blockingDest{release: make(chan struct{})}
+	recorder := statreceivertest.NewMetricRecorder()
+	buffer, err := statreceiver.NewMetricBuffer("test", statreceiver.NewMetricCopier(dest, recorder), 10)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, buffer.Metric("app", "inst", []byte("k value"), float64(i), time.Now()))
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- buffer.Close() }()
+	// close waits for the buffered metrics to be delivered.
+	select {
+	case <-closed:
+		t.Fatal("close returned before the buffer was drained")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(dest.release)
+	require.NoError(t, <-closed)
+	require.Len(t, recorder.Metrics(), 5)
+
+	require.Error(t, buffer.Metric("app", "inst", []byte("k value"), 6, time.Now()))
+	require.NoError(t, buffer.Close())
+}
+
+func TestPacketBuffer_Close(t *testing.T) {
+	recorder := statreceivertest.NewPacketRecorder()
+	buffer, err := statreceiver.NewPacketBuffer(recorder, 10)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, buffer.Packet([]byte{byte(i)}, time.Now()))
+	}
+	require.NoError(t, buffer.Close())
+	require.Len(t, recorder.Packets(), 5)
+	require.Error(t, buffer.Packet([]byte{5}, time.Now()))
+}
+
+func TestBuffer_InvalidSize(t *testing.T) {
+	_, err := statreceiver.NewPacketBuffer(statreceivertest.NewPacketRecorder(), -1)
+	require.Error(t, err)
+	_, err = statreceiver.NewMetricBuffer("test", statreceivertest.NewMetricRecorder(), -1)
+	require.Error(t, err)
+}
@@ -4,59 +4,365 @@
 package statreceiver
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
-)
 
-var (
-	sqlupsert = map[string]string{
-		"sqlite3": "INSERT INTO metrics (metric, instance, val, timestamp) " +
-			"VALUES (?, ?, ?, ?) ON CONFLICT(metric, instance) DO UPDATE SET " +
-			"val=excluded.val, timestamp=excluded.timestamp;",
-		"postgres": "INSERT INTO metrics (metric, instance, val, timestamp) " +
-			"VALUES ($1, $2, $3, $4) ON CONFLICT(metric, instance) DO UPDATE SET " +
-			"val=EXCLUDED.val, timestamp=EXCLUDED.timestamp;",
-	}
+	"github.com/lib/pq"
+	"github.com/zeebo/errs"
 )
 
+// dbRowsPerStatement limits the rows of a single multi-row insert, keeping
+// the number of parameters well under sqlite's limit.
+const dbRowsPerStatement = 150
+
+// DBError is the class of database destination errors.
+var DBError = errs.Class("db")
+
 // DBDest is a database metric destination. It stores the latest value given
-// a metric key and application per instance.
+// a metric key and application per instance, and optionally every value in
+// an append-only history table.
+//
+// Metrics are collected in memory and written in batches inside a
+// transaction, whenever the batch is full or the flush interval passes.
+// Failed batches are retried, except ones Postgres rejects for their data,
+// which are logged and dropped. The schema is created or migrated when the
+// destination is created.
 type DBDest struct {
-	driver  string
-	address string
+	*metricBatcher
+
+	driver    string
+	db        *sql.DB
+	history   bool
+	retention time.Duration
 
-	mu sync.Mutex
-	db *sql.DB
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	once     sync.Once
+	closeErr error
 }
 
-// NewDBDest creates a DBDest.
-func NewDBDest(driver, address string) *DBDest {
-	if _, found := sqlupsert[driver]; !found {
-		panic(fmt.Sprintf("driver %s not supported", driver))
+// NewDBDest creates a DBDest. It opens the database and makes sure the schema
+// is up to date. The following options are supported:
+//
+//   - batch=N flushes once N metrics are pending (default 1000).
+//   - interval=D flushes at least every D (default 5s).
+//   - history=true also appends every metric to the metric_history table.
+//   - retention=D deletes history older than D, checked hourly (default 0,
+//     which keeps everything).
+func NewDBDest(driver, address string, opts ...string) (*DBDest, error) {
+	o := parseOptions(opts)
+	batch := o.Int("batch", 1000)
+	interval := o.Duration("interval", 5*time.Second)
+	history := o.Bool("history", false)
+	retention := o.Duration("retention", 0)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	if _, found := dbMigrations[driver]; !found {
+		return nil, DBError.New("driver %s not supported", driver)
+	}
+
+	db, err := sql.Open(driver, address)
+	if err != nil {
+		return nil, DBError.Wrap(err)
+	}
+	if err := migrateDB(context.Background(), driver, db); err != nil {
+		return nil, errs.Combine(DBError.Wrap(err), db.Close())
+	}
+
+	rv := &DBDest{
+		driver:    driver,
+		db:        db,
+		history:   history,
+		retention: retention,
+		stop:      make(chan struct{}),
 	}
-	return &DBDest{
-		driver:  driver,
-		address: address,
+	rv.metricBatcher = newMetricBatcher("db", batch, interval, true, rv.write)
+	if history && retention > 0 {
+		rv.stopped.Add(1)
+		go rv.expire()
 	}
+	return rv, nil
 }
 
+var _ MetricDest = (*DBDest)(nil)
+
 // Metric implements the MetricDest interface.
 func (db *DBDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
-	db.mu.Lock()
-	if db.db == nil {
-		conn, err := sql.Open(db.driver, db.address)
+	return db.add(application, instance, key, val, ts)
+}
+
+// Close flushes pending metrics, stops the background goroutines and closes
+// the database. Closing it again returns the same error.
+func (db *DBDest) Close() error {
+	db.once.Do(func() {
+		close(db.stop)
+		db.stopped.Wait()
+		db.closeErr = errs.Combine(db.metricBatcher.close(), db.db.Close())
+	})
+	return db.closeErr
+}
+
+// expire periodically deletes history rows older than the retention.
+func (db *DBDest) expire() {
+	defer db.stopped.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().Add(-db.retention).Unix()
+		_, err := db.db.Exec(rebind(db.driver, "DELETE FROM metric_history WHERE timestamp < ?"), cutoff)
+		if err != nil {
+			log.Printf("failed expiring db history: %v", err)
+		}
+
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (db *DBDest) write(ctx context.Context, batch []Metric) (err error) {
+	defer func() { err = dbPermanent(err) }()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
 		if err != nil {
-			db.mu.Unlock()
+			err = errs.Combine(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// the upsert can't touch the same row twice in a single statement, so
+	// only keep the latest value of every series.
+	type series struct{ application, metric, instance string }
+	latest := make(map[series]int, len(batch))
+	var rows []Metric
+	for _, m := range batch {
+		s := series{m.Application, string(m.Key), m.Instance}
+		if i, ok := latest[s]; ok {
+			if !m.TS.Before(rows[i].TS) {
+				rows[i] = m
+			}
+			continue
+		}
+		latest[s] = len(rows)
+		rows = append(rows, m)
+	}
+
+	const upsertSuffix = " ON CONFLICT(application, metric, instance) DO UPDATE SET " +
+		"val=excluded.val, timestamp=excluded.timestamp"
+	if err := db.insert(ctx, tx, "metrics", rows, upsertSuffix); err != nil {
+		return err
+	}
+	if db.history {
+		if err := db.insert(ctx, tx, "metric_history", batch, ""); err != nil {
 			return err
 		}
-		db.db = conn
 	}
-	db.mu.Unlock()
+	return nil
+}
 
-	_, err := db.db.Exec(sqlupsert[db.driver], application+"."+string(key), instance, val, ts.Unix())
+// dbPermanent marks err as permanent if it holds a Postgres error of class 22
+// (data exception) or 23 (integrity constraint violation), which writing the
+// same batch again can't fix.
+func dbPermanent(err error) error {
+	rejected := errs.IsFunc(err, func(err error) bool {
+		pqErr, ok := err.(*pq.Error)
+		return ok && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23")
+	})
+	if rejected {
+		return permanent(err)
+	}
 	return err
 }
 
-var _ MetricDest = (*DBDest)(nil)
+// insert writes rows into table with multi-row insert statements.
+func (db *DBDest) insert(ctx context.Context, tx *sql.Tx, table string, rows []Metric, suffix string) error {
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > dbRowsPerStatement {
+			n = dbRowsPerStatement
+		}
+
+		var query strings.Builder
+		args := make([]interface{}, 0, 5*n)
+		query.WriteString("INSERT INTO " + table + " (application, metric, instance, val, timestamp) VALUES ")
+		for i, m := range rows[:n] {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("(?, ?, ?, ?, ?)")
+			args = append(args, m.Application, string(m.Key), m.Instance, m.Val, m.TS.Unix())
+		}
+		query.WriteString(suffix)
+
+		if _, err := tx.ExecContext(ctx, rebind(db.driver, query.String()), args...); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+// rebind replaces ? placeholders with the placeholders of the driver.
+func rebind(driver, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dbMigrations are the schema migrations per driver. The schema version is
+// the number of migrations applied. Version 1 is the original schema from
+// before the schema was versioned, where the application was part of the
+// metric name.
+var dbMigrations = map[string][]string{
+	"sqlite3": {
+		`CREATE TABLE IF NOT EXISTS metrics (
+			metric text,
+			instance text,
+			val real,
+			timestamp integer,
+			primary key (metric, instance)
+		)`,
+		`ALTER TABLE metrics RENAME TO metrics_v1;
+		CREATE TABLE metrics (
+			application text NOT NULL,
+			metric text NOT NULL,
+			instance text NOT NULL,
+			val real,
+			timestamp integer,
+			PRIMARY KEY (application, metric, instance)
+		);
+		INSERT INTO metrics (application, metric, instance, val, timestamp)
+			SELECT
+				CASE WHEN instr(metric, '.') > 0 THEN substr(metric, 1, instr(metric, '.') - 1) ELSE '' END,
+				CASE WHEN instr(metric, '.') > 0 THEN substr(metric, instr(metric, '.') + 1) ELSE metric END,
+				coalesce(instance, ''), val, timestamp
+			FROM metrics_v1;
+		DROP TABLE metrics_v1;`,
+		`CREATE TABLE metric_history (
+			application text NOT NULL,
+			metric text NOT NULL,
+			instance text NOT NULL,
+			val real,
+			timestamp integer NOT NULL
+		);
+		CREATE INDEX metric_history_timestamp ON metric_history (timestamp);`,
+	},
+	"postgres": {
+		`CREATE TABLE IF NOT EXISTS metrics (
+			metric text,
+			instance text,
+			val real,
+			timestamp integer,
+			primary key (metric, instance)
+		)`,
+		`ALTER TABLE metrics RENAME TO metrics_v1;
+		CREATE TABLE metrics (
+			application text NOT NULL,
+			metric text NOT NULL,
+			instance text NOT NULL,
+			val double precision,
+			timestamp bigint,
+			PRIMARY KEY (application, metric, instance)
+		);
+		INSERT INTO metrics (application, metric, instance, val, timestamp)
+			SELECT
+				CASE WHEN strpos(metric, '.') > 0 THEN split_part(metric, '.', 1) ELSE '' END,
+				CASE WHEN strpos(metric, '.') > 0 THEN substr(metric, strpos(metric, '.') + 1) ELSE metric END,
+				coalesce(instance, ''), val, timestamp
+			FROM metrics_v1;
+		DROP TABLE metrics_v1;`,
+		`CREATE TABLE metric_history (
+			application text NOT NULL,
+			metric text NOT NULL,
+			instance text NOT NULL,
+			val double precision,
+			timestamp bigint NOT NULL
+		);
+		CREATE INDEX metric_history_timestamp ON metric_history (timestamp);`,
+	},
+}
+
+// migrateDB brings the schema up to date. The current version is kept in
+// the statreceiver_schema table. A database without that table but with a
+// metrics table is assumed to have the original schema.
+func migrateDB(ctx context.Context, driver string, db *sql.DB) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS statreceiver_schema (version integer NOT NULL)`); err != nil {
+		return err
+	}
+
+	version := 0
+	err = tx.QueryRowContext(ctx, `SELECT version FROM statreceiver_schema`).Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		var tables int
+		query := `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'metrics'`
+		if driver == "postgres" {
+			query = `SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'metrics'`
+		}
+		if err := tx.QueryRowContext(ctx, query).Scan(&tables); err != nil {
+			return err
+		}
+		if tables > 0 {
+			version = 1
+		}
+		if _, err := tx.ExecContext(ctx, rebind(driver, `INSERT INTO statreceiver_schema (version) VALUES (?)`), version); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	migrations := dbMigrations[driver]
+	for ; version < len(migrations); version++ {
+		for _, stmt := range strings.Split(migrations[version], ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return DBError.New("migrating to version %d: %v", version+1, err)
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, rebind(driver, `UPDATE statreceiver_schema SET version = ?`), version)
+	return err
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+)
+
+func TestDBDest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	dest, err := NewDBDest("sqlite3", path, "history=true", "interval=1h")
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Metric("app", "inst", []byte("key"), 1, ts))
+	require.NoError(t, dest.Metric("app", "inst", []byte("key"), 2, ts.Add(time.Second)))
+	require.NoError(t, dest.Metric("other", "inst", []byte("key"), 3, ts))
+	require.Equal(t, 3, dest.Stats().Pending)
+	require.NoError(t, dest.Close())
+	// closing twice is fine.
+	require.NoError(t, dest.Close())
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	var val float64
+	require.NoError(t, db.QueryRow(`SELECT val FROM metrics WHERE application = 'app' AND metric = 'key' AND instance = 'inst'`).Scan(&val))
+	require.Equal(t, 2.0, val)
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM metric_history`).Scan(&count))
+	require.Equal(t, 3, count)
+}
+
+func TestDBDest_MigrateV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	_, err = db.Exec(`create table metrics (metric text, instance text, val real, timestamp integer, primary key (metric, instance))`)
+	require.NoError(t, err)
+	_, err = db.Exec(`insert into metrics values ('app.some.key', 'inst', 5, 1600000000)`)
+	require.NoError(t, err)
+
+	require.NoError(t, migrateDB(context.Background(), "sqlite3", db))
+	// migrating again is a no-op.
+	require.NoError(t, migrateDB(context.Background(), "sqlite3", db))
+
+	var application, metric string
+	require.NoError(t, db.QueryRow(`SELECT application, metric FROM metrics`).Scan(&application, &metric))
+	require.Equal(t, "app", application)
+	require.Equal(t, "some.key", metric)
+}
+
+func TestDBPermanent(t *testing.T) {
+	// data exceptions and constraint violations are permanent, also when
+	// combined with the rollback error.
+	invalid := &pq.Error{Code: "22P02", Message: "invalid input syntax"}
+	require.True(t, isPermanent(dbPermanent(invalid)))
+	require.True(t, isPermanent(dbPermanent(errs.Combine(invalid, errors.New("rollback failed")))))
+	require.True(t, isPermanent(dbPermanent(&pq.Error{Code: "23505"})))
+
+	// connection and other errors are retried.
+	require.False(t, isPermanent(dbPermanent(&pq.Error{Code: "08006"})))
+	require.False(t, isPermanent(dbPermanent(&pq.Error{Code: "40001"})))
+	require.False(t, isPermanent(dbPermanent(errors.New("connection refused"))))
+	require.NoError(t, dbPermanent(nil))
+
+	// a batch of the destination that is permanently rejected is dropped.
+	b := newManualBatcher(10, func(ctx context.Context, batch []Metric) error {
+		return dbPermanent(errs.Combine(invalid))
+	})
+	require.NoError(t, b.add("app", "inst", []byte("a"), 1, time.Unix(1600000000, 0)))
+	require.Error(t, b.Flush())
+	require.Equal(t, BatchStats{Dropped: 1, LastError: "pq: invalid input syntax"}, b.Stats())
+}
+
+func TestRebind(t *testing.T) {
+	require.Equal(t, "a = ? AND b = ?", rebind("sqlite3", "a = ? AND b = ?"))
+	require.Equal(t, "a = $1 AND b = $2", rebind("postgres", "a = ? AND b = ?"))
+}
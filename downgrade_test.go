@@ -0,0 +1,43 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestMetricDowngrade(t *testing.T) {
+	downgrade := statreceiver.NewMetricDowngrade(map[string]string{
+		"total_bytes": "storj.io/storj/satellite.total_bytes",
+	})
+
+	for _, tt := range []struct {
+		key  string
+		keys []string
+	}{
+		{"total_bytes,scope=x value", []string{"storj.io/storj/satellite.total_bytes.value"}},
+		{"unknown,scope=x value", nil},
+		{"v2.key value", nil},
+		{
+			"function_times,kind=success,name=Upload,scope=storj.io/storj/uplink recent",
+			[]string{"storj.io/storj/uplink.Upload.success_times_recent"},
+		},
+		{"function_times,kind=success,name=Upload recent", nil},
+		{
+			"function,name=Upload,scope=storj.io/storj/uplink successes",
+			[]string{"storj.io/storj/uplink.Upload.successes"},
+		},
+		{"function,scope=storj.io/storj/uplink successes", nil},
+	} {
+		dest := statreceivertest.NewMetricRecorder()
+		require.NoError(t, downgrade(dest).Metric("app", "inst", []byte(tt.key), 1, time.Now()))
+		dest.RequireKeys(t, tt.keys...)
+	}
+}
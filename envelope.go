@@ -0,0 +1,77 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// An envelope wraps a forwarded packet with the time it was originally
+// received and, optionally, the sender it came from:
+//
+//	0xff 'S' 'R' version flags ts:uint64 [len:uint8 sender] packet
+//
+// The timestamp is big endian unix nanoseconds and the sender is present if
+// bit 0 of flags is set. Admission packets start with a version byte below 8,
+// so they can never be mistaken for an envelope.
+const (
+	envelopeVersion = 1
+	envelopeHeader  = 3 + 1 + 1 + 8
+
+	envelopeHasSender = 1 << 0
+)
+
+var envelopeMagic = [3]byte{0xff, 'S', 'R'}
+
+// EnvelopeError is the class of envelope errors.
+var EnvelopeError = errs.Class("envelope")
+
+// wrapPacket puts a packet into an envelope.
+func wrapPacket(data []byte, ts time.Time, sender string) []byte {
+	if len(sender) > 255 {
+		sender = sender[:255]
+	}
+
+	out := make([]byte, envelopeHeader, envelopeHeader+1+len(sender)+len(data))
+	copy(out, envelopeMagic[:])
+	out[3] = envelopeVersion
+	binary.BigEndian.PutUint64(out[5:], uint64(ts.UnixNano()))
+	if sender != "" {
+		out[4] |= envelopeHasSender
+		out = append(out, byte(len(sender)))
+		out = append(out, sender...)
+	}
+	return append(out, data...)
+}
+
+// isEnvelope returns whether data is an envelope rather than a plain packet.
+func isEnvelope(data []byte) bool {
+	return len(data) >= len(envelopeMagic) &&
+		data[0] == envelopeMagic[0] && data[1] == envelopeMagic[1] && data[2] == envelopeMagic[2]
+}
+
+// unwrapPacket returns the packet, timestamp and sender of an envelope.
+func unwrapPacket(data []byte) (packet []byte, ts time.Time, sender string, err error) {
+	if !isEnvelope(data) || len(data) < envelopeHeader {
+		return nil, time.Time{}, "", EnvelopeError.New("not an envelope")
+	}
+	if data[3] != envelopeVersion {
+		return nil, time.Time{}, "", EnvelopeError.New("unsupported version %d", data[3])
+	}
+	flags := data[4]
+	ts = time.Unix(0, int64(binary.BigEndian.Uint64(data[5:])))
+	data = data[envelopeHeader:]
+
+	if flags&envelopeHasSender != 0 {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, time.Time{}, "", EnvelopeError.New("truncated sender")
+		}
+		sender = string(data[1 : 1+int(data[0])])
+		data = data[1+int(data[0]):]
+	}
+	return data, ts, sender, nil
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	ts := time.Unix(1600000000, 42)
+
+	packet, gotTS, sender, err := unwrapPacket(wrapPacket([]byte("data"), ts, "edge-1"))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(packet))
+	require.True(t, ts.Equal(gotTS))
+	require.Equal(t, "edge-1", sender)
+
+	packet, _, sender, err = unwrapPacket(wrapPacket([]byte("data"), ts, ""))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(packet))
+	require.Equal(t, "", sender)
+
+	_, _, _, err = unwrapPacket([]byte{0xff, 'S', 'R', envelopeVersion, envelopeHasSender, 0, 0, 0, 0, 0, 0, 0, 0, 10})
+	require.Error(t, err)
+}
+
+func TestUDPEnvelope(t *testing.T) {
+	// UDPSource listens lazily, so reserve a free port for it.
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.LocalAddr().String()
+	require.NoError(t, l.Close())
+
+	type packet struct {
+		data   []byte
+		ts     time.Time
+		sender string
+	}
+	source, err := NewUDPSource(addr, "envelope=true")
+	require.NoError(t, err)
+	received := make(chan packet)
+	go func() {
+		defer close(received)
+		for {
+			data, ts, sender, err := source.NextFrom()
+			if err != nil {
+				return
+			}
+			received <- packet{append([]byte(nil), data...), ts, sender}
+		}
+	}()
+	defer func() {
+		require.NoError(t, source.Close())
+		// the reader stops once the source is closed.
+		for range received {
+		}
+	}()
+
+	// packets are sent until they arrive, since the source may not be
+	// listening yet.
+	receive := func(send func() error, data []byte) packet {
+		for {
+			require.NoError(t, send())
+			select {
+			case p := <-received:
+				for p.data[1] != data[1] {
+					p = <-received
+				}
+				return p
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	ts := time.Unix(1600000000, 0)
+	wrapped, err := NewUDPDest(addr, "envelope=true", "sender=edge")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, wrapped.Close()) }()
+	data := []byte{4, 1, 2}
+	p := receive(func() error { return wrapped.PacketFrom(data, ts, "ignored") }, data)
+	require.Equal(t, data, p.data)
+	require.True(t, ts.Equal(p.ts))
+	require.Equal(t, "edge", p.sender)
+
+	// without a sender of its own, the destination keeps the one of the
+	// packet.
+	relay, err := NewUDPDest(addr, "envelope=true")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, relay.Close()) }()
+	data = []byte{4, 5, 6}
+	p = receive(func() error { return sendPacket(relay, data, ts, "10.0.0.1:5000") }, data)
+	require.Equal(t, "10.0.0.1:5000", p.sender)
+
+	plain, err := NewUDPDest(addr)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, plain.Close()) }()
+	data = []byte{4, 3, 4}
+	p = receive(func() error { return plain.Packet(data, ts) }, data)
+	require.Equal(t, data, p.data)
+	require.True(t, p.ts.After(ts))
+	// plain packets come from the address they were sent from.
+	require.Equal(t, plain.conn.LocalAddr().(*net.UDPAddr).Port, mustUDPAddr(t, p.sender).Port)
+}
+
+func mustUDPAddr(t *testing.T, address string) *net.UDPAddr {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	require.NoError(t, err)
+	return addr
+}
+
+func TestDeliver_Sender(t *testing.T) {
+	source := &senderSource{packets: []Packet{{Data: []byte("a"), Sender: "edge-1"}}}
+	dest := &senderRecorder{}
+	delivery := Deliver(source, NewPacketCopier(dest))
+	<-delivery.Done()
+	require.NoError(t, delivery.Close())
+	require.Equal(t, []string{"edge-1"}, dest.senders)
+}
+
+func TestDeliver_SenderBuffered(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	udp, err := NewUDPDest(conn.LocalAddr().String(), "envelope=true")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, udp.Close()) }()
+	buffer, err := NewPacketBuffer(udp, 10)
+	require.NoError(t, err)
+
+	// the sender passes pbufprep, pcopy and pbuf on to udpout.
+	ts := time.Unix(1600000000, 0)
+	source := &senderSource{packets: []Packet{{Data: []byte{4, 1, 2}, TS: ts, Sender: "edge-1"}}}
+	delivery := Deliver(source, NewPacketBufPrep(NewPacketCopier(buffer)))
+	<-delivery.Done()
+	require.NoError(t, delivery.Close())
+	require.NoError(t, buffer.Close())
+
+	buf := make([]byte, 1500)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	data, got, sender, err := unwrapPacket(buf[:n])
+	require.NoError(t, err)
+	require.Equal(t, []byte{4, 1, 2}, data)
+	require.True(t, ts.Equal(got))
+	require.Equal(t, "edge-1", sender)
+}
+
+type senderSource struct{ packets []Packet }
+
+func (s *senderSource) Next() ([]byte, time.Time, error) {
+	data, ts, _, err := s.NextFrom()
+	return data, ts, err
+}
+
+func (s *senderSource) NextFrom() ([]byte, time.Time, string, error) {
+	if len(s.packets) == 0 {
+		return nil, time.Time{}, "", io.EOF
+	}
+	p := s.packets[0]
+	s.packets = s.packets[1:]
+	return p.Data, p.TS, p.Sender, nil
+}
+
+type senderRecorder struct{ senders []string }
+
+func (r *senderRecorder) Packet(data []byte, ts time.Time) error {
+	return r.PacketFrom(data, ts, "")
+}
+
+func (r *senderRecorder) PacketFrom(data []byte, ts time.Time, sender string) error {
+	r.senders = append(r.senders, sender)
+	return nil
+}
@@ -23,7 +23,7 @@ type Eventkit struct {
 	addr   string
 }
 
-// NewEventkit creates a FileSource.
+// NewEventkit creates an Eventkit sending to the UDP collector at addr.
 func NewEventkit(addr string) *Eventkit {
 	return &Eventkit{
 		addr: addr,
@@ -54,8 +54,11 @@ func (e *Eventkit) Metric(application, instance string, key []byte, val float64,
 	}
 	taggedName := strings.Split(scopeField[0], ",")
 	tags = append(tags, eventkit.String("name", taggedName[0]))
-	for i := 1; i < len(taggedName)-1; i++ {
+	for i := 1; i < len(taggedName); i++ {
 		kv := strings.SplitN(taggedName[i], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
 		tags = append(tags, eventkit.String(kv[0], kv[1]))
 	}
 
@@ -65,7 +68,11 @@ func (e *Eventkit) Metric(application, instance string, key []byte, val float64,
 
 // Close implements io.Closer.
 func (e *Eventkit) Close() error {
-	e.cancel()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		e.cancel()
+	}
 	return nil
 }
 
@@ -0,0 +1,43 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestEventkit(t *testing.T) {
+	server := statreceivertest.NewEventkitServer(t)
+	dest := statreceiver.NewEventkit(server.Addr())
+
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Metric("satellite", "sat-1", []byte("function,scope=x,kind=y count"), 3, ts))
+	require.NoError(t, dest.Metric("satellite", "sat-1", []byte("uptime"), 10, ts))
+	require.NoError(t, dest.Close())
+
+	events := server.Wait(t, 2)
+	require.Equal(t, "statreceiver", events[0].Application)
+
+	tags := events[0].Tags
+	require.Equal(t, "satellite", tags["application"])
+	require.Equal(t, "sat-1", tags["instance"])
+	require.Equal(t, "function", tags["name"])
+	require.Equal(t, "count", tags["field"])
+	require.Equal(t, "x", tags["scope"])
+	require.Equal(t, "y", tags["kind"])
+	require.Equal(t, "3", tags["value"])
+
+	require.Equal(t, "uptime", events[1].Tags["name"])
+	require.NotContains(t, events[1].Tags, "field")
+}
+
+func TestEventkit_CloseUnused(t *testing.T) {
+	require.NoError(t, statreceiver.NewEventkit("127.0.0.1:0").Close())
+}
@@ -1,15 +1,67 @@
+-- shared parts of a configuration can live in modules loaded with
+-- require "name" from the --path directories, or scripts run with
+-- include(path). secret(path) reads a password from a file, vars holds the
+-- --var key=value values and expand("${name}") substitutes vars or the
+-- environment.
+
 -- possible sources:
---  * udpin(address)
---  * filein(path)
+--  * udpin(address, options...). with "envelope=true", packets wrapped by
+--    udpout(address, "envelope=true") keep their original receive time and
+--    sender
+--  * filein(path) reads a fileout capture. path may be a directory or a glob
+--    like "captures/*.cap.zst" to read rotated captures in order. for
+--    replaying, "speed=1" paces packets as recorded ("speed=10" ten times
+--    faster), "shift=true" moves timestamps to now, and "from=T" and
+--    "until=T" restrict to an rfc3339 time range. delivery stops at the end
+--    and statreceiver exits once all sources are done
+--  * pcapin(path, options...) reads the udp payloads of pcap or pcapng files,
+--    like a tcpdump of port 9000, with the capture times. "port=N" only reads
+--    datagrams from or to port N. fragmented ipv4 datagrams are reassembled
 -- multiple sources can be handled in the same run (including multiple sources
 -- of the same type) by calling deliver more than once.
+-- metric sources skip packet parsing and are tied to a metric destination with
+-- mdeliver(source, metric_destination):
+--  * otlpin(address) accepts opentelemetry otlp/http metric exports
+--  * statsdin(address, options...) aggregates statsd and dogstatsd udp lines
+--    every "interval=10s". options "application=NAME" and "instance=NAME" set
+--    the metric application and instance, or "application_tag=TAG" and
+--    "instance_tag=TAG" take them from dogstatsd tags
+--  * graphitein(address, options...) accepts the graphite plaintext protocol
+--    over "network=tcp" or "network=udp". "application_segment=N" and
+--    "instance_segment=N" take the application and instance from path
+--    segments
+--  * influxin(address, options...) accepts the influx line protocol, taking
+--    the application and instance from the "application" and "instance" tags
+--    by default
+--  * textfilein(path) reads the "application instance key value" lines
+--    written by a fileout metric destination, until the end of the file
+--  * textin(address) accepts the lines sent by a udpout metric destination,
+--    which allows chaining statreceivers after parsing. "network=tcp" listens
+--    on tcp instead
+--  * forwardin(address) accepts metrics from the forward destination of
+--    another statreceiver
 source = udpin("localhost:9000")
 
 -- multiple metric destination types
---  * graphite(address) goes to tcp with the graphite wire protocol
+--  * graphite(address, options...) goes to tcp with the graphite wire protocol.
+--    options are "protocol=pickle", "template={application}.{key}",
+--    "tagged=true" for graphite 1.1 tagged series from v3 keys, and "buffer=N"
+--  * influx(url) goes to an influx write endpoint
+--  * influxmulti(mode, url...) goes to several influx write endpoints, where
+--    mode is "replicate", "failover" or "shard"
 --  * print() goes to stdout
 --  * db("sqlite3", path) goes to sqlite
 --  * db("postgres", connstring) goes to postgres
+--    db takes options "batch=N", "interval=5s", "history=true" and
+--    "retention=720h"
+--  * pgcopy(connstring, options...) streams every metric into a time
+--    partitioned postgres (or timescaledb) table
+--  * otlp(endpoint, options...) exports to an opentelemetry collector, over
+--    http by default or grpc with "protocol=grpc"
+--  * forward(address, options...) sends metrics with their timestamps to the
+--    forwardin source of another statreceiver over tcp, resending batches
+--    that were not acknowledged. options are "batch=N", "interval=1s",
+--    "timeout=10s" and "compression=none"
 graphite_out = graphite("localhost:5555")
 db_out = mcopy(
   db("sqlite3", "db.db"),
@@ -31,12 +83,34 @@ metric_handlers = mcopy(
   appfilter("uplink-prod",
     print()))
 
+-- luafilter(fn, dest) passes the metrics for which
+-- fn(application, instance, key, value, ts) returns true, with ts in seconds.
+-- luamap(fn, dest) sends what fn returns instead: true for the metric itself,
+-- or tables with the fields application, instance, key, value and ts to
+-- change, also as a list like {{key = "a"}, {key = "b"}}. fn runs in separate lua states, so it can use the standard
+-- libraries (without patterns like string.match) and locals holding strings,
+-- numbers or tables of them, but no globals or other values of this script.
+local renames = {count = "total"}
+metric_handlers = luamap(function(application, instance, key, value, ts)
+  local space = key:find(" ", 1, true)
+  if space == nil then
+    return true
+  end
+  local field = key:sub(space + 1)
+  return {key = key:sub(1, space) .. (renames[field] or field)}
+end, metric_handlers)
+
 -- create a metric parser.
 metric_parser =
   parse(sanitize(metric_handlers)) -- sanitize converts weird chars to underscores
 
 -- pcopy forks data to multiple outputs
 -- output types include parse, fileout, packetfilter, and udpout
+-- fileout(path, options...) takes "rotate_size=256MB", "rotate_interval=1h",
+-- "compression=zstd" or "compression=gzip", "flush=1s" and "keep=N"
+-- udpout takes "envelope=true" to keep timestamps when forwarding to another
+-- statreceiver, and "sender=NAME" to record who forwarded the packets instead
+-- of the address they were received from
 destination = pcopy(
   fileout("dump.out"),
   metric_parser,
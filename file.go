@@ -5,62 +5,376 @@ package statreceiver
 
 import (
 	"bufio"
+	"compress/gzip"
 	"encoding/gob"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver/capture"
 )
 
-// FileSource reads packets from a file.
+// FileSource reads packets from a file. The path may also be a directory or a
+// glob pattern, in which case all matching files are read in name order,
+// which is the order rotated FileDest captures were written in. Compressed
+// captures are detected and decompressed, and captures written before the
+// capture format was introduced are still read.
+//
+// By default packets are read as fast as possible. For replaying, packets can
+// be paced by their recorded timestamps, have their timestamps shifted to the
+// time of replay and be restricted to a time range.
 type FileSource struct {
-	path string
+	path  string
+	speed float64
+	shift bool
+	from  time.Time
+	until time.Time
+	clock Clock
 
-	mu      sync.Mutex
-	decoder *gob.Decoder
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	resolved  bool
+	files     []string
+	current   io.Closer
+	name      string
+	reader    packetReader
+	started   bool
+	firstTS   time.Time
+	wallStart time.Time
 }
 
-// NewFileSource creates a FileSource.
-func NewFileSource(path string) *FileSource {
-	return &FileSource{path: path}
+// NewFileSource creates a FileSource. The following options are supported:
+//
+//   - speed=F paces packets by their timestamps, F times faster than they
+//     were recorded, so speed=1 replays in real time (default 0, as fast as
+//     possible).
+//   - shift=true moves timestamps to the time of replay. When paced, packets
+//     get the time they are delivered at, otherwise all timestamps are moved
+//     by the same offset.
+//   - from=T skips packets recorded before the RFC 3339 time T.
+//   - until=T stops at the first packet recorded at or after T.
+func NewFileSource(path string, opts ...string) (*FileSource, error) {
+	o := parseOptions(opts)
+	speed := o.Float("speed", 0)
+	shift := o.Bool("shift", false)
+	from := o.Time("from", time.Time{})
+	until := o.Time("until", time.Time{})
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	if speed < 0 {
+		return nil, errs.New("invalid replay speed %v", speed)
+	}
+
+	return &FileSource{
+		path:    path,
+		speed:   speed,
+		shift:   shift,
+		from:    from,
+		until:   until,
+		clock:   currentClock(),
+		closing: make(chan struct{}),
+	}, nil
 }
 
 var _ Source = (*FileSource)(nil)
 
-// Next implements the Source interface.
+// Next implements the Source interface. It returns io.EOF after the last
+// file, or the end of the time range.
 func (f *FileSource) Next() ([]byte, time.Time, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if f.decoder == nil {
-		file, err := os.Open(f.path)
+
+	for {
+		data, ts, err := f.next()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if !f.from.IsZero() && ts.Before(f.from) {
+			continue
+		}
+		if !f.until.IsZero() && !ts.Before(f.until) {
+			f.files = nil
+			if err := f.closeCurrent(); err != nil {
+				return nil, time.Time{}, err
+			}
+			return nil, time.Time{}, io.EOF
+		}
+		return f.replay(data, ts)
+	}
+}
+
+// replay paces and shifts a packet.
+func (f *FileSource) replay(data []byte, ts time.Time) ([]byte, time.Time, error) {
+	if !f.started {
+		f.started = true
+		f.firstTS, f.wallStart = ts, f.clock.Now()
+	}
+
+	if f.speed > 0 {
+		at := f.wallStart.Add(time.Duration(float64(ts.Sub(f.firstTS)) / f.speed))
+		if wait := at.Sub(f.clock.Now()); wait > 0 {
+			select {
+			case <-f.clock.After(wait):
+			case <-f.closing:
+				return nil, time.Time{}, io.EOF
+			}
+		}
+		if f.shift {
+			ts = at
+		}
+	} else if f.shift {
+		ts = ts.Add(f.wallStart.Sub(f.firstTS))
+	}
+	return data, ts, nil
+}
+
+// next returns the next packet of the files.
+func (f *FileSource) next() ([]byte, time.Time, error) {
+	if !f.resolved {
+		files, err := captureFiles(f.path)
 		if err != nil {
 			return nil, time.Time{}, err
 		}
-		f.decoder = gob.NewDecoder(bufio.NewReader(file))
+		f.files, f.resolved = files, true
 	}
 
+	for {
+		if f.reader == nil {
+			if len(f.files) == 0 {
+				return nil, time.Time{}, io.EOF
+			}
+			name := f.files[0]
+			r, closer, err := openCapture(name)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			f.files = f.files[1:]
+			f.current, f.name = closer, name
+			f.reader, err = newPacketReader(r)
+			if err != nil {
+				return nil, time.Time{}, errs.Combine(err, f.closeCurrent())
+			}
+		}
+
+		data, ts, err := f.reader.next()
+		if err == nil {
+			return data, ts, nil
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, time.Time{}, err
+		}
+		if err == io.ErrUnexpectedEOF {
+			log.Printf("capture %s ends with a partial packet, skipping the rest", f.name)
+		}
+		if r, ok := f.reader.(captureReader); ok && r.Corrupt() > 0 {
+			log.Printf("capture %s: skipped %d corrupt records (%d bytes)", f.name, r.Corrupt(), r.Skipped())
+		}
+		if err := f.closeCurrent(); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+}
+
+// Close closes the file being read and interrupts pacing.
+func (f *FileSource) Close() error {
+	f.closeOnce.Do(func() { close(f.closing) })
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.files = nil
+	return f.closeCurrent()
+}
+
+func (f *FileSource) closeCurrent() error {
+	var err error
+	if f.current != nil {
+		err = f.current.Close()
+	}
+	f.current, f.name, f.reader = nil, "", nil
+	return err
+}
+
+// packetReader reads the packets of a single capture file.
+type packetReader interface {
+	next() ([]byte, time.Time, error)
+}
+
+// newPacketReader detects whether r is a capture or an older gob encoded
+// file and returns a reader for it.
+func newPacketReader(r io.Reader) (packetReader, error) {
+	br := bufio.NewReader(r)
+	prefix, _ := br.Peek(len(capture.Magic))
+	if !capture.IsCapture(prefix) {
+		return gobReader{gob.NewDecoder(br)}, nil
+	}
+	cr, err := capture.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return captureReader{cr}, nil
+}
+
+type captureReader struct{ *capture.Reader }
+
+func (r captureReader) next() ([]byte, time.Time, error) {
+	rec, err := r.Next()
+	return rec.Data, rec.TS, err
+}
+
+type gobReader struct{ *gob.Decoder }
+
+func (r gobReader) next() ([]byte, time.Time, error) {
 	var p Packet
-	err := f.decoder.Decode(&p)
+	err := r.Decode(&p)
+	return p.Data, p.TS, err
+}
+
+// captureFiles returns the files path refers to: the matches of a glob
+// pattern, the files in a directory or the path itself, sorted by name.
+func captureFiles(path string) ([]string, error) {
+	var files []string
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errs.New("no files match %q", path)
+		}
+		files = matches
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return []string{path}, nil
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// openCapture opens a capture file, decompressing it if it starts with a
+// gzip or zstd header.
+func openCapture(path string) (io.Reader, io.Closer, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil, time.Time{}, err
+		return nil, nil, err
 	}
-	return p.Data, p.TS, nil
+	r := bufio.NewReader(file)
+	magic, _ := r.Peek(4)
+
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			_ = file.Close()
+			return nil, nil, err
+		}
+		return gz, closerfunc(func() error { return errs.Combine(gz.Close(), file.Close()) }), nil
+	case len(magic) == 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			_ = file.Close()
+			return nil, nil, err
+		}
+		return zr, closerfunc(func() error { zr.Close(); return file.Close() }), nil
+	}
+	return r, file, nil
 }
 
 // FileDest sends packets to a file for later processing. FileDest preserves
-// the timestamps.
+// the timestamps. Packets are written in the format of the capture package.
+//
+// Captures can be rotated by size or age into files named after the path
+// with the time they were started, like capture-20200102T150405.000000000.cap
+// for capture.cap, and compressed. Buffered data is flushed periodically and
+// on Close.
 type FileDest struct {
-	path string
+	path           string
+	rotateSize     int64
+	rotateInterval time.Duration
+	compression    string
+	keep           int
 
 	mu      sync.Mutex
-	file    io.WriteCloser
-	encoder *gob.Encoder
+	file    *os.File
+	comp    io.WriteCloser
+	buf     *bufio.Writer
+	written int64
+	opened  time.Time
+	writer  *capture.Writer
+	closed  bool
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
 }
 
-// NewFileDest creates a FileDest.
-func NewFileDest(path string) *FileDest {
-	return &FileDest{path: path}
+// NewFileDest creates a FileDest. The following options are supported:
+//
+//   - rotate_size=SIZE starts a new file once SIZE uncompressed bytes were
+//     written, like "256MB" (default no rotation by size).
+//   - rotate_interval=D starts a new file every D (default no rotation by
+//     time).
+//   - compression=none|gzip|zstd compresses files, adding .gz or .zst to the
+//     names (default none).
+//   - flush=D writes buffered data to the file every D (default 1s).
+//   - keep=N removes the oldest rotated files beyond N (default keep all).
+//
+// Without rotation, the file at path is overwritten.
+func NewFileDest(path string, opts ...string) (*FileDest, error) {
+	o := parseOptions(opts)
+	rotateSize := o.Size("rotate_size", 0)
+	rotateInterval := o.Duration("rotate_interval", 0)
+	compression := o.String("compression", "none")
+	flush := o.Duration("flush", time.Second)
+	keep := o.Int("keep", 0)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	switch compression {
+	case "none", "gzip", "zstd":
+	default:
+		return nil, errs.New("file compression %q not supported", compression)
+	}
+
+	f := &FileDest{
+		path:           path,
+		rotateSize:     rotateSize.Int64(),
+		rotateInterval: rotateInterval,
+		compression:    compression,
+		keep:           keep,
+		stop:           make(chan struct{}),
+	}
+	if flush > 0 {
+		f.stopped.Add(1)
+		go f.flushLoop(flush)
+	}
+	return f, nil
 }
 
 var _ PacketDest = (*FileDest)(nil)
@@ -70,16 +384,14 @@ func (f *FileDest) Packet(data []byte, ts time.Time) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if f.encoder == nil {
-		file, err := os.Create(f.path)
-		if err != nil {
-			return err
-		}
-		f.file = file
-		f.encoder = gob.NewEncoder(bufio.NewWriter(file))
+	if err := f.prepare(); err != nil {
+		return err
+	}
+	if f.writer == nil {
+		f.writer = capture.NewWriter(fileDestWriter{f})
 	}
 
-	return f.encoder.Encode(Packet{Data: data, TS: ts})
+	return f.writer.Write(ts, data)
 }
 
 // Metric implements MetricDest.
@@ -87,14 +399,183 @@ func (f *FileDest) Metric(application, instance string, key []byte, val float64,
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	if err := f.prepare(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(fileDestWriter{f}, "%s %s %s %v\n", application, instance, string(key), val)
+	return err
+}
+
+// fileDestWriter counts and buffers data for the current file of a
+// FileDest. It must be used with the mutex held.
+type fileDestWriter struct{ f *FileDest }
+
+func (w fileDestWriter) Write(p []byte) (int, error) {
+	n, err := w.f.buf.Write(p)
+	w.f.written += int64(n)
+	return n, err
+}
+
+// Flush writes buffered data to the file.
+func (f *FileDest) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.flush()
+}
+
+// Close flushes and closes the current file. Later packets and metrics fail.
+func (f *FileDest) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	f.mu.Unlock()
+
+	close(f.stop)
+	f.stopped.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closeFile()
+}
+
+func (f *FileDest) flushLoop(interval time.Duration) {
+	defer f.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := f.Flush(); err != nil {
+			log.Printf("failed flushing %s: %v", f.path, err)
+		}
+	}
+}
+
+// prepare makes sure a file is open, rotating it if needed.
+func (f *FileDest) prepare() error {
+	if f.closed {
+		return errs.New("file destination %s closed", f.path)
+	}
+	if f.file != nil && f.shouldRotate() {
+		if err := f.closeFile(); err != nil {
+			log.Printf("failed closing %s: %v", f.file.Name(), err)
+		}
+	}
 	if f.file == nil {
-		file, err := os.Create(f.path)
+		return f.openFile()
+	}
+	return nil
+}
+
+func (f *FileDest) shouldRotate() bool {
+	return (f.rotateSize > 0 && f.written >= f.rotateSize) ||
+		(f.rotateInterval > 0 && time.Since(f.opened) >= f.rotateInterval)
+}
+
+func (f *FileDest) rotating() bool {
+	return f.rotateSize > 0 || f.rotateInterval > 0
+}
+
+func (f *FileDest) openFile() error {
+	now := time.Now()
+	if !now.After(f.opened) {
+		// keep names unique and ordered even with a coarse clock.
+		now = f.opened.Add(time.Nanosecond)
+	}
+	file, err := os.Create(f.fileName(now.UTC().Format("20060102T150405.000000000")))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = file
+	switch f.compression {
+	case "gzip":
+		f.comp = gzip.NewWriter(file)
+		w = f.comp
+	case "zstd":
+		enc, err := zstd.NewWriter(file)
 		if err != nil {
-			return err
+			return errs.Combine(err, file.Close())
 		}
-		f.file = file
+		f.comp = enc
+		w = enc
 	}
 
-	_, err := fmt.Fprintf(f.file, "%s %s %s %v\n", application, instance, string(key), val)
+	f.file = file
+	f.buf = bufio.NewWriter(w)
+	f.written = 0
+	f.opened = now
+	f.writer = nil
+
+	if f.rotating() && f.keep > 0 {
+		f.removeOld()
+	}
+	return nil
+}
+
+// fileName returns the name of a file started at stamp. The compression
+// suffix is added unless the path already has it.
+func (f *FileDest) fileName(stamp string) string {
+	suffix := map[string]string{"gzip": ".gz", "zstd": ".zst"}[f.compression]
+	name := strings.TrimSuffix(f.path, suffix)
+	if f.rotating() {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "-" + stamp + ext
+	}
+	return name + suffix
+}
+
+// removeOld removes the oldest rotated files beyond the retention limit.
+func (f *FileDest) removeOld() {
+	files, err := filepath.Glob(f.fileName("*"))
+	if err != nil {
+		log.Printf("failed listing captures of %s: %v", f.path, err)
+		return
+	}
+	sort.Strings(files)
+	for len(files) > f.keep {
+		if err := os.Remove(files[0]); err != nil {
+			log.Printf("failed removing old capture: %v", err)
+		}
+		files = files[1:]
+	}
+}
+
+func (f *FileDest) flush() error {
+	if f.file == nil {
+		return nil
+	}
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	switch comp := f.comp.(type) {
+	case *gzip.Writer:
+		return comp.Flush()
+	case *zstd.Encoder:
+		return comp.Flush()
+	}
+	return nil
+}
+
+func (f *FileDest) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.buf.Flush()
+	if f.comp != nil {
+		err = errs.Combine(err, f.comp.Close())
+	}
+	err = errs.Combine(err, f.file.Close())
+	f.file, f.comp, f.buf, f.writer = nil, nil, nil, nil
 	return err
 }
@@ -0,0 +1,198 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"encoding/gob"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestFileDest_Rotate(t *testing.T) {
+	for _, compression := range []string{"none", "gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			dest, err := statreceiver.NewFileDest(filepath.Join(dir, "capture.cap"),
+				"rotate_size=1KB", "compression="+compression, "keep=3")
+			require.NoError(t, err)
+
+			ts := time.Unix(1600000000, 0)
+			for i := 0; i < 100; i++ {
+				data := make([]byte, 40)
+				data[0] = byte(i)
+				require.NoError(t, dest.Packet(data, ts.Add(time.Duration(i))))
+			}
+			require.NoError(t, dest.Close())
+			require.Error(t, dest.Packet([]byte{1}, ts))
+
+			files, err := filepath.Glob(filepath.Join(dir, "capture-*"))
+			require.NoError(t, err)
+			require.Len(t, files, 3)
+
+			// the kept files hold the last packets, in order.
+			source, err := statreceiver.NewFileSource(dir)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, source.Close()) }()
+
+			var last byte
+			count := 0
+			for {
+				data, got, err := source.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				require.Equal(t, ts.Add(time.Duration(data[0])).UnixNano(), got.UnixNano())
+				if count > 0 {
+					require.Equal(t, last+1, data[0])
+				}
+				last = data[0]
+				count++
+			}
+			require.Equal(t, byte(99), last)
+			require.True(t, count > 0 && count < 100)
+		})
+	}
+}
+
+func TestFileSource_Glob(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Unix(1600000000, 0)
+
+	for i, name := range []string{"b.cap", "a.cap"} {
+		dest, err := statreceiver.NewFileDest(filepath.Join(dir, name), "compression=gzip")
+		require.NoError(t, err)
+		require.NoError(t, dest.Packet([]byte{byte(i)}, ts))
+		require.NoError(t, dest.Close())
+	}
+
+	source, err := statreceiver.NewFileSource(filepath.Join(dir, "*.cap.gz"))
+	require.NoError(t, err)
+	for _, expected := range []byte{1, 0} {
+		data, _, err := source.Next()
+		require.NoError(t, err)
+		require.Equal(t, []byte{expected}, data)
+	}
+	_, _, err = source.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestFileSource_Gob(t *testing.T) {
+	// captures written before the capture format are gob encoded packets.
+	path := filepath.Join(t.TempDir(), "old.gob")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 0)
+	enc := gob.NewEncoder(file)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, enc.Encode(statreceiver.Packet{Data: []byte{byte(i)}, TS: ts}))
+	}
+	require.NoError(t, file.Close())
+
+	source, err := statreceiver.NewFileSource(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+	for i := 0; i < 3; i++ {
+		data, got, err := source.Next()
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(i)}, data)
+		require.True(t, ts.Equal(got))
+	}
+	_, _, err = source.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestFileSource_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.cap")
+	dest, err := statreceiver.NewFileDest(path)
+	require.NoError(t, err)
+	start := time.Unix(1600000000, 0)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, dest.Packet([]byte{byte(i)}, start.Add(time.Duration(i)*100*time.Millisecond)))
+	}
+	require.NoError(t, dest.Close())
+
+	// packets 2 to 5 span 300ms, which takes 150ms at twice the speed.
+	source, err := statreceiver.NewFileSource(path, "speed=2", "shift=true",
+		"from="+start.Add(200*time.Millisecond).Format(time.RFC3339Nano),
+		"until="+start.Add(600*time.Millisecond).Format(time.RFC3339Nano))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	began := time.Now()
+	var first time.Time
+	for i := 2; i < 6; i++ {
+		data, ts, err := source.Next()
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(i)}, data)
+		if i == 2 {
+			first = ts
+			require.WithinDuration(t, began, ts, time.Second)
+		} else {
+			require.Equal(t, time.Duration(i-2)*50*time.Millisecond, ts.Sub(first))
+		}
+	}
+	_, _, err = source.Next()
+	require.Equal(t, io.EOF, err)
+	require.True(t, time.Since(began) >= 150*time.Millisecond)
+}
+
+func TestFileSource_ReplayClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.cap")
+	dest, err := statreceiver.NewFileDest(path)
+	require.NoError(t, err)
+	start := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Packet([]byte{0}, start))
+	require.NoError(t, dest.Packet([]byte{1}, start.Add(time.Hour)))
+	require.NoError(t, dest.Close())
+
+	clock := statreceivertest.NewClock(time.Unix(1700000000, 0))
+	defer statreceiver.SetClock(clock)()
+	source, err := statreceiver.NewFileSource(path, "speed=1", "shift=true")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	_, ts, err := source.Next()
+	require.NoError(t, err)
+	require.Equal(t, clock.Now(), ts)
+
+	// the second packet waits for an hour of the clock.
+	next := make(chan time.Time, 1)
+	go func() {
+		_, ts, err := source.Next()
+		require.NoError(t, err)
+		next <- ts
+	}()
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(30 * time.Minute)
+	require.Equal(t, 1, clock.Waiters())
+	require.Len(t, next, 0)
+	now := clock.Advance(30 * time.Minute)
+	require.Equal(t, now, <-next)
+}
+
+func TestDeliver_EOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.cap")
+	dest, err := statreceiver.NewFileDest(path)
+	require.NoError(t, err)
+	require.NoError(t, dest.Packet([]byte{1}, time.Now()))
+	require.NoError(t, dest.Close())
+
+	source, err := statreceiver.NewFileSource(path)
+	require.NoError(t, err)
+	delivery := statreceiver.Deliver(source, statreceiver.NewPacketCopier())
+	select {
+	case <-delivery.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("delivery did not stop at the end of the file")
+	}
+}
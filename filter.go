@@ -4,7 +4,6 @@
 package statreceiver
 
 import (
-	"log"
 	"os"
 	"regexp"
 	"strings"
@@ -12,6 +11,7 @@ import (
 	"time"
 
 	"github.com/zeebo/admission/v3/admproto"
+	"github.com/zeebo/errs"
 
 	"storj.io/common/memory"
 )
@@ -29,10 +29,18 @@ type PacketFilter struct {
 // NewPacketFilter creates a PacketFilter. It takes a packet destination,
 // an application regular expression, and an instance regular expression.
 // If the regular expression is matched, the packet will be passed through.
-func NewPacketFilter(applicationRegex, instanceRegex string, headerMatcher HeaderMatcher, dest PacketDest) *PacketFilter {
+func NewPacketFilter(applicationRegex, instanceRegex string, headerMatcher HeaderMatcher, dest PacketDest) (*PacketFilter, error) {
+	application, err := regexp.Compile(applicationRegex)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := regexp.Compile(instanceRegex)
+	if err != nil {
+		return nil, err
+	}
 	return &PacketFilter{
-		application:   regexp.MustCompile(applicationRegex),
-		instance:      regexp.MustCompile(instanceRegex),
+		application:   application,
+		instance:      instance,
 		headerMatcher: headerMatcher,
 		dest:          dest,
 		scratch: sync.Pool{
@@ -41,13 +49,18 @@ func NewPacketFilter(applicationRegex, instanceRegex string, headerMatcher Heade
 				return &x
 			},
 		},
-	}
+	}, nil
 }
 
-var _ PacketDest = (*PacketFilter)(nil)
+var _ SenderPacketDest = (*PacketFilter)(nil)
 
 // Packet passes the packet along to the given destination if the regexes pass.
 func (a *PacketFilter) Packet(data []byte, ts time.Time) error {
+	return a.PacketFrom(data, ts, "")
+}
+
+// PacketFrom implements the SenderPacketDest interface, like Packet.
+func (a *PacketFilter) PacketFrom(data []byte, ts time.Time, sender string) error {
 	cdata, err := admproto.CheckChecksum(data)
 	if err != nil {
 		return err
@@ -64,7 +77,7 @@ func (a *PacketFilter) Packet(data []byte, ts time.Time) error {
 
 		// No headerMatcher? Dispatch to destination now.
 		if a.headerMatcher == nil {
-			return a.dest.Packet(data, ts)
+			return sendPacket(a.dest, data, ts, sender)
 		}
 
 		// We have a headerMatcher, check each header and return on the first match.
@@ -75,7 +88,7 @@ func (a *PacketFilter) Packet(data []byte, ts time.Time) error {
 				return err
 			}
 			if a.headerMatcher.Match(key, val) {
-				return a.dest.Packet(data, ts)
+				return sendPacket(a.dest, data, ts, sender)
 			}
 		}
 	}
@@ -127,14 +140,14 @@ type FilterFile struct {
 }
 
 // NewPatternFile creates a new FilterFile.
-func NewPatternFile(fileName string, dest MetricDest) *FilterFile {
+func NewPatternFile(fileName string, dest MetricDest) (*FilterFile, error) {
 	pf := &FilterFile{
 		patterns: make([]*regexp.Regexp, 0),
 		dest:     dest,
 	}
 	raw, err := os.ReadFile(fileName)
 	if err != nil {
-		log.Fatalf("Couldn't read file %s: %v", fileName, err)
+		return nil, err
 	}
 
 	for _, line := range strings.Split(string(raw), "\n") {
@@ -142,9 +155,13 @@ func NewPatternFile(fileName string, dest MetricDest) *FilterFile {
 		if line == "" {
 			continue
 		}
-		pf.patterns = append(pf.patterns, regexp.MustCompile(line))
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, errs.New("%s: %v", fileName, err)
+		}
+		pf.patterns = append(pf.patterns, pattern)
 	}
-	return pf
+	return pf, nil
 }
 
 // Metric implements MetricDest.
@@ -166,11 +183,15 @@ type KeyFilter struct {
 
 // NewKeyFilter creates a KeyFilter. pattern is the regular expression that must
 // match, and dest is the MetricDest to send matching metrics to.
-func NewKeyFilter(pattern string, dest MetricDest) *KeyFilter {
+func NewKeyFilter(pattern string, dest MetricDest) (*KeyFilter, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
 	return &KeyFilter{
-		pattern: regexp.MustCompile(pattern),
+		pattern: compiled,
 		dest:    dest,
-	}
+	}, nil
 }
 
 var _ MetricDest = (*KeyFilter)(nil)
@@ -193,11 +214,15 @@ type ApplicationFilter struct {
 // NewApplicationFilter creates an ApplicationFilter. pattern is the regular
 // expression that must match, and dest is the MetricDest to send matching metrics
 // to.
-func NewApplicationFilter(regex string, dest MetricDest) *ApplicationFilter {
+func NewApplicationFilter(regex string, dest MetricDest) (*ApplicationFilter, error) {
+	pattern, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
 	return &ApplicationFilter{
-		pattern: regexp.MustCompile(regex),
+		pattern: pattern,
 		dest:    dest,
-	}
+	}, nil
 }
 
 var _ MetricDest = (*ApplicationFilter)(nil)
@@ -220,11 +245,15 @@ type InstanceFilter struct {
 // NewInstanceFilter creates an InstanceFilter. pattern is the regular
 // expression that must match, and dest is the MetricDest to send matching metrics
 // to.
-func NewInstanceFilter(regex string, dest MetricDest) *InstanceFilter {
+func NewInstanceFilter(regex string, dest MetricDest) (*InstanceFilter, error) {
+	pattern, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
 	return &InstanceFilter{
-		pattern: regexp.MustCompile(regex),
+		pattern: pattern,
 		dest:    dest,
-	}
+	}, nil
 }
 
 var _ MetricDest = (*InstanceFilter)(nil)
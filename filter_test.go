@@ -0,0 +1,145 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestPacketFilter(t *testing.T) {
+	packet := statreceivertest.EncodePacket("satellite", "sat-1", map[string]string{"region": "eu"},
+		statreceivertest.Value{Key: "a value", Val: 1})
+
+	for _, tt := range []struct {
+		name        string
+		application string
+		instance    string
+		matcher     statreceiver.HeaderMatcher
+		pass        bool
+	}{
+		{name: "match all", pass: true},
+		{name: "application", application: "^sat", pass: true},
+		{name: "other application", application: "^storagenode$"},
+		{name: "instance", instance: "-1$", pass: true},
+		{name: "other instance", instance: "-2$"},
+		{name: "header", matcher: statreceiver.NewHeaderMultiValMatcher("region", "us", "eu"), pass: true},
+		{name: "other header value", matcher: statreceiver.NewHeaderMultiValMatcher("region", "us")},
+		{name: "missing header", matcher: statreceiver.NewHeaderMultiValMatcher("zone", "eu")},
+		{name: "application and header", application: "^storagenode$", matcher: statreceiver.NewHeaderMultiValMatcher("region", "eu")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := statreceivertest.NewPacketRecorder()
+			filter, err := statreceiver.NewPacketFilter(tt.application, tt.instance, tt.matcher, dest)
+			require.NoError(t, err)
+			require.NoError(t, filter.Packet(packet, time.Now()))
+			if tt.pass {
+				require.Equal(t, packet, dest.Packets()[0].Data)
+			} else {
+				dest.RequireCount(t, 0)
+			}
+		})
+	}
+
+	dest := statreceivertest.NewPacketRecorder()
+	corrupt := append([]byte(nil), packet...)
+	corrupt[len(corrupt)-1]++
+	filter, err := statreceiver.NewPacketFilter("", "", nil, dest)
+	require.NoError(t, err)
+	require.Error(t, filter.Packet(corrupt, time.Now()))
+	dest.RequireCount(t, 0)
+
+	_, err = statreceiver.NewPacketFilter("(", "", nil, dest)
+	require.Error(t, err)
+}
+
+func TestMetricFilters(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	metrics := []statreceiver.Metric{
+		{Application: "satellite", Instance: "sat-1", Key: []byte("db,scope=x count"), Val: 1, TS: ts},
+		{Application: "satellite", Instance: "sat-2", Key: []byte("http,scope=x count"), Val: 2, TS: ts},
+		{Application: "storagenode", Instance: "node-1", Key: []byte("db,scope=x count"), Val: 3, TS: ts},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		filter func(dest statreceiver.MetricDest) (statreceiver.MetricDest, error)
+		vals   []float64
+	}{
+		{
+			name: "key",
+			filter: func(dest statreceiver.MetricDest) (statreceiver.MetricDest, error) {
+				return statreceiver.NewKeyFilter("^db,", dest)
+			},
+			vals: []float64{1, 3},
+		},
+		{
+			name: "application",
+			filter: func(dest statreceiver.MetricDest) (statreceiver.MetricDest, error) {
+				return statreceiver.NewApplicationFilter("^satellite$", dest)
+			},
+			vals: []float64{1, 2},
+		},
+		{
+			name: "instance",
+			filter: func(dest statreceiver.MetricDest) (statreceiver.MetricDest, error) {
+				return statreceiver.NewInstanceFilter("-1$", dest)
+			},
+			vals: []float64{1, 3},
+		},
+		{
+			name: "zero instance if",
+			filter: func(dest statreceiver.MetricDest) (statreceiver.MetricDest, error) {
+				filter, err := statreceiver.NewInstanceFilter("^$", dest)
+				if err != nil {
+					return nil, err
+				}
+				return statreceiver.NewInstanceZeroerIf("^storagenode$", filter)
+			},
+			vals: []float64{3},
+		},
+		{
+			name: "zero instance if not",
+			filter: func(dest statreceiver.MetricDest) (statreceiver.MetricDest, error) {
+				filter, err := statreceiver.NewInstanceFilter("^$", dest)
+				if err != nil {
+					return nil, err
+				}
+				return statreceiver.NewInstanceZeroerIfNot("^storagenode$", filter)
+			},
+			vals: []float64{1, 2},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := statreceivertest.NewMetricRecorder()
+			filter, err := tt.filter(dest)
+			require.NoError(t, err)
+			for _, m := range metrics {
+				require.NoError(t, filter.Metric(m.Application, m.Instance, m.Key, m.Val, m.TS))
+			}
+			var vals []float64
+			for _, m := range dest.Metrics() {
+				vals = append(vals, m.Val)
+			}
+			require.Equal(t, tt.vals, vals)
+		})
+	}
+}
+
+func TestMetricFilters_InvalidPattern(t *testing.T) {
+	dest := statreceivertest.NewMetricRecorder()
+	_, err := statreceiver.NewKeyFilter("[", dest)
+	require.Error(t, err)
+	_, err = statreceiver.NewApplicationFilter("[", dest)
+	require.Error(t, err)
+	_, err = statreceiver.NewInstanceFilter("[", dest)
+	require.Error(t, err)
+	_, err = statreceiver.NewInstanceZeroerIf("[", dest)
+	require.Error(t, err)
+}
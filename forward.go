@@ -0,0 +1,613 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/common/sync2"
+)
+
+// The forwarding protocol carries metrics between statreceivers over TCP.
+//
+// A connection starts with the client sending the magic "SRFW", a version
+// byte and an 8 byte session id, which stays the same for the lifetime of a
+// ForwardDest. The server answers with the magic and its version.
+//
+// The client then sends frames, each a big endian uint32 length followed by
+// that many bytes: a uint64 sequence number, an encoding byte (0 for raw, 1
+// for deflate) and the encoded batch. A batch is a uvarint count followed by,
+// per metric, the uvarint length prefixed application, instance and key, the
+// value as big endian float64 bits and the timestamp as varint unix
+// nanoseconds.
+//
+// The server acknowledges every frame, once its metrics are queued, by
+// sending back the uint64 sequence number. Frames that are resent after a
+// lost acknowledgement are recognized by session and sequence number and
+// acknowledged without being delivered twice.
+const (
+	forwardMagic   = "SRFW"
+	forwardVersion = 1
+
+	forwardRaw     = 0
+	forwardDeflate = 1
+
+	// forwardMaxFrame limits frames and the batches they decompress into,
+	// so a small frame can't inflate into gigabytes.
+	forwardMaxFrame = 64 << 20
+
+	// forwardMaxUnacked is the number of frames a ForwardDest keeps for
+	// resending. Beyond that, the oldest are dropped.
+	forwardMaxUnacked = 100
+)
+
+// ForwardError is the class of forwarding protocol errors.
+var ForwardError = errs.Class("forward")
+
+// ForwardDest is a MetricDest that sends metrics to a ForwardSource of
+// another statreceiver, keeping timestamps. Batches that are not
+// acknowledged are kept and resent after reconnecting.
+type ForwardDest struct {
+	*metricBatcher
+
+	address  string
+	timeout  time.Duration
+	compress bool
+	session  [8]byte
+
+	mu      sync.Mutex
+	conn    net.Conn
+	seq     uint64
+	unacked []forwardFrame
+}
+
+// forwardFrame is an encoded frame that was not acknowledged yet.
+type forwardFrame struct {
+	seq   uint64
+	data  []byte
+	count int
+}
+
+// NewForwardDest creates a ForwardDest sending to address. The following
+// options are supported:
+//
+//   - batch=N sends once N metrics are pending (default 1000).
+//   - interval=D sends at least every D (default 1s).
+//   - timeout=D limits connecting and waiting for acknowledgements (default
+//     10s).
+//   - compression=deflate|none selects the batch encoding (default deflate).
+func NewForwardDest(address string, opts ...string) (*ForwardDest, error) {
+	o := parseOptions(opts)
+	batch := o.Int("batch", 1000)
+	interval := o.Duration("interval", time.Second)
+	timeout := o.Duration("timeout", 10*time.Second)
+	compression := o.String("compression", "deflate")
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	if compression != "deflate" && compression != "none" {
+		return nil, ForwardError.New("compression %q not supported", compression)
+	}
+
+	rv := &ForwardDest{
+		address:  address,
+		timeout:  timeout,
+		compress: compression == "deflate",
+	}
+	if _, err := rand.Read(rv.session[:]); err != nil {
+		return nil, err
+	}
+	rv.metricBatcher = newMetricBatcher("forward", batch, interval, false, rv.send)
+	return rv, nil
+}
+
+var _ MetricDest = (*ForwardDest)(nil)
+
+// Metric implements MetricDest.
+func (d *ForwardDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	return d.add(application, instance, key, val, ts)
+}
+
+// Close sends pending metrics and closes the connection.
+func (d *ForwardDest) Close() error {
+	err := d.metricBatcher.close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn != nil {
+		err = errs.Combine(err, d.conn.Close())
+		d.conn = nil
+	}
+	return err
+}
+
+// send queues a batch as a frame behind the frames that were not
+// acknowledged yet, and sends them in order, each waiting for its
+// acknowledgement. A frame is resent with its original sequence number until
+// it is acknowledged, which lets the source recognize it if it was delivered
+// after all.
+func (d *ForwardDest) send(ctx context.Context, batch []Metric) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(batch) > 0 {
+		data, err := encodeForwardFrame(d.seq+1, batch, d.compress)
+		if err != nil {
+			return err
+		}
+		d.seq++
+		d.unacked = append(d.unacked, forwardFrame{seq: d.seq, data: data, count: len(batch)})
+		if len(d.unacked) > forwardMaxUnacked {
+			log.Printf("forward queue for %s is full, dropping %d metrics", d.address, d.unacked[0].count)
+			d.drop(d.unacked[0].count)
+			d.unacked[0] = forwardFrame{}
+			d.unacked = d.unacked[1:]
+		}
+	}
+
+	for len(d.unacked) > 0 {
+		frame := d.unacked[0]
+		if err := d.sendRetrying(ctx, frame.data, frame.seq); err != nil {
+			return err
+		}
+		d.unacked[0] = forwardFrame{}
+		d.unacked = d.unacked[1:]
+	}
+	return nil
+}
+
+// sendRetrying sends a frame, reconnecting and resending a few times on
+// failure.
+func (d *ForwardDest) sendRetrying(ctx context.Context, frame []byte, seq uint64) error {
+	const maxTries = 3
+	baseDelay := 100 * time.Millisecond
+
+	for iteration := 0; ; iteration++ {
+		err := d.sendFrame(frame, seq)
+		if err == nil {
+			return nil
+		}
+		if d.conn != nil {
+			_ = d.conn.Close()
+			d.conn = nil
+		}
+		if iteration+1 >= maxTries {
+			return err
+		}
+
+		delay := baseDelay << iteration
+		log.Printf("failed forwarding to %s: %v. Retrying %d/%d after %s", d.address, err, iteration+1, maxTries-1, delay)
+		if !sync2.Sleep(ctx, delay) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *ForwardDest) sendFrame(frame []byte, seq uint64) error {
+	if d.conn == nil {
+		conn, err := net.DialTimeout("tcp", d.address, d.timeout)
+		if err != nil {
+			return err
+		}
+		if err := d.handshake(conn); err != nil {
+			_ = conn.Close()
+			return err
+		}
+		d.conn = conn
+	}
+
+	if err := d.conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return err
+	}
+	if _, err := d.conn.Write(frame); err != nil {
+		return err
+	}
+
+	var ack [8]byte
+	if _, err := io.ReadFull(d.conn, ack[:]); err != nil {
+		return err
+	}
+	if got := binary.BigEndian.Uint64(ack[:]); got != seq {
+		return ForwardError.New("acknowledged sequence %d instead of %d", got, seq)
+	}
+	return nil
+}
+
+func (d *ForwardDest) handshake(conn net.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return err
+	}
+
+	hello := append([]byte(forwardMagic), forwardVersion)
+	hello = append(hello, d.session[:]...)
+	if _, err := conn.Write(hello); err != nil {
+		return err
+	}
+
+	var reply [len(forwardMagic) + 1]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if string(reply[:len(forwardMagic)]) != forwardMagic {
+		return ForwardError.New("%s is not a forward source", d.address)
+	}
+	if reply[len(forwardMagic)] != forwardVersion {
+		return ForwardError.New("unsupported version %d", reply[len(forwardMagic)])
+	}
+	return nil
+}
+
+// encodeForwardFrame encodes a batch as a length prefixed frame.
+func encodeForwardFrame(seq uint64, batch []Metric, compress bool) ([]byte, error) {
+	var body []byte
+	body = binary.AppendUvarint(body, uint64(len(batch)))
+	for _, m := range batch {
+		body = binary.AppendUvarint(body, uint64(len(m.Application)))
+		body = append(body, m.Application...)
+		body = binary.AppendUvarint(body, uint64(len(m.Instance)))
+		body = append(body, m.Instance...)
+		body = binary.AppendUvarint(body, uint64(len(m.Key)))
+		body = append(body, m.Key...)
+		body = binary.BigEndian.AppendUint64(body, math.Float64bits(m.Val))
+		body = binary.AppendVarint(body, m.TS.UnixNano())
+	}
+
+	if len(body) > forwardMaxFrame-9 {
+		return nil, ForwardError.New("batch of %d bytes too large, use a smaller batch", len(body))
+	}
+
+	encoding := byte(forwardRaw)
+	if compress {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		body, encoding = buf.Bytes(), forwardDeflate
+	}
+
+	frame := make([]byte, 4, 4+8+1+len(body))
+	binary.BigEndian.PutUint32(frame, uint32(8+1+len(body)))
+	frame = binary.BigEndian.AppendUint64(frame, seq)
+	frame = append(frame, encoding)
+	return append(frame, body...), nil
+}
+
+// decodeForwardFrame decodes the contents of a frame, without the length.
+func decodeForwardFrame(frame []byte) (seq uint64, batch []Metric, err error) {
+	if len(frame) < 9 {
+		return 0, nil, ForwardError.New("short frame")
+	}
+	seq = binary.BigEndian.Uint64(frame)
+	body := frame[9:]
+	switch frame[8] {
+	case forwardRaw:
+	case forwardDeflate:
+		body, err = ioutil.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(body)), forwardMaxFrame+1))
+		if err != nil {
+			return 0, nil, ForwardError.Wrap(err)
+		}
+		if len(body) > forwardMaxFrame {
+			return 0, nil, ForwardError.New("decompressed frame larger than %d bytes", forwardMaxFrame)
+		}
+	default:
+		return 0, nil, ForwardError.New("unknown encoding %d", frame[8])
+	}
+
+	d := forwardDecoder{body: body}
+	count := d.uvarint()
+	if count > uint64(len(d.body)) {
+		return 0, nil, ForwardError.New("truncated batch")
+	}
+	batch = make([]Metric, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		batch = append(batch, Metric{
+			Application: string(d.bytes()),
+			Instance:    string(d.bytes()),
+			Key:         append([]byte(nil), d.bytes()...),
+			Val:         math.Float64frombits(d.uint64()),
+			TS:          time.Unix(0, d.varint()),
+		})
+	}
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+	return seq, batch, nil
+}
+
+// forwardDecoder reads the fields of a batch, remembering the first error.
+type forwardDecoder struct {
+	body []byte
+	err  error
+}
+
+func (d *forwardDecoder) fail() {
+	if d.err == nil {
+		d.err = ForwardError.New("truncated batch")
+	}
+	d.body = nil
+}
+
+func (d *forwardDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.body)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.body = d.body[n:]
+	return v
+}
+
+func (d *forwardDecoder) varint() int64 {
+	v, n := binary.Varint(d.body)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.body = d.body[n:]
+	return v
+}
+
+func (d *forwardDecoder) uint64() uint64 {
+	if len(d.body) < 8 {
+		d.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.body)
+	d.body = d.body[8:]
+	return v
+}
+
+func (d *forwardDecoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.body)) {
+		d.fail()
+		return nil
+	}
+	v := d.body[:n]
+	d.body = d.body[n:]
+	return v
+}
+
+// ForwardSource is a MetricSource that accepts metrics sent by ForwardDest.
+type ForwardSource struct {
+	listener net.Listener
+	queue    *metricQueue
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	sessions map[[8]byte]*forwardSession
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// forwardSession remembers the last delivered frame of a ForwardDest, so
+// resent frames are not delivered twice.
+type forwardSession struct {
+	mu       sync.Mutex
+	seq      uint64
+	lastSeen time.Time
+	// conns is the number of open connections of the session, guarded by
+	// the mutex of the ForwardSource.
+	conns int
+}
+
+// NewForwardSource creates a ForwardSource listening on address.
+func NewForwardSource(address string) (*ForwardSource, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &ForwardSource{
+		listener: listener,
+		queue:    newMetricQueue("forward", 100),
+		conns:    map[net.Conn]struct{}{},
+		sessions: map[[8]byte]*forwardSession{},
+		stop:     make(chan struct{}),
+	}
+	rv.stopped.Add(1)
+	go rv.accept()
+	return rv, nil
+}
+
+var _ MetricSource = (*ForwardSource)(nil)
+
+// Addr returns the address the source is listening on.
+func (s *ForwardSource) Addr() net.Addr { return s.listener.Addr() }
+
+// NextMetric implements MetricSource.
+func (s *ForwardSource) NextMetric() (Metric, error) {
+	return s.queue.next()
+}
+
+// Close stops listening, closes open connections and makes NextMetric fail
+// once the queued metrics are consumed.
+func (s *ForwardSource) Close() error {
+	close(s.stop)
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.stopped.Wait()
+	s.queue.close()
+	return err
+}
+
+func (s *ForwardSource) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ForwardSource) accept() {
+	defer s.stopped.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.stopping() {
+				return
+			}
+			log.Printf("failed accepting forward connection: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopping() {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.stopped.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.stopped.Done()
+			err := s.serve(conn)
+			if err != nil && !s.stopping() {
+				log.Printf("forward connection from %s failed: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *ForwardSource) serve(conn net.Conn) error {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+
+	var hello [len(forwardMagic) + 1 + 8]byte
+	if _, err := io.ReadFull(r, hello[:]); err != nil {
+		return err
+	}
+	if string(hello[:len(forwardMagic)]) != forwardMagic {
+		return ForwardError.New("invalid magic")
+	}
+	if _, err := conn.Write(append([]byte(forwardMagic), forwardVersion)); err != nil {
+		return err
+	}
+	if hello[len(forwardMagic)] != forwardVersion {
+		return ForwardError.New("unsupported version %d", hello[len(forwardMagic)])
+	}
+	var id [8]byte
+	copy(id[:], hello[len(forwardMagic)+1:])
+	session := s.session(id)
+	defer s.release(session)
+
+	var frame []byte
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		n := binary.BigEndian.Uint32(length[:])
+		if n > forwardMaxFrame {
+			return ForwardError.New("frame of %d bytes too large", n)
+		}
+		if cap(frame) < int(n) {
+			frame = make([]byte, n)
+		}
+		frame = frame[:n]
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return err
+		}
+
+		seq, batch, err := decodeForwardFrame(frame)
+		if err != nil {
+			return err
+		}
+
+		session.mu.Lock()
+		if seq > session.seq {
+			if !s.queue.pushWait(batch, s.stop) {
+				session.mu.Unlock()
+				return nil
+			}
+			session.seq = seq
+		}
+		session.lastSeen = time.Now()
+		session.mu.Unlock()
+
+		var ack [8]byte
+		binary.BigEndian.PutUint64(ack[:], seq)
+		if _, err := conn.Write(ack[:]); err != nil {
+			return err
+		}
+	}
+}
+
+// session returns the state of a session for a new connection, forgetting
+// sessions without connections that sent no frame for a day. Call release
+// once the connection is closed.
+func (s *ForwardSource) session(id [8]byte) *forwardSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, session := range s.sessions {
+		session.mu.Lock()
+		idle := now.Sub(session.lastSeen)
+		session.mu.Unlock()
+		if session.conns == 0 && idle > 24*time.Hour {
+			delete(s.sessions, key)
+		}
+	}
+
+	session, ok := s.sessions[id]
+	if !ok {
+		session = new(forwardSession)
+		s.sessions[id] = session
+	}
+	session.mu.Lock()
+	session.lastSeen = now
+	session.mu.Unlock()
+	session.conns++
+	return session
+}
+
+// release marks a connection of session closed.
+func (s *ForwardSource) release(session *forwardSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.conns--
+}
@@ -0,0 +1,253 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForward(t *testing.T) {
+	source, err := NewForwardSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	dest, err := NewForwardDest(source.Addr().String(), "interval=1h")
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 123456789)
+	require.NoError(t, dest.Metric("app", "inst", []byte("function_times,name=a p50"), 1.5, ts))
+	require.NoError(t, dest.Metric("app", "", []byte("env.process.uptime"), 3, ts.Add(time.Second)))
+	require.NoError(t, dest.Flush())
+	require.NoError(t, dest.Close())
+
+	m, err := source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, Metric{Application: "app", Instance: "inst", Key: []byte("function_times,name=a p50"), Val: 1.5, TS: ts}, m)
+
+	m, err = source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, "env.process.uptime", string(m.Key))
+	require.True(t, ts.Add(time.Second).Equal(m.TS))
+}
+
+func TestForwardSource_Resend(t *testing.T) {
+	source, err := NewForwardSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	frame, err := encodeForwardFrame(1, []Metric{{Application: "app", Key: []byte("a"), Val: 1, TS: time.Now()}}, false)
+	require.NoError(t, err)
+	session := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// the same frame sent over two connections of the same session must be
+	// acknowledged twice but delivered once.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", source.Addr().String())
+		require.NoError(t, err)
+
+		_, err = conn.Write(append(append([]byte(forwardMagic), forwardVersion), session...))
+		require.NoError(t, err)
+		_, err = conn.Write(frame)
+		require.NoError(t, err)
+
+		var reply [len(forwardMagic) + 1 + 8]byte
+		_, err = io.ReadFull(conn, reply[:])
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), binary.BigEndian.Uint64(reply[len(forwardMagic)+1:]))
+		require.NoError(t, conn.Close())
+	}
+
+	frame, err = encodeForwardFrame(2, []Metric{{Application: "app", Key: []byte("b"), Val: 2, TS: time.Now()}}, true)
+	require.NoError(t, err)
+	conn, err := net.Dial("tcp", source.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write(append(append(append([]byte(forwardMagic), forwardVersion), session...), frame...))
+	require.NoError(t, err)
+	var reply [len(forwardMagic) + 1 + 8]byte
+	_, err = io.ReadFull(conn, reply[:])
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	m, err := source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, "a", string(m.Key))
+	m, err = source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, "b", string(m.Key))
+}
+
+// flakyProxy passes forward connections to a source, but loses the
+// acknowledgements beyond its budget by closing the connection instead.
+type flakyProxy struct {
+	listener net.Listener
+	target   string
+
+	mu   sync.Mutex
+	acks int
+}
+
+func newFlakyProxy(t *testing.T, target string) *flakyProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &flakyProxy{listener: listener, target: target}
+	go p.accept()
+	t.Cleanup(func() { _ = listener.Close() })
+	return p
+}
+
+func (p *flakyProxy) setAcks(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acks = n
+}
+
+func (p *flakyProxy) accept() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			_ = client.Close()
+			continue
+		}
+		go func() { _, _ = io.Copy(server, client) }()
+		go p.acknowledge(client, server)
+	}
+}
+
+func (p *flakyProxy) acknowledge(client, server net.Conn) {
+	defer func() { _ = client.Close() }()
+	defer func() { _ = server.Close() }()
+
+	reply := make([]byte, len(forwardMagic)+1)
+	if _, err := io.ReadFull(server, reply); err != nil {
+		return
+	}
+	if _, err := client.Write(reply); err != nil {
+		return
+	}
+	for {
+		var ack [8]byte
+		if _, err := io.ReadFull(server, ack[:]); err != nil {
+			return
+		}
+		p.mu.Lock()
+		lost := p.acks <= 0
+		p.acks--
+		p.mu.Unlock()
+		if lost {
+			return
+		}
+		if _, err := client.Write(ack[:]); err != nil {
+			return
+		}
+	}
+}
+
+func TestForwardDest_Resend(t *testing.T) {
+	source, err := NewForwardSource("127.0.0.1:0")
+	require.NoError(t, err)
+	proxy := newFlakyProxy(t, source.Addr().String())
+
+	dest, err := NewForwardDest(proxy.listener.Addr().String(), "interval=1h", "compression=none")
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 0)
+
+	// the first frame is delivered, but not acknowledged.
+	require.NoError(t, dest.Metric("app", "inst", []byte("a"), 1, ts))
+	require.Error(t, dest.Flush())
+
+	// the first frame is resent and acknowledged, the second isn't.
+	proxy.setAcks(1)
+	require.NoError(t, dest.Metric("app", "inst", []byte("b"), 2, ts))
+	require.Error(t, dest.Flush())
+
+	proxy.setAcks(100)
+	require.NoError(t, dest.Metric("app", "inst", []byte("c"), 3, ts))
+	require.NoError(t, dest.Flush())
+	require.NoError(t, dest.Close())
+	require.NoError(t, source.Close())
+
+	var keys []string
+	for {
+		m, err := source.NextMetric()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		keys = append(keys, string(m.Key))
+	}
+	require.Equal(t, []string{"a", "b", "c"}, keys)
+}
+
+func TestForwardSource_DecompressionBomb(t *testing.T) {
+	source, err := NewForwardSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	// a small frame that inflates beyond the frame limit.
+	var body bytes.Buffer
+	w, err := flate.NewWriter(&body, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, forwardMaxFrame+1))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Less(t, body.Len(), 1<<20)
+
+	frame := make([]byte, 4, 4+9+body.Len())
+	binary.BigEndian.PutUint32(frame, uint32(9+body.Len()))
+	frame = binary.BigEndian.AppendUint64(frame, 1)
+	frame = append(append(frame, forwardDeflate), body.Bytes()...)
+
+	_, _, err = decodeForwardFrame(frame[4:])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "decompressed frame larger than")
+
+	conn, err := net.Dial("tcp", source.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write(append(append([]byte(forwardMagic), forwardVersion), 1, 2, 3, 4, 5, 6, 7, 8))
+	require.NoError(t, err)
+	_, err = conn.Write(frame)
+	require.NoError(t, err)
+
+	// the server answers the hello, but closes the connection instead of
+	// acknowledging the frame.
+	reply, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, append([]byte(forwardMagic), forwardVersion), reply)
+}
+
+func TestForwardSource_SessionEviction(t *testing.T) {
+	source, err := NewForwardSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	old := source.session([8]byte{1})
+	old.seq = 5
+	old.lastSeen = time.Now().Add(-25 * time.Hour)
+
+	// sessions with an open connection are kept however old.
+	source.session([8]byte{2})
+	require.Same(t, old, source.session([8]byte{1}))
+	source.release(old)
+	source.release(old)
+
+	// sessions without connections are forgotten after a day.
+	old.lastSeen = time.Now().Add(-25 * time.Hour)
+	source.session([8]byte{2})
+	require.False(t, old == source.session([8]byte{1}))
+}
@@ -1,19 +1,75 @@
 module storj.io/statreceiver
 
-go 1.13
+go 1.19
 
 require (
 	github.com/Shopify/go-lua v0.0.0-20191113154418-05ce435a9edd
-	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/jtolds/go-luar v0.0.0-20200310225017-6fa637b8208b
+	github.com/klauspost/compress v1.15.15
 	github.com/lib/pq v1.3.0
-	github.com/mattn/go-sqlite3 v1.14.12 // indirect
+	github.com/mattn/go-sqlite3 v1.14.12
 	github.com/spf13/cobra v0.0.6
 	github.com/stretchr/testify v1.4.0
 	github.com/zeebo/admission/v3 v3.0.1
 	github.com/zeebo/errs v1.2.2
-	golang.org/x/sync v0.4.0
+	google.golang.org/grpc v1.27.1
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v2 v2.2.4
 	storj.io/common v0.0.0-20200323134045-2bd4d6e2dd7d
 	storj.io/eventkit v0.0.0-20240124163201-beae173bc798
 	storj.io/private v0.0.0-20200323154727-e555cfbe576d
 )
+
+require (
+	cloud.google.com/go v0.52.0 // indirect
+	github.com/blang/semver v3.5.1+incompatible // indirect
+	github.com/btcsuite/btcutil v1.0.1 // indirect
+	github.com/calebcase/tmpfile v1.0.1 // indirect
+	github.com/cloudfoundry/gosigar v1.1.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/fsnotify/fsnotify v1.4.7 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/groupcache v0.0.0-20191227052852-215e87163ea7 // indirect
+	github.com/golang/protobuf v1.5.0 // indirect
+	github.com/google/go-cmp v0.5.5 // indirect
+	github.com/google/pprof v0.0.0-20200229191704-1ebb73c60ed3 // indirect
+	github.com/googleapis/gax-go/v2 v2.0.5 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/jtolds/monkit-hw/v2 v2.0.0-20191108235325-141a0da276b3 // indirect
+	github.com/jtolds/tracetagger/v2 v2.0.0-rc5 // indirect
+	github.com/magiconair/properties v1.8.0 // indirect
+	github.com/minio/sha256-simd v0.0.0-20190328051042-05b4dd3047e5 // indirect
+	github.com/mitchellh/mapstructure v1.1.2 // indirect
+	github.com/pelletier/go-toml v1.2.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/skyrings/skyring-common v0.0.0-20160929130248-d1c0bb1cbd5e // indirect
+	github.com/spacemonkeygo/monkit/v3 v3.0.5 // indirect
+	github.com/spacemonkeygo/monotime v0.0.0-20180824235756-e3f48a95f98a // indirect
+	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572 // indirect
+	github.com/spf13/afero v1.1.2 // indirect
+	github.com/spf13/cast v1.3.0 // indirect
+	github.com/spf13/jwalterweatherman v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/viper v1.4.0 // indirect
+	github.com/zeebo/admission/v2 v2.0.0 // indirect
+	github.com/zeebo/float16 v0.1.0 // indirect
+	github.com/zeebo/incenc v0.0.0-20180505221441-0d92902eec54 // indirect
+	github.com/zeebo/structs v1.0.2 // indirect
+	go.opencensus.io v0.22.2 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	go.uber.org/zap v1.14.1 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
+	golang.org/x/sync v0.4.0 // indirect
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f // indirect
+	golang.org/x/text v0.3.3 // indirect
+	google.golang.org/api v0.20.0 // indirect
+	google.golang.org/appengine v1.6.5 // indirect
+	google.golang.org/genproto v0.0.0-20200115191322-ca5a22157cba // indirect
+	storj.io/drpc v0.0.7-0.20191115031725-2171c57838d2 // indirect
+	storj.io/picobuf v0.0.3 // indirect
+)
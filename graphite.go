@@ -5,39 +5,127 @@ package statreceiver
 
 import (
 	"bufio"
+	"encoding/binary"
 	"errors"
-	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/zeebo/errs"
+)
+
+const (
+	graphiteMinBackoff   = time.Second
+	graphiteMaxBackoff   = 2 * time.Minute
+	graphiteDialTimeout  = 10 * time.Second
+	graphiteWriteTimeout = 30 * time.Second
+	graphiteCloseTimeout = 30 * time.Second
+
+	// graphiteFlushInterval is how often the buffer is flushed.
+	graphiteFlushInterval = 5 * time.Second
+
+	// graphitePickleBatch is the number of metrics sent in a single pickle
+	// message. Carbon refuses messages that are too large.
+	graphitePickleBatch = 500
 )
 
 // GraphiteDest is a MetricDest that sends data with the Graphite TCP wire
 // protocol.
+//
+// Metrics are kept in a bounded buffer until they have been written to the
+// connection, so lines survive reconnects. If the buffer is full, the oldest
+// metrics are dropped. Because the plaintext and pickle protocols have no
+// acknowledgements, a batch that fails halfway through may be sent twice,
+// which Graphite handles fine.
 type GraphiteDest struct {
-	address string
+	address  string
+	pickle   bool
+	tagged   bool
+	template graphiteTemplate
+	limit    int
+	clock    Clock
 
-	mu      sync.Mutex
-	conn    net.Conn
-	buf     *bufio.Writer
-	stopped bool
+	// flushMu makes sure metrics are only written by one flush at a time.
+	flushMu sync.Mutex
+
+	mu          sync.Mutex
+	conn        net.Conn
+	pending     []graphiteMetric
+	dropped     int
+	backoff     time.Duration
+	nextAttempt time.Time
+	stopped     bool
+	closed      bool
+	lastFlush   time.Time
+	lastErr     error
+}
+
+type graphiteMetric struct {
+	path string
+	val  float64
+	ts   int64
 }
 
 // NewGraphiteDest creates a GraphiteDest with TCP address address. Because
 // this function is called in a Lua pipeline domain-specific language, the DSL
 // wants a graphite destination to be flushing every few seconds, so this
 // constructor will start that process. Use Close to stop it.
-func NewGraphiteDest(address string) *GraphiteDest {
-	rv := &GraphiteDest{address: address}
+//
+// The following options are supported:
+//
+//   - protocol=plaintext|pickle selects the Carbon protocol (default plaintext).
+//   - template=... sets the metric path, where {application}, {instance} and
+//     {key} are replaced (default {application}.{instance}.{key}).
+//   - tagged=true translates monkit v3 keys into Graphite 1.1 tagged series,
+//     with the application and instance as tags. The template then only
+//     applies to the series name, and {key} is the measurement and field
+//     (default {key}).
+//   - buffer=N sets how many unsent metrics are kept (default 100000).
+func NewGraphiteDest(address string, opts ...string) (*GraphiteDest, error) {
+	o := parseOptions(opts)
+	protocol := o.String("protocol", "plaintext")
+	tagged := o.Bool("tagged", false)
+	template := "{application}.{instance}.{key}"
+	if tagged {
+		template = "{key}"
+	}
+	template = o.String("template", template)
+	limit := o.Int("buffer", 100000)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	if protocol != "plaintext" && protocol != "pickle" {
+		return nil, errs.New("graphite protocol %q not supported", protocol)
+	}
+
+	rv := &GraphiteDest{
+		address:  address,
+		pickle:   protocol == "pickle",
+		tagged:   tagged,
+		template: parseGraphiteTemplate(template),
+		limit:    limit,
+		clock:    currentClock(),
+	}
 	go rv.run()
-	return rv
+	return rv, nil
 }
 
 var _ MetricDest = (*GraphiteDest)(nil)
 
 // Metric implements MetricDest.
 func (d *GraphiteDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	var path string
+	if d.tagged {
+		path = graphiteTaggedPath(d.template, application, instance, key)
+	} else {
+		path = d.template.render(application, instance, key)
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -45,80 +133,308 @@ func (d *GraphiteDest) Metric(application, instance string, key []byte, val floa
 		return errors.New("graphite dest is stopped, cannot add metric")
 	}
 
-	if d.conn == nil {
-		err := d.establishConnection()
-		if err != nil {
-			return err
-		}
-	}
-	_, err := fmt.Fprintf(d.buf, "%s.%s.%s %v %d\n", application, instance, string(key), val, ts.Unix())
-	if err != nil {
-		log.Printf("err writing to buffer, re-establishing connection. err: %v", err)
-		err = d.establishConnection()
-		if err != nil {
-			return err
+	if len(d.pending) >= d.limit {
+		// drop the oldest tenth of the buffer to make room.
+		drop := d.limit/10 + 1
+		if drop > len(d.pending) {
+			drop = len(d.pending)
 		}
-		// Try one more time, now that we've reestablished connection.
-		_, err = fmt.Fprintf(d.buf, "%s.%s.%s %v %d\n", application, instance, string(key), val, ts.Unix())
+		d.pending = append(d.pending[:0], d.pending[drop:]...)
+		d.dropped += drop
 	}
-	return err
+	d.pending = append(d.pending, graphiteMetric{path: path, val: val, ts: ts.Unix()})
+	return nil
 }
 
-// establishConnection dials the address and prepares a buffer for writing.
-// Only call while holding the mutex lock.
-func (d *GraphiteDest) establishConnection() error {
-	if d.conn != nil {
-		err := d.conn.Close()
-		if err != nil {
-			log.Printf("failed closing old conn: %v", err)
-		}
-	}
-	conn, err := net.Dial("tcp", d.address)
-	if err != nil {
-		d.conn = nil
-		return err
-	}
-	d.conn = conn
-	d.buf = bufio.NewWriter(conn)
-	return nil
+// SinkStatus implements Sink.
+func (d *GraphiteDest) SinkStatus() SinkStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return newSinkStatus(d.lastFlush, d.lastErr)
 }
 
-// Close stops the flushing goroutine.
+// Close stops the flushing goroutine and writes the pending metrics one last
+// time. Metrics that can't be written within graphiteCloseTimeout are
+// dropped.
 func (d *GraphiteDest) Close() (err error) {
 	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return nil
+	}
 	d.stopped = true
+	d.mu.Unlock()
+
+	err = d.flush(time.Now().Add(graphiteCloseTimeout))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
 	if d.conn != nil {
-		err = d.conn.Close()
+		err = errs.Combine(err, d.conn.Close())
+		d.conn = nil
 	}
-	d.mu.Unlock()
 	return err
 }
 
-// run periodically flushes the buffer to the underlying conn.
+// run periodically flushes the buffer to the underlying conn, backing off
+// exponentially while the connection can't be established.
 func (d *GraphiteDest) run() {
 	for {
-		time.Sleep(5 * time.Second)
+		<-d.clock.After(graphiteFlushInterval)
 		d.mu.Lock()
-		if d.stopped {
-			d.mu.Unlock()
+		stopped, due := d.stopped, d.clock.Now().After(d.nextAttempt)
+		d.mu.Unlock()
+		if stopped {
 			return
 		}
-		var err error
-		if d.buf != nil {
-			err = d.buf.Flush()
+		if !due {
+			continue
 		}
-		d.mu.Unlock()
-		if err != nil {
+		if err := d.flush(time.Time{}); err != nil {
 			log.Printf("failed flushing: %v", err)
 		}
 	}
 }
 
-// Flush manually flushes the buffer to the underlying writer.
+// Flush manually flushes the buffer to the underlying writer. Unlike the
+// periodic flush, it reconnects immediately if needed.
 func (d *GraphiteDest) Flush() error {
+	return d.flush(time.Time{})
+}
+
+// flush writes all pending metrics, connecting and writing until deadline if
+// it is set. The pending metrics are taken out of the buffer, so Metric
+// doesn't wait on the connection, and the ones that could not be written are
+// put back in front of the metrics added meanwhile.
+func (d *GraphiteDest) flush(deadline time.Time) (err error) {
+	d.flushMu.Lock()
+	defer d.flushMu.Unlock()
+
+	d.mu.Lock()
+	if d.dropped > 0 {
+		log.Printf("graphite buffer for %s full, dropped %d metrics", d.address, d.dropped)
+		d.dropped = 0
+	}
+	pending, conn := d.pending, d.conn
+	d.pending = nil
+	d.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		d.lastErr = err
+		if err == nil {
+			d.lastFlush = d.clock.Now()
+			d.backoff = 0
+			d.nextAttempt = time.Time{}
+			return
+		}
+
+		d.requeue(pending)
+		if d.conn != nil {
+			_ = d.conn.Close()
+			d.conn = nil
+		}
+		d.backoff *= 2
+		if d.backoff < graphiteMinBackoff {
+			d.backoff = graphiteMinBackoff
+		}
+		if d.backoff > graphiteMaxBackoff {
+			d.backoff = graphiteMaxBackoff
+		}
+		d.nextAttempt = d.clock.Now().Add(d.backoff)
+	}()
+
+	if conn != nil && !connAlive(conn) {
+		conn = nil
+	}
+	if conn == nil {
+		conn, err = d.dial(earliest(graphiteDialTimeout, deadline))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = conn.SetWriteDeadline(earliest(graphiteWriteTimeout, deadline))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(conn)
+	for len(pending) > 0 {
+		n := len(pending)
+		if d.pickle {
+			if n > graphitePickleBatch {
+				n = graphitePickleBatch
+			}
+			err = writeGraphitePickle(w, pending[:n])
+		} else {
+			err = writeGraphitePlaintext(w, pending[:n])
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		pending = pending[n:]
+	}
+	return nil
+}
+
+// earliest returns the time timeout from now, or deadline if it is set and
+// earlier.
+func earliest(timeout time.Duration, deadline time.Time) time.Time {
+	t := time.Now().Add(timeout)
+	if !deadline.IsZero() && deadline.Before(t) {
+		return deadline
+	}
+	return t
+}
+
+// dial connects to the Graphite server until deadline and makes the
+// connection the current one, closing the previous one.
+func (d *GraphiteDest) dial(deadline time.Time) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", d.address, time.Until(deadline))
+	if err != nil {
+		return nil, err
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	return d.buf.Flush()
+	if d.closed {
+		_ = conn.Close()
+		return nil, errors.New("graphite dest is stopped")
+	}
+	if d.conn != nil {
+		_ = d.conn.Close()
+	}
+	d.conn = conn
+	return conn, nil
+}
+
+// requeue puts metrics that failed to be written back in front of the
+// pending ones, dropping the oldest beyond the limit. Only call while holding
+// the mutex lock.
+func (d *GraphiteDest) requeue(metrics []graphiteMetric) {
+	if len(metrics) == 0 {
+		return
+	}
+	if drop := len(metrics) + len(d.pending) - d.limit; drop > 0 {
+		if drop > len(metrics) {
+			drop = len(metrics)
+		}
+		metrics = metrics[drop:]
+		d.dropped += drop
+	}
+	d.pending = append(metrics[:len(metrics):len(metrics)], d.pending...)
+}
+
+// connAlive checks whether the remote end has closed conn. Carbon never writes
+// to us, so anything other than a timeout means the connection is gone.
+func connAlive(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
+	}
+	var buf [1]byte
+	_, err := conn.Read(buf[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func writeGraphitePlaintext(w *bufio.Writer, metrics []graphiteMetric) error {
+	var buf []byte
+	for _, m := range metrics {
+		buf = append(buf[:0], m.path...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendFloat(buf, m.val, 'g', -1, 64)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, m.ts, 10)
+		buf = append(buf, '\n')
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGraphitePickle writes metrics as a single Carbon pickle message: a
+// 4 byte big endian length followed by a protocol 2 pickle of a list of
+// (path, (timestamp, value)) tuples.
+func writeGraphitePickle(w io.Writer, metrics []graphiteMetric) error {
+	const (
+		pickleProto      = 0x80
+		pickleEmptyList  = ']'
+		pickleMark       = '('
+		pickleAppends    = 'e'
+		pickleBinUnicode = 'X'
+		pickleBinFloat   = 'G'
+		pickleTuple2     = 0x86
+		pickleStop       = '.'
+	)
+
+	buf := make([]byte, 4, 4+8+len(metrics)*48)
+	buf = append(buf, pickleProto, 2, pickleEmptyList, pickleMark)
+	for _, m := range metrics {
+		buf = append(buf, pickleBinUnicode)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.path)))
+		buf = append(buf, m.path...)
+		buf = append(buf, pickleBinFloat)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(float64(m.ts)))
+		buf = append(buf, pickleBinFloat)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(m.val))
+		buf = append(buf, pickleTuple2, pickleTuple2)
+	}
+	buf = append(buf, pickleAppends, pickleStop)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(buf)-4))
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// graphiteTemplate is a metric path template split into literal text and
+// {application}, {instance} and {key} placeholders.
+type graphiteTemplate []string
+
+func parseGraphiteTemplate(template string) graphiteTemplate {
+	var parts graphiteTemplate
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		end := strings.IndexByte(template, '}')
+		if start < 0 || end < start {
+			parts = append(parts, template)
+			break
+		}
+		if start > 0 {
+			parts = append(parts, template[:start])
+		}
+		parts = append(parts, template[start:end+1])
+		template = template[end+1:]
+	}
+	return parts
+}
+
+func (t graphiteTemplate) render(application, instance string, key []byte) string {
+	var b strings.Builder
+	for _, part := range t {
+		switch part {
+		case "{application}":
+			b.WriteString(application)
+		case "{instance}":
+			b.WriteString(instance)
+		case "{key}":
+			b.Write(key)
+		default:
+			b.WriteString(part)
+		}
+	}
+	return b.String()
 }
 
 // TestCloseConn is used for tests only, and allows you to manually close the
@@ -126,5 +442,8 @@ func (d *GraphiteDest) Flush() error {
 func (d *GraphiteDest) TestCloseConn() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if d.conn == nil {
+		return nil
+	}
 	return d.conn.Close()
 }
@@ -0,0 +1,135 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// GraphiteSource is a MetricSource that accepts the Graphite plaintext
+// protocol, lines of "path value timestamp".
+//
+// Plain paths become the key as is, after removing the segments used for
+// the application and instance. Tagged series like "name;tag=value" become
+// monkit v3 shaped keys with the field "value".
+type GraphiteSource struct {
+	*lineSource
+
+	application        string
+	instance           string
+	applicationSegment int
+	instanceSegment    int
+	applicationTag     string
+	instanceTag        string
+}
+
+// NewGraphiteSource creates a GraphiteSource listening on address. The
+// following options are supported:
+//
+//   - network=tcp|udp selects the transport (default tcp).
+//   - application=NAME sets the application of all metrics (default
+//     graphite).
+//   - instance=NAME sets the instance of all metrics (default empty).
+//   - application_segment=N takes the application from the Nth dot separated
+//     path segment, counting from 0, and removes it from the key.
+//   - instance_segment=N does the same for the instance.
+//   - application_tag=TAG takes the application from the tag TAG of tagged
+//     series, removing the tag (default application).
+//   - instance_tag=TAG does the same for the instance (default instance).
+func NewGraphiteSource(address string, opts ...string) (*GraphiteSource, error) {
+	o := parseOptions(opts)
+	network := o.String("network", "tcp")
+	rv := &GraphiteSource{
+		application:        o.String("application", "graphite"),
+		instance:           o.String("instance", ""),
+		applicationSegment: o.Int("application_segment", -1),
+		instanceSegment:    o.Int("instance_segment", -1),
+		applicationTag:     o.String("application_tag", "application"),
+		instanceTag:        o.String("instance_tag", "instance"),
+	}
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	source, err := newLineSource("graphite", network, address, rv.parse)
+	if err != nil {
+		return nil, err
+	}
+	rv.lineSource = source
+	return rv, nil
+}
+
+var _ MetricSource = (*GraphiteSource)(nil)
+
+func (s *GraphiteSource) parse(line []byte, now time.Time) ([]Metric, error) {
+	fields := bytes.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, errs.New("expected path, value and timestamp")
+	}
+
+	val, err := strconv.ParseFloat(string(fields[1]), 64)
+	if err != nil {
+		return nil, errs.New("invalid value %q", fields[1])
+	}
+
+	ts := now
+	if len(fields) == 3 {
+		secs, err := strconv.ParseFloat(string(fields[2]), 64)
+		if err != nil {
+			return nil, errs.New("invalid timestamp %q", fields[2])
+		}
+		if secs > 0 {
+			whole, frac := math.Modf(secs)
+			ts = time.Unix(int64(whole), int64(frac*1e9))
+		}
+	}
+
+	m := Metric{Application: s.application, Instance: s.instance, Val: val, TS: ts}
+
+	path := string(fields[0])
+	if semi := strings.IndexByte(path, ';'); semi >= 0 {
+		var tags []keyTag
+		for _, tag := range strings.Split(path[semi+1:], ";") {
+			eq := strings.IndexByte(tag, '=')
+			if eq <= 0 {
+				return nil, errs.New("invalid tag %q", tag)
+			}
+			name, value := tag[:eq], tag[eq+1:]
+			switch name {
+			case s.applicationTag:
+				m.Application = value
+			case s.instanceTag:
+				m.Instance = value
+			default:
+				tags = append(tags, keyTag{name: name, value: value})
+			}
+		}
+		m.Key = makeV3Key(path[:semi], tags, "value")
+		return []Metric{m}, nil
+	}
+
+	segments := strings.Split(path, ".")
+	var key []string
+	for i, segment := range segments {
+		switch i {
+		case s.applicationSegment:
+			m.Application = segment
+		case s.instanceSegment:
+			m.Instance = segment
+		default:
+			key = append(key, segment)
+		}
+	}
+	if len(key) == 0 {
+		return nil, errs.New("empty key")
+	}
+	m.Key = []byte(strings.Join(key, "."))
+	return []Metric{m}, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+)
+
+func TestGraphiteSource(t *testing.T) {
+	source, err := statreceiver.NewGraphiteSource("127.0.0.1:0",
+		"application_segment=0", "instance_segment=1")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	conn, err := net.Dial("tcp", source.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("" +
+		"satellite.node1.env.process.uptime 12.5 1600000000\n" +
+		"bogus line\n" +
+		"requests;path=/;application=api 3 1600000000.5\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	m, err := source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, "satellite", m.Application)
+	require.Equal(t, "node1", m.Instance)
+	require.Equal(t, "env.process.uptime", string(m.Key))
+	require.Equal(t, 12.5, m.Val)
+	require.Equal(t, time.Unix(1600000000, 0), m.TS)
+
+	m, err = source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, "api", m.Application)
+	require.Equal(t, "", m.Instance)
+	require.Equal(t, "requests,path=/ value", string(m.Key))
+	require.Equal(t, 3.0, m.Val)
+	require.Equal(t, time.Unix(1600000000, 5e8), m.TS)
+}
+
+func TestGraphiteSource_OpenConnection(t *testing.T) {
+	source, err := statreceiver.NewGraphiteSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	conn, err := net.Dial("tcp", source.Addr().String())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	// a line arrives while the connection stays open, also when it is
+	// written in parts.
+	_, err = conn.Write([]byte("app.inst.uptime 1 "))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = conn.Write([]byte("1600000000\napp.inst.partial"))
+	require.NoError(t, err)
+
+	got := make(chan statreceiver.Metric, 1)
+	go func() {
+		m, err := source.NextMetric()
+		if err == nil {
+			got <- m
+		}
+	}()
+	select {
+	case m := <-got:
+		require.Equal(t, "app.inst.uptime", string(m.Key))
+		require.Equal(t, 1.0, m.Val)
+	case <-time.After(5 * time.Second):
+		t.Fatal("line was not delivered")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"sort"
+	"strings"
+)
+
+// graphiteTaggedPath converts a monkit v3 key like
+//
+//	function_times,name=x,scope=y p50
+//
+// into a Graphite 1.1 tagged series like
+//
+//	function_times.p50;application=app;instance=inst;name=x;scope=y
+//
+// where name is the rendered template with {key} standing for the measurement
+// and field. Keys without tags or field are used as is. Characters Graphite
+// rejects are replaced with underscores, and tags with an empty value are
+// dropped since Graphite doesn't allow them.
+func graphiteTaggedPath(template graphiteTemplate, application, instance string, key []byte) string {
+	measurement, tags, field := splitV3Key(key)
+
+	name := measurement
+	if field != "" {
+		name += "." + field
+	}
+	name = strings.Map(graphiteNameChar, template.render(application, instance, []byte(name)))
+
+	tags = append(tags,
+		keyTag{name: "application", value: application},
+		keyTag{name: "instance", value: instance})
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].name < tags[j].name })
+
+	var b strings.Builder
+	b.WriteString(name)
+	for i, tag := range tags {
+		if tag.value == "" || (i > 0 && tags[i-1].name == tag.name) {
+			continue
+		}
+		b.WriteByte(';')
+		b.WriteString(strings.Map(graphiteTagNameChar, tag.name))
+		b.WriteByte('=')
+		value := strings.Map(graphiteTagValueChar, tag.value)
+		if value[0] == '~' {
+			value = "_" + value[1:]
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+func graphiteNameChar(r rune) rune {
+	if r <= ' ' || r > '~' {
+		return '_'
+	}
+	switch r {
+	case ';', '!', '^', '=', '(', ')', '{', '}', '[', ']', ',', '*', '?', '\\':
+		return '_'
+	}
+	return r
+}
+
+func graphiteTagNameChar(r rune) rune {
+	if r <= ' ' || r > '~' {
+		return '_'
+	}
+	switch r {
+	case ';', '!', '^', '=':
+		return '_'
+	}
+	return r
+}
+
+func graphiteTagValueChar(r rune) rune {
+	if r <= ' ' || r > '~' || r == ';' {
+		return '_'
+	}
+	return r
+}
@@ -4,58 +4,195 @@
 package statreceiver_test
 
 import (
+	"bufio"
+	"encoding/binary"
+	"io"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
-	"golang.org/x/sync/errgroup"
 
 	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
 )
 
 func TestGraphiteDest(t *testing.T) {
-	t.Skip("Not working on Jenkins, yet")
-	l, err := net.Listen("tcp", "localhost:")
+	server := statreceivertest.NewGraphiteServer(t)
+
+	gd, err := statreceiver.NewGraphiteDest(server.Addr())
 	require.NoError(t, err)
+	defer func() { require.NoError(t, gd.Close()) }()
 
-	var eg errgroup.Group
+	ts := time.Unix(1600000000, 0)
 
-	eg.Go(func() error {
-		var conns []net.Conn
-		for {
-			conn, err := l.Accept()
-			if err != nil {
-				break
-			}
-			conns = append(conns, conn)
-		}
-		for _, conn := range conns {
-			require.NoError(t, conn.Close())
-		}
-		return nil
-	})
+	// flushing before any metric is a no-op.
+	require.NoError(t, gd.Flush())
 
-	address := l.Addr().String()
+	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 10.1, ts))
+	require.NoError(t, gd.Flush())
+	require.Equal(t, "bob.jones.key 10.1 1600000000", server.Wait(t, 1)[0])
 
-	gd := statreceiver.NewGraphiteDest(address)
+	// Close the conn on our side, the next flush should reconnect and still
+	// deliver the metric.
+	require.NoError(t, gd.TestCloseConn())
+	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 10.2, ts))
+	require.NoError(t, gd.Flush())
+	require.Equal(t, "bob.jones.key 10.2 1600000000", server.Wait(t, 2)[1])
+
+	// Close the conn on the server side, which is only noticed when we try
+	// to use it.
+	server.DropConns()
+	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 10.3, ts))
+	require.NoError(t, gd.Flush())
+	require.Equal(t, "bob.jones.key 10.3 1600000000", server.Wait(t, 3)[2])
+}
 
-	// first write a metric, which will establish the connection
-	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 10.1, time.Now()))
+func TestGraphiteDest_Unavailable(t *testing.T) {
+	server := statreceivertest.NewGraphiteServer(t)
+	address := server.Addr()
+	server.Close()
 
-	// Close the conn to trigger an error state, where we can no longer write to
-	// the conn.
-	require.NoError(t, gd.TestCloseConn())
+	gd, err := statreceiver.NewGraphiteDest(address, "template=stats.{application}.{key}")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, gd.Close()) }()
 
-	// Flush the metric to the underlying writer, this should cause an error due
-	// to the closed conn.
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, gd.Metric("bob", "jones", []byte("first"), 1, ts))
 	require.Error(t, gd.Flush())
+	require.NotEmpty(t, gd.SinkStatus().LastError)
+	require.True(t, gd.SinkStatus().LastFlush.IsZero())
+	require.NoError(t, gd.Metric("bob", "jones", []byte("second"), 2, ts))
+
+	// bring the listener back on the same address; lines buffered while it
+	// was down must be sent.
+	l, err := net.Listen("tcp", address)
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
 
-	// We should still be able to successfully write a metric, and should
-	// establish a new conn. Flush should also work.
-	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 10.1, time.Now()))
 	require.NoError(t, gd.Flush())
-	require.NoError(t, gd.Close())
+	require.Empty(t, gd.SinkStatus().LastError)
+	require.False(t, gd.SinkStatus().LastFlush.IsZero())
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "stats.bob.first 1 1600000000\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "stats.bob.second 2 1600000000\n", line)
+}
+
+func TestGraphiteDest_Pickle(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, l.Close()) }()
+
+	gd, err := statreceiver.NewGraphiteDest(l.Addr().String(), "protocol=pickle")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, gd.Close()) }()
+
+	require.NoError(t, gd.Metric("app", "inst", []byte("key"), 1.5, time.Unix(1600000000, 0)))
+	require.NoError(t, gd.Flush())
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	var header [4]byte
+	_, err = io.ReadFull(conn, header[:])
+	require.NoError(t, err)
+	payload := make([]byte, binary.BigEndian.Uint32(header[:]))
+	_, err = io.ReadFull(conn, payload)
+	require.NoError(t, err)
+
+	require.Equal(t, []byte{0x80, 2, ']', '('}, payload[:4])
+	require.Contains(t, string(payload), "app.inst.key")
+	require.Equal(t, []byte{'e', '.'}, payload[len(payload)-2:])
+}
+
+func TestGraphiteDest_Tagged(t *testing.T) {
+	server := statreceivertest.NewGraphiteServer(t)
+
+	gd, err := statreceiver.NewGraphiteDest(server.Addr(), "tagged=true")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, gd.Close()) }()
+
+	for i, tt := range []struct {
+		application, instance, key string
+		expected                   string
+	}{
+		{"app", "inst", "function_times,name=x,scope=y p50",
+			"function_times.p50;application=app;instance=inst;name=x;scope=y"},
+		{"app", "", "env.process.uptime",
+			"env.process.uptime;application=app"},
+		{"app", "inst", `req,path=/a\ b;c,empty= count`,
+			"req.count;application=app;instance=inst;path=/a_b_c"},
+		{"app", "inst", "weird(name),tag=~home value",
+			"weird_name_.value;application=app;instance=inst;tag=_home"},
+	} {
+		require.NoError(t, gd.Metric(tt.application, tt.instance, []byte(tt.key), 1, time.Unix(1600000000, 0)))
+		require.NoError(t, gd.Flush())
+		lines := server.Wait(t, i+1)
+		require.Equal(t, tt.expected+" 1 1600000000", lines[i])
+	}
+}
+
+func TestGraphiteDest_Stalled(t *testing.T) {
+	// the server accepts the connection but never reads from it.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	gd, err := statreceiver.NewGraphiteDest(l.Addr().String(), "buffer=1000000")
+	require.NoError(t, err)
+
+	ts := time.Unix(1600000000, 0)
+	for i := 0; i < 500000; i++ {
+		require.NoError(t, gd.Metric("application", "instance", []byte("some.long.metric.key"), float64(i), ts))
+	}
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- gd.Flush() }()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+
+	// the flush is stuck writing, which doesn't block adding metrics.
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-flushed:
+		t.Fatalf("flush finished early: %v", err)
+	default:
+	}
+	start := time.Now()
+	require.NoError(t, gd.Metric("application", "instance", []byte("key"), 1, ts))
+	require.True(t, time.Since(start) < 50*time.Millisecond)
+
+	require.NoError(t, conn.Close())
+	require.Error(t, <-flushed)
+	require.NotEmpty(t, gd.SinkStatus().LastError)
+
+	// with the server gone, the last flush on close fails.
 	require.NoError(t, l.Close())
-	require.NoError(t, eg.Wait())
+	require.Error(t, gd.Close())
+}
+
+func TestGraphiteDest_Close(t *testing.T) {
+	server := statreceivertest.NewGraphiteServer(t)
+
+	gd, err := statreceiver.NewGraphiteDest(server.Addr())
+	require.NoError(t, err)
+
+	// pending metrics are written on close.
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 1, ts))
+	require.NoError(t, gd.Metric("bob", "jones", []byte("key"), 2, ts))
+	require.NoError(t, gd.Close())
+	require.Equal(t, []string{"bob.jones.key 1 1600000000", "bob.jones.key 2 1600000000"}, server.Wait(t, 2))
+
+	require.Error(t, gd.Metric("bob", "jones", []byte("key"), 3, ts))
+	require.NoError(t, gd.Close())
 }
@@ -6,11 +6,11 @@ package statreceiver
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,94 +20,91 @@ import (
 	"storj.io/common/sync2"
 )
 
+const (
+	// influxRequestTimeout limits a single write request.
+	influxRequestTimeout = 30 * time.Second
+	// influxCloseTimeout limits the last flush on Close.
+	influxCloseTimeout = time.Minute
+)
+
+// influxClient sends the write requests, so a hung server can't hold up
+// flushing forever.
+var influxClient = &http.Client{Timeout: influxRequestTimeout}
+
 // InfluxDest is a MetricDest that sends data with the Influx TCP wire
 // protocol.
 type InfluxDest struct {
-	url         string
-	urlRedacted string
-	token       string
-
-	mu      sync.Mutex
-	buf     bytes.Buffer
-	stopped bool
+	*influxEndpoint
 }
 
 // NewInfluxDest creates a InfluxDest with stats URL url. Because
 // this function is called in a Lua pipeline domain-specific language, the DSL
 // wants a Influx destination to be flushing every few seconds, so this
 // constructor will start that process. Use Close to stop it.
-func NewInfluxDest(writeURL string) *InfluxDest {
-	parsed, err := url.Parse(writeURL)
+func NewInfluxDest(writeURL string) (*InfluxDest, error) {
+	endpoint, err := newInfluxEndpoint(writeURL, 0)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	token := parsed.Query().Get("authorization")
-	noauth := parsed.Query()
-	noauth.Del("authorization")
-	parsed.RawQuery = noauth.Encode()
-
-	redactedURL, err := url.Parse(parsed.String())
-	if err != nil {
-		panic(err)
-	}
-
-	// If the URL has the user's password in the query, remove it to not leak it when printing/logging
-	// the URL
-	if vals := redactedURL.Query(); vals.Get("p") != "" {
-		vals.Set("p", "REDACTED")
-		redactedURL.RawQuery = vals.Encode()
-	}
-
-	rv := &InfluxDest{
-		url:         parsed.String(),
-		urlRedacted: redactedURL.String(),
-		token:       token,
-	}
-	go rv.flush()
-	return rv
+	go endpoint.run()
+	return &InfluxDest{influxEndpoint: endpoint}, nil
 }
 
 var _ MetricDest = (*InfluxDest)(nil)
 
 // Metric implements MetricDest.
 func (d *InfluxDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	line, ok := appendInfluxLine(nil, application, instance, key, val, ts)
+	if !ok {
+		log.Printf("influx metric dropped: %q", key)
+		return nil
+	}
+	d.write(line)
+	return nil
+}
 
+// appendInfluxLine appends the line protocol representation of the metric to
+// buf. It returns false if the key has no measurement to attach the
+// application and instance tags to.
+func appendInfluxLine(buf []byte, application, instance string, key []byte, val float64, ts time.Time) ([]byte, bool) {
 	// TODO(jeff): actual parsing of the key is very tricky in the presence of influx's busted
 	// escapes. If we could do that, we could more easily put the application tag in sorted order
 	// but since it begins with a, we'll do the easy thing and insert it first.
-	added := false
-keyRange:
+	i := influxMeasurementEnd(key)
+	if i <= 0 {
+		return buf, false
+	}
+
+	buf = append(buf, key[:i]...)
+	buf = append(buf, ",application="...)
+	buf = appendTag(buf, application)
+	buf = append(buf, ",instance="...)
+	buf = appendTag(buf, instance)
+	buf = append(buf, key[i:]...)
+	buf = append(buf, '=')
+	buf = strconv.AppendFloat(buf, val, 'g', -1, 64)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, ts.Truncate(time.Second).UnixNano(), 10)
+	buf = append(buf, '\n')
+	return buf, true
+}
+
+// influxMeasurementEnd returns the index of the first unescaped space or comma
+// in key, which is where the measurement name ends. It returns -1 if there is
+// none.
+func influxMeasurementEnd(key []byte) int {
 	for i, val := range key {
 		switch {
 		case val != ' ' && val != ',':
 			continue
 		case i == 0:
-			break keyRange
+			return 0
 		case key[i-1] == '\\':
 			continue
 		}
-
-		newKey := make([]byte, 0, len(key)+len(application)+len(instance)+len(",application=,instance="))
-		newKey = append(newKey, key[:i]...)
-		newKey = append(newKey, ",application="...)
-		newKey = appendTag(newKey, application)
-		newKey = append(newKey, ",instance="...)
-		newKey = appendTag(newKey, instance)
-		newKey = append(newKey, key[i:]...)
-		key = newKey
-
-		added = true
-		break
+		return i
 	}
-	if !added {
-		log.Printf("influx metric dropped: %q", key)
-		return nil
-	}
-
-	_, err := fmt.Fprintf(&d.buf, "%s=%v %d\n", key, val, ts.Truncate(time.Second).UnixNano())
-	return err
+	return -1
 }
 
 // appendTag writes a tag key, value, or field key to the buffer.
@@ -128,83 +125,263 @@ func appendTag(buf []byte, tag string) []byte {
 	return buf
 }
 
-// Close stops the flushing goroutine.
-func (d *InfluxDest) Close() error {
-	d.mu.Lock()
-	d.stopped = true
-	d.mu.Unlock()
+// InfluxEndpointHealth describes the state of a single Influx write endpoint.
+type InfluxEndpointHealth struct {
+	URL                 string
+	Healthy             bool
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccess         time.Time
+	QueuedBytes         int
+}
+
+// influxEndpoint buffers line protocol data for a single write URL and
+// flushes it every few seconds. Batches that fail to be written are kept in a
+// retry queue of up to retryLimit bytes and are sent again on the next flush.
+type influxEndpoint struct {
+	url         string
+	urlRedacted string
+	token       string
+	retryLimit  int
+
+	// flushMu makes sure a batch is only sent by one flush at a time.
+	flushMu sync.Mutex
+
+	mu          sync.Mutex
+	buf         bytes.Buffer
+	queue       [][]byte
+	queued      int
+	stopped     bool
+	failures    int
+	lastErr     error
+	lastSuccess time.Time
+}
+
+func newInfluxEndpoint(writeURL string, retryLimit int) (*influxEndpoint, error) {
+	parsed, err := url.Parse(writeURL)
+	if err != nil {
+		return nil, err
+	}
+	token := parsed.Query().Get("authorization")
+	noauth := parsed.Query()
+	noauth.Del("authorization")
+	parsed.RawQuery = noauth.Encode()
+
+	redactedURL, err := url.Parse(parsed.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// If the URL has the user's password in the query, remove it to not leak it when printing/logging
+	// the URL
+	if vals := redactedURL.Query(); vals.Get("p") != "" {
+		vals.Set("p", "REDACTED")
+		redactedURL.RawQuery = vals.Encode()
+	}
+
+	return &influxEndpoint{
+		url:         parsed.String(),
+		urlRedacted: redactedURL.String(),
+		token:       token,
+		retryLimit:  retryLimit,
+	}, nil
+}
+
+// write appends line protocol data to the pending buffer.
+func (e *influxEndpoint) write(data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.buf.Write(data)
+}
+
+// healthy reports whether the last flush attempt succeeded.
+func (e *influxEndpoint) healthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.failures == 0
+}
+
+// Health returns the current state of the endpoint.
+func (e *influxEndpoint) Health() InfluxEndpointHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	health := InfluxEndpointHealth{
+		URL:                 e.urlRedacted,
+		Healthy:             e.failures == 0,
+		ConsecutiveFailures: e.failures,
+		LastSuccess:         e.lastSuccess,
+		QueuedBytes:         e.queued + e.buf.Len(),
+	}
+	if e.lastErr != nil {
+		health.LastError = e.lastErr.Error()
+	}
+	return health
+}
+
+// SinkStatus implements Sink.
+func (e *influxEndpoint) SinkStatus() SinkStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return newSinkStatus(e.lastSuccess, e.lastErr)
+}
+
+// Flush sends pending data now, rather than with the next periodic flush. It
+// returns the last error if the endpoint is unhealthy afterwards.
+func (e *influxEndpoint) Flush() error {
+	e.flush(context.Background())
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failures > 0 {
+		return e.lastErr
+	}
+	return nil
+}
+
+// Close sends pending data one last time and stops the flushing goroutine.
+// Data that can't be sent within a minute is dropped.
+func (e *influxEndpoint) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), influxCloseTimeout)
+	defer cancel()
+	e.flush(ctx)
+
+	e.mu.Lock()
+	e.stopped = true
+	e.mu.Unlock()
 	return nil
 }
 
-func (d *InfluxDest) flush() {
+func (e *influxEndpoint) run() {
 	ctx := context.TODO()
 
 	for {
 		sync2.Sleep(ctx, 5*time.Second)
-
-		d.mu.Lock()
-		if d.stopped {
-			d.mu.Unlock()
+		if !e.flush(ctx) {
 			return
 		}
-		data := append([]byte{}, d.buf.Bytes()...)
-		d.buf.Reset()
-		d.mu.Unlock()
+	}
+}
 
-		if len(data) == 0 {
-			continue
+// flush sends the retry queue followed by the pending buffer. It returns false
+// if the endpoint has been stopped.
+func (e *influxEndpoint) flush(ctx context.Context) bool {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return false
+	}
+	if e.buf.Len() > 0 {
+		e.enqueue(append([]byte{}, e.buf.Bytes()...))
+		e.buf.Reset()
+	}
+	e.mu.Unlock()
+
+	for {
+		e.mu.Lock()
+		if len(e.queue) == 0 {
+			e.mu.Unlock()
+			return true
 		}
+		data := e.queue[0]
+		e.mu.Unlock()
+
+		err := e.send(ctx, data)
 
-		err := func() (err error) {
-			const maxReqs = 4
-			baseDelay := 50 * time.Millisecond
-
-			for leftReqs := maxReqs; leftReqs > 0; leftReqs-- {
-				req, err := http.NewRequestWithContext(ctx, "POST", d.url, bytes.NewReader(data))
-				if err != nil {
-					return err
-				}
-				if d.token != "" {
-					req.Header.Set("Authorization", "Token "+d.token)
-				}
-
-				resp, err := http.DefaultClient.Do(req)
-				if err != nil {
-					return err
-				}
-				defer func() { err = errs.Combine(err, resp.Body.Close()) }()
-
-				if status := resp.StatusCode; status != http.StatusNoContent {
-					if status == http.StatusInternalServerError && leftReqs > 1 {
-						iteration := maxReqs - leftReqs
-						delay := baseDelay << iteration
-						log.Printf(
-							"failed flushing %s: invalid status code: 500. Retrying %d/%d after %s",
-							d.urlRedacted,
-							iteration+1,
-							maxReqs-1,
-							delay,
-						)
-						sync2.Sleep(ctx, delay)
-						continue
-					}
-
-					if status == http.StatusRequestEntityTooLarge {
-						return errs.New("invalid status code: %d. Body size: %d bytes", status, len(data))
-					}
-
-					return errs.New("invalid status code: %d", status)
-				}
-
-				break
+		e.mu.Lock()
+		if err != nil {
+			if e.failures == 0 && e.retryLimit > 0 {
+				log.Printf("influx endpoint %s is unhealthy", e.urlRedacted)
 			}
+			e.failures++
+			e.lastErr = err
+			if e.retryLimit <= 0 {
+				e.dequeue()
+			}
+			e.mu.Unlock()
+			log.Printf("failed flushing %s: %v", e.urlRedacted, err)
+			return true
+		}
+		if e.failures > 0 && e.retryLimit > 0 {
+			log.Printf("influx endpoint %s is healthy again after %d failures", e.urlRedacted, e.failures)
+		}
+		e.failures = 0
+		e.lastErr = nil
+		e.lastSuccess = time.Now()
+		e.dequeue()
+		e.mu.Unlock()
+	}
+}
 
-			return nil
-		}()
+// enqueue adds a batch to the retry queue, dropping the oldest batches if the
+// queue grows beyond retryLimit. Only call while holding the mutex lock.
+func (e *influxEndpoint) enqueue(data []byte) {
+	e.queue = append(e.queue, data)
+	e.queued += len(data)
+	for len(e.queue) > 1 && e.queued > e.retryLimit {
+		log.Printf("influx retry queue for %s is full, dropping %d bytes", e.urlRedacted, len(e.queue[0]))
+		e.dequeue()
+	}
+}
+
+// dequeue removes the oldest batch from the retry queue. Only call while
+// holding the mutex lock.
+func (e *influxEndpoint) dequeue() {
+	e.queued -= len(e.queue[0])
+	e.queue[0] = nil
+	e.queue = e.queue[1:]
+}
+
+// send writes a single batch to the endpoint, retrying a few times when the
+// server reports an internal error.
+func (e *influxEndpoint) send(ctx context.Context, data []byte) (err error) {
+	const maxReqs = 4
+	baseDelay := 50 * time.Millisecond
+
+	for leftReqs := maxReqs; leftReqs > 0; leftReqs-- {
+		req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(data))
 		if err != nil {
-			log.Printf("failed flushing %s: %v", d.urlRedacted, err)
+			return err
+		}
+		if e.token != "" {
+			req.Header.Set("Authorization", "Token "+e.token)
 		}
+
+		resp, err := influxClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errs.Combine(err, resp.Body.Close()) }()
+
+		if status := resp.StatusCode; status != http.StatusNoContent {
+			if status == http.StatusInternalServerError && leftReqs > 1 {
+				iteration := maxReqs - leftReqs
+				delay := baseDelay << iteration
+				log.Printf(
+					"failed flushing %s: invalid status code: 500. Retrying %d/%d after %s",
+					e.urlRedacted,
+					iteration+1,
+					maxReqs-1,
+					delay,
+				)
+				sync2.Sleep(ctx, delay)
+				continue
+			}
+
+			if status == http.StatusRequestEntityTooLarge {
+				return errs.New("invalid status code: %d. Body size: %d bytes", status, len(data))
+			}
+
+			return errs.New("invalid status code: %d", status)
+		}
+
+		break
 	}
+
+	return nil
 }
 
 // InstanceZeroer will zero out instance ids given predicates.
@@ -215,21 +392,29 @@ type InstanceZeroer struct {
 }
 
 // NewInstanceZeroerIf will zero an instance id out if the regex matches.
-func NewInstanceZeroerIf(applicationRegex string, dest MetricDest) *InstanceZeroer {
+func NewInstanceZeroerIf(applicationRegex string, dest MetricDest) (*InstanceZeroer, error) {
+	application, err := regexp.Compile(applicationRegex)
+	if err != nil {
+		return nil, err
+	}
 	return &InstanceZeroer{
-		application: regexp.MustCompile(applicationRegex),
+		application: application,
 		matchToZero: true, // if the regex matches, zero the instance.
 		dest:        dest,
-	}
+	}, nil
 }
 
 // NewInstanceZeroerIfNot will zero an instance id out if the regex doesn't match.
-func NewInstanceZeroerIfNot(applicationRegex string, dest MetricDest) *InstanceZeroer {
+func NewInstanceZeroerIfNot(applicationRegex string, dest MetricDest) (*InstanceZeroer, error) {
+	application, err := regexp.Compile(applicationRegex)
+	if err != nil {
+		return nil, err
+	}
 	return &InstanceZeroer{
-		application: regexp.MustCompile(applicationRegex),
+		application: application,
 		matchToZero: false, // if the regex doesn't match, zero the instance.
 		dest:        dest,
-	}
+	}, nil
 }
 
 var _ MetricDest = (*InstanceZeroer)(nil)
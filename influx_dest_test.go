@@ -0,0 +1,130 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestInfluxDest_Server(t *testing.T) {
+	server := statreceivertest.NewInfluxServer(t)
+	dest, err := statreceiver.NewInfluxDest(server.WriteURL())
+	require.NoError(t, err)
+
+	ts := time.Unix(1600000000, 500)
+	require.NoError(t, dest.Metric("satellite", "sat 1", []byte("function,name=x,scope=y count"), 3, ts))
+	require.NoError(t, dest.Metric("satellite", "sat 1", []byte("nofield"), 4, ts))
+	require.NoError(t, dest.Metric("storagenode", "node", []byte("disk free"), 1.5, ts))
+	require.NoError(t, dest.Close())
+
+	lines := server.Wait(t, 2)
+	require.Equal(t, []statreceivertest.InfluxLine{
+		{
+			Measurement: "function",
+			Tags:        map[string]string{"application": "satellite", "instance": "sat 1", "name": "x", "scope": "y"},
+			Fields:      map[string]float64{"count": 3},
+			TS:          time.Unix(1600000000, 0),
+		},
+		{
+			Measurement: "disk",
+			Tags:        map[string]string{"application": "storagenode", "instance": "node"},
+			Fields:      map[string]float64{"free": 1.5},
+			TS:          time.Unix(1600000000, 0),
+		},
+	}, lines)
+}
+
+func TestInfluxDest_Errors(t *testing.T) {
+	server := statreceivertest.NewInfluxServer(t)
+	dest, err := statreceiver.NewInfluxDest(server.WriteURL())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, dest.Close()) }()
+	ts := time.Now()
+
+	// internal errors are retried.
+	server.Fail(http.StatusInternalServerError, 2)
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 1, ts))
+	require.NoError(t, dest.Flush())
+	require.Len(t, server.Lines(), 1)
+	require.Equal(t, 3, server.Requests())
+
+	// too large batches are dropped.
+	server.Fail(http.StatusRequestEntityTooLarge, 1)
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 2, ts))
+	err = dest.Flush()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "413")
+	require.False(t, dest.Health().Healthy)
+
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 3, ts))
+	require.NoError(t, dest.Flush())
+	lines := server.Lines()
+	require.Len(t, lines, 2)
+	require.Equal(t, 3.0, lines[1].Fields["value"])
+	require.True(t, dest.Health().Healthy)
+}
+
+func TestInfluxDest_Latency(t *testing.T) {
+	server := statreceivertest.NewInfluxServer(t)
+	server.SetLatency(100 * time.Millisecond)
+	dest, err := statreceiver.NewInfluxDest(server.WriteURL())
+	require.NoError(t, err)
+
+	// metrics are buffered, so a slow server doesn't slow down the pipeline.
+	start := time.Now()
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 1, time.Now()))
+	require.True(t, time.Since(start) < 100*time.Millisecond)
+
+	require.NoError(t, dest.Close())
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+	require.Len(t, server.Lines(), 1)
+}
+
+func TestInfluxMultiDest_Failover(t *testing.T) {
+	primary := statreceivertest.NewInfluxServer(t)
+	secondary := statreceivertest.NewInfluxServer(t)
+	dest, err := statreceiver.NewInfluxMultiDest("failover", primary.WriteURL(), secondary.WriteURL())
+	require.NoError(t, err)
+	ts := time.Now()
+
+	require.NoError(t, dest.Metric("app", "inst", []byte("m first"), 1, ts))
+	primary.Fail(http.StatusServiceUnavailable, 1)
+	require.Error(t, dest.Flush())
+	require.Empty(t, primary.Lines())
+	// the destination still reaches the secondary.
+	require.Empty(t, dest.SinkStatus().LastError)
+
+	// the primary is unhealthy, so metrics go to the secondary while the
+	// failed batch is retried.
+	require.NoError(t, dest.Metric("app", "inst", []byte("m second"), 2, ts))
+	require.NoError(t, dest.Flush())
+	require.NoError(t, dest.Close())
+
+	require.Len(t, primary.Lines(), 1)
+	require.Contains(t, primary.Lines()[0].Fields, "first")
+	require.Len(t, secondary.Lines(), 1)
+	require.Contains(t, secondary.Lines()[0].Fields, "second")
+}
+
+func TestInfluxMultiDest_Replicate(t *testing.T) {
+	servers := []*statreceivertest.InfluxServer{
+		statreceivertest.NewInfluxServer(t),
+		statreceivertest.NewInfluxServer(t),
+	}
+	dest, err := statreceiver.NewInfluxMultiDest("replicate", servers[0].WriteURL(), servers[1].WriteURL())
+	require.NoError(t, err)
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 1, time.Now()))
+	require.NoError(t, dest.Close())
+
+	for _, server := range servers {
+		require.Len(t, server.Lines(), 1)
+	}
+}
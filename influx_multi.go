@@ -0,0 +1,202 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"hash/fnv"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// influxRetryLimit is the number of bytes each endpoint of an InfluxMultiDest
+// keeps around for retrying failed writes.
+const influxRetryLimit = 64 << 20
+
+// influxRingReplicas is the number of points each endpoint gets on the
+// consistent hash ring.
+const influxRingReplicas = 128
+
+// InfluxMultiDest is a MetricDest that sends data with the Influx TCP wire
+// protocol to several endpoints. Every endpoint has its own buffer and retry
+// queue, so a slow or unavailable endpoint does not affect the others.
+//
+// The mode decides where each metric goes:
+//
+//   - "replicate" sends every metric to every endpoint.
+//   - "failover" sends every metric to the first healthy endpoint, in the
+//     order they were given. If none are healthy, the first one is used.
+//   - "shard" sends every series to a single endpoint picked by consistent
+//     hashing of the measurement and tags.
+type InfluxMultiDest struct {
+	mode      string
+	endpoints []*influxEndpoint
+	ring      []influxRingPoint
+}
+
+type influxRingPoint struct {
+	hash     uint64
+	endpoint int
+}
+
+// NewInfluxMultiDest creates an InfluxMultiDest with the given mode and stats
+// URLs. Like NewInfluxDest, it starts flushing every endpoint every few
+// seconds. Use Close to stop it.
+func NewInfluxMultiDest(mode string, writeURLs ...string) (*InfluxMultiDest, error) {
+	switch mode {
+	case "replicate", "failover", "shard":
+	default:
+		return nil, errs.New("influx mode %q not supported", mode)
+	}
+	if len(writeURLs) == 0 {
+		return nil, errs.New("at least one influx url is required")
+	}
+
+	rv := &InfluxMultiDest{mode: mode}
+	for _, writeURL := range writeURLs {
+		endpoint, err := newInfluxEndpoint(writeURL, influxRetryLimit)
+		if err != nil {
+			return nil, err
+		}
+		rv.endpoints = append(rv.endpoints, endpoint)
+	}
+
+	if mode == "shard" {
+		for i, endpoint := range rv.endpoints {
+			for replica := 0; replica < influxRingReplicas; replica++ {
+				rv.ring = append(rv.ring, influxRingPoint{
+					hash:     influxHash([]byte(endpoint.url + "#" + strconv.Itoa(replica))),
+					endpoint: i,
+				})
+			}
+		}
+		sort.Slice(rv.ring, func(i, j int) bool { return rv.ring[i].hash < rv.ring[j].hash })
+	}
+
+	for _, endpoint := range rv.endpoints {
+		go endpoint.run()
+	}
+	return rv, nil
+}
+
+var _ MetricDest = (*InfluxMultiDest)(nil)
+
+// Metric implements MetricDest.
+func (d *InfluxMultiDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	line, ok := appendInfluxLine(nil, application, instance, key, val, ts)
+	if !ok {
+		log.Printf("influx metric dropped: %q", key)
+		return nil
+	}
+
+	switch d.mode {
+	case "replicate":
+		for _, endpoint := range d.endpoints {
+			endpoint.write(line)
+		}
+	case "failover":
+		d.failover().write(line)
+	case "shard":
+		d.shard(line).write(line)
+	}
+	return nil
+}
+
+// failover returns the first healthy endpoint, or the primary if there is
+// none.
+func (d *InfluxMultiDest) failover() *influxEndpoint {
+	for _, endpoint := range d.endpoints {
+		if endpoint.healthy() {
+			return endpoint
+		}
+	}
+	return d.endpoints[0]
+}
+
+// shard returns the endpoint responsible for the series of the line.
+func (d *InfluxMultiDest) shard(line []byte) *influxEndpoint {
+	// the series is everything up to the first unescaped space, which
+	// includes the application and instance tags.
+	series := line
+	for i := 1; i < len(line); i++ {
+		if line[i] == ' ' && line[i-1] != '\\' {
+			series = line[:i]
+			break
+		}
+	}
+
+	hash := influxHash(series)
+	i := sort.Search(len(d.ring), func(i int) bool { return d.ring[i].hash >= hash })
+	if i == len(d.ring) {
+		i = 0
+	}
+	return d.endpoints[d.ring[i].endpoint]
+}
+
+// influxHash hashes data for placement on the ring. FNV alone clusters
+// similar inputs, so the result is passed through the splitmix64 finalizer.
+func influxHash(data []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Health returns the current state of every endpoint, in the order they were
+// given.
+func (d *InfluxMultiDest) Health() []InfluxEndpointHealth {
+	health := make([]InfluxEndpointHealth, 0, len(d.endpoints))
+	for _, endpoint := range d.endpoints {
+		health = append(health, endpoint.Health())
+	}
+	return health
+}
+
+// SinkStatus implements Sink. The destination counts as failing only while
+// all of its endpoints are.
+func (d *InfluxMultiDest) SinkStatus() SinkStatus {
+	var status SinkStatus
+	var failing []string
+	for _, endpoint := range d.endpoints {
+		health := endpoint.Health()
+		if health.LastSuccess.After(status.LastFlush) {
+			status.LastFlush = health.LastSuccess
+		}
+		if !health.Healthy {
+			failing = append(failing, health.URL+": "+health.LastError)
+		}
+	}
+	if len(failing) == len(d.endpoints) {
+		status.LastError = strings.Join(failing, "; ")
+	}
+	return status
+}
+
+// Flush sends pending data of every endpoint now. It returns the errors of
+// the endpoints that are unhealthy afterwards.
+func (d *InfluxMultiDest) Flush() error {
+	var group errs.Group
+	for _, endpoint := range d.endpoints {
+		group.Add(endpoint.Flush())
+	}
+	return group.Err()
+}
+
+// Close stops the flushing goroutines.
+func (d *InfluxMultiDest) Close() error {
+	var group errs.Group
+	for _, endpoint := range d.endpoints {
+		group.Add(endpoint.Close())
+	}
+	return group.Err()
+}
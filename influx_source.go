@@ -0,0 +1,205 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// InfluxSource is a MetricSource that accepts the Influx line protocol.
+//
+// Every numeric or boolean field becomes a metric with a monkit v3 shaped key
+// made from the measurement, the tags and the field name. String fields are
+// skipped.
+type InfluxSource struct {
+	*lineSource
+
+	application    string
+	instance       string
+	applicationTag string
+	instanceTag    string
+	precision      time.Duration
+}
+
+// NewInfluxSource creates an InfluxSource listening on address. The
+// following options are supported:
+//
+//   - network=tcp|udp selects the transport (default tcp).
+//   - application=NAME sets the application of metrics without the
+//     application tag (default influx).
+//   - instance=NAME sets the instance of metrics without the instance tag
+//     (default empty).
+//   - application_tag=TAG takes the application from the tag TAG, removing
+//     the tag (default application).
+//   - instance_tag=TAG does the same for the instance (default instance).
+//   - precision=ns|us|ms|s sets the unit of timestamps (default ns).
+//
+// The defaults match what influx destinations write, so statreceivers can be
+// chained.
+func NewInfluxSource(address string, opts ...string) (*InfluxSource, error) {
+	o := parseOptions(opts)
+	network := o.String("network", "tcp")
+	precision := o.String("precision", "ns")
+	rv := &InfluxSource{
+		application:    o.String("application", "influx"),
+		instance:       o.String("instance", ""),
+		applicationTag: o.String("application_tag", "application"),
+		instanceTag:    o.String("instance_tag", "instance"),
+	}
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	switch precision {
+	case "ns":
+		rv.precision = time.Nanosecond
+	case "us":
+		rv.precision = time.Microsecond
+	case "ms":
+		rv.precision = time.Millisecond
+	case "s":
+		rv.precision = time.Second
+	default:
+		return nil, errs.New("influx precision %q not supported", precision)
+	}
+
+	source, err := newLineSource("influx", network, address, rv.parse)
+	if err != nil {
+		return nil, err
+	}
+	rv.lineSource = source
+	return rv, nil
+}
+
+var _ MetricSource = (*InfluxSource)(nil)
+
+func (s *InfluxSource) parse(line []byte, now time.Time) ([]Metric, error) {
+	if line[0] == '#' {
+		return nil, nil
+	}
+
+	sections := splitInfluxLine(string(line), ' ', true)
+	if len(sections) != 2 && len(sections) != 3 {
+		return nil, errs.New("expected measurement, fields and timestamp")
+	}
+
+	ts := now
+	if len(sections) == 3 {
+		n, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, errs.New("invalid timestamp %q", sections[2])
+		}
+		ts = time.Unix(0, n*int64(s.precision))
+	}
+
+	application, instance := s.application, s.instance
+	series := splitInfluxLine(sections[0], ',', false)
+	measurement := unescapeInflux(series[0])
+	if measurement == "" {
+		return nil, errs.New("missing measurement")
+	}
+	var tags []keyTag
+	for _, tag := range series[1:] {
+		kv := splitInfluxLine(tag, '=', false)
+		if len(kv) != 2 {
+			return nil, errs.New("invalid tag %q", tag)
+		}
+		name, value := unescapeInflux(kv[0]), unescapeInflux(kv[1])
+		switch name {
+		case s.applicationTag:
+			application = value
+		case s.instanceTag:
+			instance = value
+		default:
+			tags = append(tags, keyTag{name: name, value: value})
+		}
+	}
+
+	var out []Metric
+	for _, field := range splitInfluxLine(sections[1], ',', true) {
+		kv := splitInfluxLine(field, '=', true)
+		if len(kv) != 2 {
+			return nil, errs.New("invalid field %q", field)
+		}
+		val, ok, err := parseInfluxValue(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		out = append(out, Metric{
+			Application: application,
+			Instance:    instance,
+			Key:         makeV3Key(measurement, tags, unescapeInflux(kv[0])),
+			Val:         val,
+			TS:          ts,
+		})
+	}
+	return out, nil
+}
+
+// parseInfluxValue parses a field value. ok is false for string fields.
+func parseInfluxValue(raw string) (val float64, ok bool, err error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		return 0, false, nil
+	}
+	if strings.HasSuffix(raw, "i") || strings.HasSuffix(raw, "u") {
+		raw = raw[:len(raw)-1]
+	}
+	val, err = strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, errs.New("invalid field value %q", raw)
+	}
+	return val, true, nil
+}
+
+// splitInfluxLine splits s on unescaped occurrences of sep. If quotes is true,
+// separators inside double quoted strings are ignored. Escapes are kept.
+func splitInfluxLine(s string, sep byte, quotes bool) (parts []string) {
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quotes:
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+			// only the first '=' separates a field name from its value.
+			if sep == '=' {
+				return append(parts, s[start:])
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeInflux removes the backslash escapes of a measurement, tag or field
+// name.
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+)
+
+func TestInfluxSource(t *testing.T) {
+	source, err := statreceiver.NewInfluxSource("127.0.0.1:0", "network=udp", "precision=s")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	conn, err := net.Dial("udp", source.Addr().String())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	_, err = conn.Write([]byte(`function_times,application=sat,instance=n1,name=a\ b,scope=x count=3i,ok=t,msg="a, b=c",p50=1.5 1600000000` + "\n"))
+	require.NoError(t, err)
+
+	var got []statreceiver.Metric
+	for len(got) < 3 {
+		m, err := source.NextMetric()
+		require.NoError(t, err)
+		got = append(got, m)
+	}
+
+	for _, m := range got {
+		require.Equal(t, "sat", m.Application)
+		require.Equal(t, "n1", m.Instance)
+		require.Equal(t, time.Unix(1600000000, 0), m.TS)
+	}
+	require.Equal(t, `function_times,name=a\ b,scope=x count`, string(got[0].Key))
+	require.Equal(t, 3.0, got[0].Val)
+	require.Equal(t, `function_times,name=a\ b,scope=x ok`, string(got[1].Key))
+	require.Equal(t, 1.0, got[1].Val)
+	require.Equal(t, `function_times,name=a\ b,scope=x p50`, string(got[2].Key))
+	require.Equal(t, 1.5, got[2].Val)
+}
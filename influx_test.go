@@ -4,22 +4,189 @@
 package statreceiver
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewInfluxDest_URLRedacted(t *testing.T) {
 	t.Run("with password", func(t *testing.T) {
 		const writeURL = "http://influx-host.test/write?u=username&p=pass"
-		influx := NewInfluxDest(writeURL)
+		influx, err := NewInfluxDest(writeURL)
+		require.NoError(t, err)
 		assert.NotContains(t, influx.urlRedacted, "p=pass")
 		assert.Contains(t, influx.urlRedacted, "p=REDACTED")
 	})
 
 	t.Run("without password", func(t *testing.T) {
 		const writeURL = "http://influx-host.test/write?u=username"
-		influx := NewInfluxDest(writeURL)
+		influx, err := NewInfluxDest(writeURL)
+		require.NoError(t, err)
 		assert.Equal(t, writeURL, influx.urlRedacted)
 	})
 }
+
+func TestAppendInfluxLine(t *testing.T) {
+	ts := time.Unix(1600000000, 500)
+
+	for _, tt := range []struct {
+		application, instance, key string
+		val                        float64
+		line                       string
+	}{
+		{
+			"app", "inst 1", "function,name=x count", 3,
+			"function,application=app,instance=inst\\ 1,name=x count=3 1600000000000000000\n",
+		},
+		{
+			"app", "inst", "measurement value", 0.5,
+			"measurement,application=app,instance=inst value=0.5 1600000000000000000\n",
+		},
+		{
+			"a,b", "c=d", "m,tag=v field", -1e21,
+			"m,application=a\\,b,instance=c\\=d,tag=v field=-1e+21 1600000000000000000\n",
+		},
+		{
+			"app", "inst", "escaped\\ name,tag=v value", 1,
+			"escaped\\ name,application=app,instance=inst,tag=v value=1 1600000000000000000\n",
+		},
+		{"app", "inst", "nofield", 3, ""},
+		{"app", "inst", " leading", 3, ""},
+		{"app", "inst", ",leading", 3, ""},
+	} {
+		line, ok := appendInfluxLine(nil, tt.application, tt.instance, []byte(tt.key), tt.val, ts)
+		assert.Equal(t, tt.line != "", ok, tt.key)
+		assert.Equal(t, tt.line, string(line), tt.key)
+	}
+}
+
+func TestInfluxMultiDest_Shard(t *testing.T) {
+	dest, err := NewInfluxMultiDest("shard",
+		"http://influx-a.test/write",
+		"http://influx-b.test/write",
+		"http://influx-c.test/write")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, dest.Close()) }()
+
+	used := map[*influxEndpoint]bool{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("measurement,series=%d", i)
+		line, ok := appendInfluxLine(nil, "app", "inst", []byte(key+" value"), 1, time.Now())
+		assert.True(t, ok)
+		other, ok := appendInfluxLine(nil, "app", "inst", []byte(key+" other"), 2, time.Now())
+		assert.True(t, ok)
+
+		endpoint := dest.shard(line)
+		assert.Equal(t, endpoint, dest.shard(other), "fields of a series go to the same endpoint")
+		used[endpoint] = true
+	}
+	assert.Len(t, used, 3)
+}
+
+func TestInfluxMultiDest_FailoverOrder(t *testing.T) {
+	dest, err := NewInfluxMultiDest("failover",
+		"http://influx-a.test/write",
+		"http://influx-b.test/write",
+		"http://influx-c.test/write")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, dest.Close()) }()
+
+	a, b, c := dest.endpoints[0], dest.endpoints[1], dest.endpoints[2]
+	assert.Equal(t, a, dest.failover())
+
+	a.failures = 1
+	assert.Equal(t, b, dest.failover())
+
+	b.failures = 1
+	assert.Equal(t, c, dest.failover())
+
+	// without a healthy endpoint, the primary is used.
+	c.failures = 1
+	assert.Equal(t, a, dest.failover())
+
+	// the primary is used again as soon as it recovers.
+	a.failures = 0
+	assert.Equal(t, a, dest.failover())
+}
+
+func TestInfluxMultiDest_ReplicateBuffers(t *testing.T) {
+	dest, err := NewInfluxMultiDest("replicate",
+		"http://influx-a.test/write",
+		"http://influx-b.test/write")
+	require.NoError(t, err)
+	defer func() {
+		for _, endpoint := range dest.endpoints {
+			endpoint.buf.Reset()
+		}
+		assert.NoError(t, dest.Close())
+	}()
+
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 1, ts))
+	require.NoError(t, dest.Metric("app", "inst", []byte("nofield"), 1, ts))
+
+	for _, endpoint := range dest.endpoints {
+		assert.Equal(t, "m,application=app,instance=inst value=1 1600000000000000000\n", endpoint.buf.String())
+	}
+}
+
+func TestInfluxEndpoint_RetryQueue(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	fail := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if fail > 0 {
+			fail--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	endpoint, err := newInfluxEndpoint(server.URL+"/write", influxRetryLimit)
+	require.NoError(t, err)
+
+	// a failed batch stays queued and is sent before newer data.
+	endpoint.write([]byte("first\n"))
+	require.Error(t, endpoint.Flush())
+	assert.False(t, endpoint.Health().Healthy)
+	assert.Equal(t, len("first\n"), endpoint.Health().QueuedBytes)
+
+	endpoint.write([]byte("second\n"))
+	require.NoError(t, endpoint.Flush())
+	assert.Equal(t, []string{"first\n", "second\n"}, bodies)
+	assert.True(t, endpoint.Health().Healthy)
+	assert.Zero(t, endpoint.Health().QueuedBytes)
+	require.NoError(t, endpoint.Close())
+}
+
+func TestInfluxEndpoint_RetryLimit(t *testing.T) {
+	endpoint, err := newInfluxEndpoint("http://influx.test/write", 10)
+	require.NoError(t, err)
+
+	// the oldest batches are dropped once the queue is over the limit, but
+	// the newest is always kept.
+	endpoint.enqueue([]byte("aaaaaa"))
+	endpoint.enqueue([]byte("bbbb"))
+	assert.Equal(t, [][]byte{[]byte("aaaaaa"), []byte("bbbb")}, endpoint.queue)
+
+	endpoint.enqueue([]byte("cc"))
+	assert.Equal(t, [][]byte{[]byte("bbbb"), []byte("cc")}, endpoint.queue)
+	assert.Equal(t, 6, endpoint.queued)
+
+	endpoint.enqueue([]byte("dddddddddddd"))
+	assert.Equal(t, [][]byte{[]byte("dddddddddddd")}, endpoint.queue)
+	assert.Equal(t, 12, endpoint.queued)
+}
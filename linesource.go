@@ -0,0 +1,218 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// lineSourceMaxLine is the longest line a lineSource accepts on a TCP
+// connection.
+const lineSourceMaxLine = 1024 * 1024
+
+// lineSource listens for newline separated text over TCP or UDP and turns
+// every line into metrics with parse. TCP connections are throttled when the
+// queue is full; UDP packets are dropped.
+type lineSource struct {
+	name  string
+	parse func(line []byte, now time.Time) ([]Metric, error)
+	queue *metricQueue
+
+	listener net.Listener
+	conn     net.PacketConn
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func newLineSource(name, network, address string, parse func(line []byte, now time.Time) ([]Metric, error)) (*lineSource, error) {
+	s := &lineSource{
+		name:  name,
+		parse: parse,
+		queue: newMetricQueue(name, 100),
+		conns: map[net.Conn]struct{}{},
+		stop:  make(chan struct{}),
+	}
+
+	switch network {
+	case "tcp":
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		s.listener = listener
+		s.stopped.Add(1)
+		go s.accept()
+	case "udp":
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+		s.stopped.Add(1)
+		go s.readPackets()
+	default:
+		return nil, fmt.Errorf("%s network %q not supported", name, network)
+	}
+	return s, nil
+}
+
+// Addr returns the address the source is listening on.
+func (s *lineSource) Addr() net.Addr {
+	if s.listener != nil {
+		return s.listener.Addr()
+	}
+	return s.conn.LocalAddr()
+}
+
+// NextMetric implements MetricSource.
+func (s *lineSource) NextMetric() (Metric, error) {
+	return s.queue.next()
+}
+
+// Close stops listening, closes open connections and makes NextMetric fail
+// once the queued metrics are consumed.
+func (s *lineSource) Close() (err error) {
+	close(s.stop)
+	if s.listener != nil {
+		err = s.listener.Close()
+	} else {
+		err = s.conn.Close()
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.stopped.Wait()
+	s.queue.close()
+	return err
+}
+
+func (s *lineSource) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *lineSource) accept() {
+	defer s.stopped.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.stopping() {
+				return
+			}
+			log.Printf("failed accepting %s connection: %v", s.name, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.stopping() {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.stopped.Add(1)
+		s.mu.Unlock()
+
+		go s.readConn(conn)
+	}
+}
+
+func (s *lineSource) readConn(conn net.Conn) {
+	defer s.stopped.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	// the metrics of every read are queued right away, so clients sending
+	// now and then on a long lived connection aren't held back.
+	buf := make([]byte, 64*1024)
+	var partial []byte
+	for {
+		n, err := conn.Read(buf)
+		data := append(partial, buf[:n]...)
+		partial = nil
+		// keep an unfinished last line for the next read, unless there is
+		// none.
+		if end := bytes.LastIndexByte(data, '\n'); err == nil && end >= 0 {
+			partial = append(partial, data[end+1:]...)
+			data = data[:end]
+		} else if err == nil {
+			partial, data = data, nil
+		}
+		if len(partial) > lineSourceMaxLine {
+			log.Printf("%s line from %s is too long", s.name, conn.RemoteAddr())
+			return
+		}
+		if !s.queue.pushWait(s.lines(data, time.Now()), s.stop) {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !s.stopping() {
+				log.Printf("failed reading %s connection from %s: %v", s.name, conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+func (s *lineSource) readPackets() {
+	defer s.stopped.Done()
+
+	var buf [64 * 1024]byte
+	for {
+		n, _, err := s.conn.ReadFrom(buf[:])
+		if err != nil {
+			if s.stopping() {
+				return
+			}
+			log.Printf("failed reading %s packet: %v", s.name, err)
+			continue
+		}
+		batch := s.lines(buf[:n], time.Now())
+		if !s.queue.push(batch) {
+			log.Printf("%s queue full, dropped %d metrics", s.name, len(batch))
+		}
+	}
+}
+
+// lines parses every non empty line in data, logging the invalid ones.
+func (s *lineSource) lines(data []byte, now time.Time) (out []Metric) {
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		metrics, err := s.parse(line, now)
+		if err != nil {
+			log.Printf("invalid %s line %q: %v", s.name, line, err)
+			continue
+		}
+		out = append(out, metrics...)
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package luacfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lua "github.com/Shopify/go-lua"
+)
+
+// AddPath adds directories to search for modules loaded with require. The
+// directory of the script is searched first, then these directories in
+// order, then the default Lua path.
+func (scope *Scope) AddPath(dirs ...string) {
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	scope.path = append(scope.path, dirs...)
+}
+
+// SetVar sets key to value in the vars table of the script, like a
+// command-line --var key=value.
+func (scope *Scope) SetVar(key, value string) {
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	scope.vars[key] = value
+}
+
+// openBuiltins sets up the package path and the functions and values luacfg
+// provides to every script:
+//
+//   - vars is a table of the values set with SetVar.
+//   - include(path) runs another script and returns its results.
+//   - secret(path) returns the contents of a file without trailing newlines,
+//     like a password mounted by a secret manager.
+//   - expand(s) replaces ${name} and $name in s with vars[name], or the
+//     environment variable name if there is no such var.
+//
+// Relative paths are relative to the directory of the calling script.
+func openBuiltins(l *lua.State, name string, path []string, vars map[string]string) {
+	templates := make([]string, 0, 2*len(path)+3)
+	for _, dir := range append([]string{filepath.Dir(name)}, path...) {
+		templates = append(templates,
+			filepath.Join(dir, "?.lua"),
+			filepath.Join(dir, "?", "init.lua"))
+	}
+	l.Global("package")
+	l.Field(-1, "path")
+	if def, ok := l.ToString(-1); ok && def != "" {
+		templates = append(templates, def)
+	}
+	l.Pop(1)
+	l.PushString(strings.Join(templates, ";"))
+	l.SetField(-2, "path")
+	l.Pop(1)
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	l.CreateTable(0, len(vars))
+	for _, key := range keys {
+		l.PushString(vars[key])
+		l.SetField(-2, key)
+	}
+	l.SetGlobal("vars")
+
+	including := map[string]bool{}
+	l.Register("include", func(l *lua.State) int {
+		path := callerPath(l, lua.CheckString(l, 1))
+		if including[path] {
+			lua.Errorf(l, "%s includes itself", path)
+		}
+		including[path] = true
+		defer delete(including, path)
+
+		top := l.Top()
+		if err := lua.LoadFile(l, path, "t"); err != nil {
+			msg, _ := l.ToString(-1)
+			lua.Errorf(l, "%s", msg)
+		}
+		l.Call(0, lua.MultipleReturns)
+		return l.Top() - top
+	})
+
+	l.Register("secret", func(l *lua.State) int {
+		data, err := ioutil.ReadFile(callerPath(l, lua.CheckString(l, 1)))
+		if err != nil {
+			lua.Errorf(l, "%s", err.Error())
+		}
+		l.PushString(strings.TrimRight(string(data), "\r\n"))
+		return 1
+	})
+
+	l.Register("expand", func(l *lua.State) int {
+		var missing []string
+		expanded := os.Expand(lua.CheckString(l, 1), func(key string) string {
+			if val, ok := vars[key]; ok {
+				return val
+			}
+			if val, ok := os.LookupEnv(key); ok {
+				return val
+			}
+			missing = append(missing, key)
+			return ""
+		})
+		if len(missing) > 0 {
+			lua.Errorf(l, "undefined variables %s", strings.Join(missing, ", "))
+		}
+		l.PushString(expanded)
+		return 1
+	})
+}
+
+// callerPath resolves path relative to the directory of the script calling
+// the current function.
+func callerPath(l *lua.State, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if frame, ok := lua.Stack(l, 1); ok {
+		if info, ok := lua.Info(l, "S", frame); ok && strings.HasPrefix(info.Source, "@") {
+			return filepath.Join(filepath.Dir(info.Source[1:]), path)
+		}
+	}
+	return path
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"reflect"
 	"sync"
 
 	lua "github.com/Shopify/go-lua"
@@ -17,12 +18,15 @@ import (
 type Scope struct {
 	mu            sync.Mutex
 	registrations map[string]func(*lua.State) error
+	path          []string
+	vars          map[string]string
 }
 
 // NewScope creates an empty Scope.
 func NewScope() *Scope {
 	return &Scope{
 		registrations: map[string]func(*lua.State) error{},
+		vars:          map[string]string{},
 	}
 }
 
@@ -33,11 +37,103 @@ func (scope *Scope) RegisterType(name string, example interface{}) error {
 }
 
 // RegisterVal adds the Go value 'value', including Go functions, to the Lua
-// scope.
+// scope. Functions whose last result is an error, like constructors, don't
+// return that error to Lua. Instead, a non-nil error raises a Lua error, which
+// stops the script with the error and the line of the script that called the
+// function. Lua functions can be passed for arguments of type *Function.
 func (scope *Scope) RegisterVal(name string, value interface{}) error {
+	if fn := reflect.ValueOf(value); needsWrapping(fn) {
+		value = wrap(fn)
+	}
 	return scope.register(name, value, luar.PushValue)
 }
 
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	functionType = reflect.TypeOf((*Function)(nil))
+)
+
+// ReturnsError reports whether typ is a function type whose last result is an
+// error, like constructors.
+func ReturnsError(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func && typ.NumOut() > 0 && typ.Out(typ.NumOut()-1) == errorType
+}
+
+// needsWrapping reports whether fn is a function whose last result is an
+// error or that takes a *Function.
+func needsWrapping(fn reflect.Value) bool {
+	if fn.Kind() != reflect.Func {
+		return false
+	}
+	typ := fn.Type()
+	if ReturnsError(typ) {
+		return true
+	}
+	for i := 0; i < typ.NumIn(); i++ {
+		if typ.In(i) == functionType || (typ.IsVariadic() && i == typ.NumIn()-1 && typ.In(i).Elem() == functionType) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap converts fn into a function luar calls with the Lua state, which
+// converts Lua function arguments into a *Function and raises a non-nil error
+// result in the state instead of returning it.
+func wrap(fn reflect.Value) func(l *lua.State) int {
+	typ := fn.Type()
+	returnsError := ReturnsError(typ)
+
+	return func(l *lua.State) int {
+		// the first value is the called function itself.
+		args := make([]reflect.Value, l.Top()-1)
+		expected := typ.NumIn()
+		if typ.IsVariadic() {
+			if len(args) < expected-1 {
+				lua.Errorf(l, "wrong number of arguments: got %d, expected %d or more", len(args), expected-1)
+			}
+		} else if len(args) != expected {
+			lua.Errorf(l, "wrong number of arguments: got %d, expected %d", len(args), expected)
+		}
+
+		for i := range args {
+			var hint reflect.Type
+			if typ.IsVariadic() && i >= expected-1 {
+				hint = typ.In(expected - 1).Elem()
+			} else {
+				hint = typ.In(i)
+			}
+
+			var err error
+			if hint == functionType && !l.IsNil(i+2) {
+				var function *Function
+				function, err = NewFunction(l, i+2)
+				args[i] = reflect.ValueOf(function)
+			} else {
+				args[i], err = luar.ToReflectedValue(l, i+2, hint)
+			}
+			if err != nil {
+				lua.Errorf(l, "argument %d: %s", i+1, err.Error())
+			}
+		}
+
+		results := fn.Call(args)
+		if returnsError {
+			if err, _ := results[len(results)-1].Interface().(error); err != nil {
+				// Errorf prefixes the position of the calling script line.
+				lua.Errorf(l, "%s", err.Error())
+			}
+			results = results[:len(results)-1]
+		}
+		for _, result := range results {
+			if err := luar.PushReflectedValue(l, result); err != nil {
+				lua.Errorf(l, "%s", err.Error())
+			}
+		}
+		return len(results)
+	}
+}
+
 func (scope *Scope) register(name string, val interface{}, pusher func(l *lua.State, val interface{}) error) error {
 	scope.mu.Lock()
 	defer scope.mu.Unlock()
@@ -59,6 +155,13 @@ func (scope *Scope) register(name string, val interface{}, pusher func(l *lua.St
 
 // Run runs the Lua source represented by the reader called in.
 func (scope *Scope) Run(in io.Reader) error {
+	return scope.RunNamed("config", in)
+}
+
+// RunNamed is like Run, but errors refer to the Lua source as name, such as
+// the path it was read from, e.g. "pipeline.lua:12: invalid option". Modules,
+// includes and secrets are found relative to the directory of name.
+func (scope *Scope) RunNamed(name string, in io.Reader) error {
 	l := lua.NewState()
 	lua.OpenLibraries(l)
 	luar.SetOptions(l, luar.Options{AllowUnexportedAccess: true})
@@ -68,8 +171,15 @@ func (scope *Scope) Run(in io.Reader) error {
 	for _, reg := range scope.registrations {
 		registrations = append(registrations, reg)
 	}
+	path := append([]string(nil), scope.path...)
+	vars := make(map[string]string, len(scope.vars))
+	for key, val := range scope.vars {
+		vars[key] = val
+	}
 	scope.mu.Unlock()
 
+	openBuiltins(l, name, path, vars)
+
 	for _, reg := range registrations {
 		err := reg(l)
 		if err != nil {
@@ -82,6 +192,15 @@ func (scope *Scope) Run(in io.Reader) error {
 		return err
 	}
 
-	err = lua.DoString(l, string(data))
-	return err
+	// the @ prefix makes Lua use name as is in error positions.
+	err = lua.LoadBuffer(l, string(data), "@"+name, "")
+	if err != nil {
+		// the position of syntax errors is only in the message Lua left on
+		// the stack.
+		if msg, ok := l.ToString(-1); ok {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return l.ProtectedCall(0, lua.MultipleReturns, 0)
 }
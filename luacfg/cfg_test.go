@@ -5,7 +5,15 @@ package luacfg_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
 
 	"storj.io/statreceiver/luacfg"
 )
@@ -25,3 +33,71 @@ func Example() {
 
 	// Output: hello
 }
+
+func TestRunNamed_Errors(t *testing.T) {
+	scope := luacfg.NewScope()
+	var created []string
+	require.NoError(t, scope.RegisterVal("ctor", func(name string, opts ...string) (*strings.Builder, error) {
+		if name == "" {
+			return nil, errors.New("name is required")
+		}
+		created = append(created, name)
+		return &strings.Builder{}, nil
+	}))
+
+	err := scope.RunNamed("pipeline.lua", strings.NewReader("a = ctor('a', 'x=1')\nassert(a ~= nil)\nb = ctor('')\nctor('c')"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pipeline.lua:3: name is required")
+	require.Equal(t, []string{"a"}, created)
+
+	err = scope.RunNamed("pipeline.lua", strings.NewReader("\na = ctor("))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pipeline.lua:2:")
+}
+
+func TestRunNamed_Modules(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(t.TempDir(), "lib")
+	write := func(path, data string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+	}
+	write(filepath.Join(lib, "filters.lua"), `return {satellite = "^satellite-" .. vars.env .. "$"}`)
+	write(filepath.Join(dir, "common", "urls.lua"), `influx_url = expand("http://${INFLUX_HOST}/write?p=") .. secret("../secrets/influx")`)
+	write(filepath.Join(dir, "secrets", "influx"), "hunter2\n")
+	write(filepath.Join(dir, "main.lua"), `
+filters = require "filters"
+include "common/urls.lua"
+set("filter", filters.satellite)
+set("url", influx_url)
+`)
+
+	scope := luacfg.NewScope()
+	scope.AddPath(lib)
+	scope.SetVar("env", "prod")
+	scope.SetVar("INFLUX_HOST", "influx:8086")
+	got := map[string]string{}
+	require.NoError(t, scope.RegisterVal("set", func(key, val string) { got[key] = val }))
+
+	main := filepath.Join(dir, "main.lua")
+	f, err := os.Open(main)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, f.Close()) }()
+	require.NoError(t, scope.RunNamed(main, f))
+	require.Equal(t, map[string]string{
+		"filter": "^satellite-prod$",
+		"url":    "http://influx:8086/write?p=hunter2",
+	}, got)
+
+	write(filepath.Join(dir, "loop.lua"), `include "loop.lua"`)
+	write(filepath.Join(dir, "errors.lua"), "\nx = expand('$UNDEFINED_STATRECEIVER_VAR')")
+	for file, msg := range map[string]string{
+		"loop.lua":   "loop.lua:1: " + filepath.Join(dir, "loop.lua") + " includes itself",
+		"errors.lua": "errors.lua:2: undefined variables UNDEFINED_STATRECEIVER_VAR",
+	} {
+		path := filepath.Join(dir, file)
+		err := scope.RunNamed(path, strings.NewReader(`include "`+file+`"`))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), msg)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package luacfg
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"sync"
+
+	lua "github.com/Shopify/go-lua"
+	"github.com/zeebo/errs"
+)
+
+// maxTableDepth limits how deeply nested tables are converted, which also
+// stops cyclic tables.
+const maxTableDepth = 16
+
+// env marks the upvalue holding the global environment of a function.
+type env struct{}
+
+// Function is a Lua function of a script that can be called from any
+// goroutine. A Lua state can't be used by several goroutines at once, so the
+// function runs in a pool of states that only have the standard libraries
+// opened. Locals of the script the function uses are copied into every state
+// when they are nil, booleans, numbers, strings or tables of them. Globals of
+// the script are not available.
+//
+// Registered Go functions taking a *Function accept Lua functions for it.
+type Function struct {
+	chunk    []byte
+	upvalues []interface{}
+
+	mu   sync.Mutex
+	idle []*lua.State
+}
+
+// NewFunction creates a Function from the Lua function at index of l.
+func NewFunction(l *lua.State, index int) (*Function, error) {
+	index = l.AbsIndex(index)
+	if !l.IsFunction(index) || l.IsGoFunction(index) {
+		return nil, errs.New("Lua function expected, got %s", lua.TypeNameOf(l, index))
+	}
+
+	fn := &Function{}
+	for i := 1; ; i++ {
+		name, ok := lua.UpValue(l, index, i)
+		if !ok {
+			break
+		}
+		if name == "_ENV" {
+			fn.upvalues = append(fn.upvalues, env{})
+			l.Pop(1)
+			continue
+		}
+		val, err := toGo(l, -1, 0)
+		l.Pop(1)
+		if err != nil {
+			return nil, errs.New("function uses %s: %v", name, err)
+		}
+		fn.upvalues = append(fn.upvalues, val)
+	}
+
+	var buf bytes.Buffer
+	l.PushValue(index)
+	err := l.Dump(&buf)
+	l.Pop(1)
+	if err != nil {
+		return nil, err
+	}
+	fn.chunk = buf.Bytes()
+	return fn, nil
+}
+
+// Call calls the function with args and returns its results. Arguments can
+// be nil, booleans, numbers, strings, []interface{} for sequences and
+// map[string]interface{} for other tables. Results are nil, bool, float64,
+// string, []interface{} or map[string]interface{}. A table is a sequence when
+// its keys are exactly 1 to n.
+func (fn *Function) Call(args ...interface{}) (results []interface{}, err error) {
+	l, err := fn.get()
+	if err != nil {
+		return nil, err
+	}
+	defer fn.put(l)
+
+	l.PushValue(1)
+	for _, arg := range args {
+		if err := pushGo(l, arg, 0); err != nil {
+			l.SetTop(1)
+			return nil, err
+		}
+	}
+	if err := l.ProtectedCall(len(args), lua.MultipleReturns, 0); err != nil {
+		l.SetTop(1)
+		return nil, err
+	}
+	defer l.SetTop(1)
+
+	results = make([]interface{}, 0, l.Top()-1)
+	for i := 2; i <= l.Top(); i++ {
+		val, err := toGo(l, i, 0)
+		if err != nil {
+			return nil, errs.New("result %d: %v", i-1, err)
+		}
+		results = append(results, val)
+	}
+	return results, nil
+}
+
+// get returns an idle state, or a new one, with the function at index 1.
+func (fn *Function) get() (*lua.State, error) {
+	fn.mu.Lock()
+	if n := len(fn.idle); n > 0 {
+		l := fn.idle[n-1]
+		fn.idle = fn.idle[:n-1]
+		fn.mu.Unlock()
+		return l, nil
+	}
+	fn.mu.Unlock()
+
+	l := lua.NewState()
+	lua.OpenLibraries(l)
+	if err := l.Load(bytes.NewReader(fn.chunk), "function", "b"); err != nil {
+		return nil, err
+	}
+	for i, val := range fn.upvalues {
+		if _, ok := val.(env); ok {
+			l.PushGlobalTable()
+		} else if err := pushGo(l, val, 0); err != nil {
+			return nil, err
+		}
+		lua.SetUpValue(l, 1, i+1)
+	}
+	return l, nil
+}
+
+// put returns a state to the idle ones.
+func (fn *Function) put(l *lua.State) {
+	fn.mu.Lock()
+	defer fn.mu.Unlock()
+	fn.idle = append(fn.idle, l)
+}
+
+// toGo converts the Lua value at index of l.
+func toGo(l *lua.State, index, depth int) (interface{}, error) {
+	switch l.TypeOf(index) {
+	case lua.TypeNil, lua.TypeNone:
+		return nil, nil
+	case lua.TypeBoolean:
+		return l.ToBoolean(index), nil
+	case lua.TypeNumber:
+		val, _ := l.ToNumber(index)
+		return val, nil
+	case lua.TypeString:
+		val, _ := l.ToString(index)
+		return val, nil
+	case lua.TypeTable:
+		if depth >= maxTableDepth {
+			return nil, errs.New("tables nested too deeply")
+		}
+		index = l.AbsIndex(index)
+		table := map[string]interface{}{}
+		numbers := 0
+		l.PushNil()
+		for l.Next(index) {
+			// converting the key in place would confuse Next.
+			l.PushValue(-2)
+			if l.TypeOf(-1) == lua.TypeNumber {
+				numbers++
+			}
+			key, ok := l.ToString(-1)
+			if !ok {
+				typ := lua.TypeNameOf(l, -1)
+				l.Pop(3)
+				return nil, errs.New("unsupported table key of type %s", typ)
+			}
+			l.Pop(1)
+			val, err := toGo(l, -1, depth+1)
+			if err != nil {
+				l.Pop(2)
+				return nil, err
+			}
+			table[key] = val
+			l.Pop(1)
+		}
+		if seq, ok := sequence(table, numbers); ok {
+			return seq, nil
+		}
+		return table, nil
+	default:
+		return nil, errs.New("unsupported value of type %s", lua.TypeNameOf(l, index))
+	}
+}
+
+// sequence returns the values of table in order if its keys, of which numbers
+// were numbers, are exactly 1 to n. Like in Lua, the empty table is the empty
+// sequence.
+func sequence(table map[string]interface{}, numbers int) ([]interface{}, bool) {
+	if numbers != len(table) {
+		return nil, false
+	}
+	seq := make([]interface{}, len(table))
+	for i := range seq {
+		val, ok := table[strconv.Itoa(i+1)]
+		if !ok {
+			return nil, false
+		}
+		seq[i] = val
+	}
+	return seq, true
+}
+
+// pushGo pushes a value converted by toGo back onto the stack of l.
+func pushGo(l *lua.State, val interface{}, depth int) error {
+	switch val := val.(type) {
+	case nil:
+		l.PushNil()
+	case bool:
+		l.PushBoolean(val)
+	case float64:
+		l.PushNumber(val)
+	case int:
+		l.PushInteger(val)
+	case int64:
+		l.PushNumber(float64(val))
+	case string:
+		l.PushString(val)
+	case []byte:
+		l.PushString(string(val))
+	case []interface{}:
+		if depth >= maxTableDepth {
+			return errs.New("tables nested too deeply")
+		}
+		l.CreateTable(len(val), 0)
+		for i, elem := range val {
+			if err := pushGo(l, elem, depth+1); err != nil {
+				l.Pop(1)
+				return err
+			}
+			l.RawSetInt(-2, i+1)
+		}
+	case map[string]interface{}:
+		if depth >= maxTableDepth {
+			return errs.New("tables nested too deeply")
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		l.CreateTable(0, len(val))
+		for _, key := range keys {
+			if err := pushGo(l, val[key], depth+1); err != nil {
+				l.Pop(1)
+				return err
+			}
+			l.SetField(-2, key)
+		}
+	default:
+		return errs.New("unsupported value of type %T", val)
+	}
+	return nil
+}
+
+// ParseFunction creates a Function from the source of a Lua function
+// expression, like "function(app) return app == 'satellite' end", for
+// configurations that aren't Lua scripts. name is used in error positions.
+func ParseFunction(name, src string) (*Function, error) {
+	l := lua.NewState()
+	if err := lua.LoadBuffer(l, "return "+src, "@"+name, ""); err != nil {
+		if msg, ok := l.ToString(-1); ok {
+			return nil, errs.New("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	if err := l.ProtectedCall(0, 1, 0); err != nil {
+		return nil, err
+	}
+	return NewFunction(l, -1)
+}
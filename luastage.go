@@ -0,0 +1,220 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver/luacfg"
+)
+
+// LuaError is the class of errors of Lua stages.
+var LuaError = errs.Class("lua")
+
+// LuaStats describes the calls of a Lua stage to its function.
+type LuaStats struct {
+	Calls  int64
+	Errors int64
+	// Total is the time spent in all calls, and Max in the slowest one.
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average time of a call.
+func (s LuaStats) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// luaStage calls a Lua function for every metric and keeps stats of the
+// calls. The function receives the application, instance, key, value and
+// timestamp in seconds since the epoch.
+type luaStage struct {
+	fn   *luacfg.Function
+	dest MetricDest
+
+	// stats are updated atomically, so calls don't contend on a lock.
+	calls  int64
+	errors int64
+	total  int64
+	max    int64
+}
+
+func newLuaStage(name string, fn *luacfg.Function, dest MetricDest) (*luaStage, error) {
+	if fn == nil {
+		return nil, LuaError.New("%s requires a function", name)
+	}
+	return &luaStage{fn: fn, dest: dest}, nil
+}
+
+func (s *luaStage) call(application, instance string, key []byte, val float64, ts time.Time) ([]interface{}, error) {
+	start := time.Now()
+	results, err := s.fn.Call(application, instance, key, val, float64(ts.UnixNano())/1e9)
+	elapsed := int64(time.Since(start))
+
+	atomic.AddInt64(&s.calls, 1)
+	atomic.AddInt64(&s.total, elapsed)
+	for max := atomic.LoadInt64(&s.max); elapsed > max; max = atomic.LoadInt64(&s.max) {
+		if atomic.CompareAndSwapInt64(&s.max, max, elapsed) {
+			break
+		}
+	}
+	if err != nil {
+		atomic.AddInt64(&s.errors, 1)
+		return nil, LuaError.Wrap(err)
+	}
+	return results, nil
+}
+
+// Stats returns the stats of the calls so far.
+func (s *luaStage) Stats() LuaStats {
+	return LuaStats{
+		Calls:  atomic.LoadInt64(&s.calls),
+		Errors: atomic.LoadInt64(&s.errors),
+		Total:  time.Duration(atomic.LoadInt64(&s.total)),
+		Max:    time.Duration(atomic.LoadInt64(&s.max)),
+	}
+}
+
+// LuaFilter is a MetricDest that only passes the metrics a Lua function
+// returns true for. The function is called like
+//
+//	fn(application, instance, key, value, ts)
+//
+// with ts in seconds since the epoch. Returning nil, false or nothing drops
+// the metric.
+type LuaFilter struct {
+	*luaStage
+}
+
+var _ MetricDest = (*LuaFilter)(nil)
+
+// NewLuaFilter creates a LuaFilter that sends the metrics fn keeps to dest.
+func NewLuaFilter(fn *luacfg.Function, dest MetricDest) (*LuaFilter, error) {
+	stage, err := newLuaStage("luafilter", fn, dest)
+	if err != nil {
+		return nil, err
+	}
+	return &LuaFilter{luaStage: stage}, nil
+}
+
+// Metric implements MetricDest.
+func (f *LuaFilter) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	results, err := f.call(application, instance, key, val, ts)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 || results[0] == nil || results[0] == false {
+		return nil
+	}
+	return f.dest.Metric(application, instance, key, val, ts)
+}
+
+// LuaMap is a MetricDest that sends the metrics a Lua function rewrites a
+// metric into. The function is called like LuaFilter's and returns zero or
+// more results. true passes the metric unchanged, nil and false are skipped,
+// and a table is a new metric with the fields application, instance, key,
+// value and ts, where missing fields are the ones of the original metric. A
+// sequence of such results, like {{key = "a"}, {key = "b"}}, is handled like
+// the results themselves, so the empty table {} sends nothing.
+type LuaMap struct {
+	*luaStage
+}
+
+var _ MetricDest = (*LuaMap)(nil)
+
+// NewLuaMap creates a LuaMap that sends the metrics fn returns to dest.
+func NewLuaMap(fn *luacfg.Function, dest MetricDest) (*LuaMap, error) {
+	stage, err := newLuaStage("luamap", fn, dest)
+	if err != nil {
+		return nil, err
+	}
+	return &LuaMap{luaStage: stage}, nil
+}
+
+// Metric implements MetricDest.
+func (m *LuaMap) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	results, err := m.call(application, instance, key, val, ts)
+	if err != nil {
+		return err
+	}
+
+	original := Metric{
+		Application: application,
+		Instance:    instance,
+		Key:         key,
+		Val:         val,
+		TS:          ts,
+	}
+	var group errs.Group
+	for _, result := range results {
+		m.send(result, original, &group, 0)
+	}
+	return group.Err()
+}
+
+// send sends the metrics of a result of the function, rewriting original,
+// adding errors to group. depth is the nesting of result in sequences.
+func (m *LuaMap) send(result interface{}, original Metric, group *errs.Group, depth int) {
+	switch result := result.(type) {
+	case nil:
+	case bool:
+		if result {
+			group.Add(m.dest.Metric(original.Application, original.Instance, original.Key, original.Val, original.TS))
+		}
+	case map[string]interface{}:
+		metric, err := luaMetric(result, original)
+		if err != nil {
+			group.Add(err)
+			return
+		}
+		group.Add(m.dest.Metric(metric.Application, metric.Instance, metric.Key, metric.Val, metric.TS))
+	case []interface{}:
+		if depth > 0 {
+			group.Add(LuaError.New("luamap returned nested sequences, expected a sequence of tables"))
+			return
+		}
+		for _, elem := range result {
+			m.send(elem, original, group, depth+1)
+		}
+	default:
+		group.Add(LuaError.New("luamap returned %T, expected a table or boolean", result))
+	}
+}
+
+// luaMetric returns m with the fields set in table.
+func luaMetric(table map[string]interface{}, m Metric) (Metric, error) {
+	for field, val := range table {
+		var ok bool
+		switch field {
+		case "application":
+			m.Application, ok = val.(string)
+		case "instance":
+			m.Instance, ok = val.(string)
+		case "key":
+			var key string
+			key, ok = val.(string)
+			m.Key = []byte(key)
+		case "value":
+			m.Val, ok = val.(float64)
+		case "ts":
+			var secs float64
+			secs, ok = val.(float64)
+			whole, frac := math.Modf(secs)
+			m.TS = time.Unix(int64(whole), int64(frac*1e9))
+		default:
+			return m, LuaError.New("luamap returned unknown field %q, expected application, instance, key, value or ts", field)
+		}
+		if !ok {
+			return m, LuaError.New("luamap returned %T for field %q", val, field)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/luacfg"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestLuaStages(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	metrics := statreceivertest.NewMetricSource(
+		statreceiver.Metric{Application: "satellite", Instance: "sat-1", Key: []byte("db,scope=x count"), Val: 1, TS: ts},
+		statreceiver.Metric{Application: "satellite", Instance: "sat-1", Key: []byte("http,scope=x count"), Val: 2, TS: ts},
+		statreceiver.Metric{Application: "satellite", Instance: "sat-1", Key: []byte("db,scope=x count"), Val: -1, TS: ts},
+	)
+	filtered := statreceivertest.NewMetricRecorder()
+	mapped := statreceivertest.NewMetricRecorder()
+
+	err := statreceivertest.RunLua(`
+		local prefix = "db,"
+		local renames = {count = "total"}
+		mdeliver(metrics, mcopy(
+			luafilter(function(app, inst, key, val, ts)
+				return key:sub(1, #prefix) == prefix
+			end, filtered),
+			luamap(function(app, inst, key, val, ts)
+				if val < 0 then
+					return
+				end
+				local space = key:find(" ", 1, true)
+				local field = key:sub(space + 1)
+				return true, {key = key:sub(1, space) .. (renames[field] or field), value = val * 2, ts = ts + 60}
+			end, mapped)))
+	`, map[string]interface{}{
+		"metrics":  metrics,
+		"filtered": filtered,
+		"mapped":   mapped,
+	}, time.Second)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"db,scope=x count", "db,scope=x count"}, filtered.Keys())
+	require.Equal(t, []statreceiver.Metric{
+		{Application: "satellite", Instance: "sat-1", Key: []byte("db,scope=x count"), Val: 1, TS: ts},
+		{Application: "satellite", Instance: "sat-1", Key: []byte("db,scope=x total"), Val: 2, TS: ts.Add(time.Minute)},
+		{Application: "satellite", Instance: "sat-1", Key: []byte("http,scope=x count"), Val: 2, TS: ts},
+		{Application: "satellite", Instance: "sat-1", Key: []byte("http,scope=x total"), Val: 4, TS: ts.Add(time.Minute)},
+	}, mapped.Metrics())
+}
+
+// luaFunction returns the Lua function a script passes to get.
+func luaFunction(t *testing.T, script string) *luacfg.Function {
+	var fn *luacfg.Function
+	scope := luacfg.NewScope()
+	require.NoError(t, scope.RegisterVal("get", func(f *luacfg.Function) { fn = f }))
+	require.NoError(t, scope.Run(strings.NewReader(script)))
+	require.NotNil(t, fn)
+	return fn
+}
+
+func TestLuaFilter_Concurrent(t *testing.T) {
+	dest := statreceivertest.NewMetricRecorder()
+	filter, err := statreceiver.NewLuaFilter(luaFunction(t, `get(function(app) return app == "keep" end)`), dest)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				require.NoError(t, filter.Metric("keep", "", []byte("k value"), 1, time.Now()))
+				require.NoError(t, filter.Metric("drop", "", []byte("k value"), 1, time.Now()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, dest.Metrics(), 800)
+	stats := filter.Stats()
+	require.Equal(t, int64(1600), stats.Calls)
+	require.Equal(t, int64(0), stats.Errors)
+	require.True(t, stats.Max >= stats.Mean() && stats.Mean() > 0)
+}
+
+func TestLuaMap_Sequence(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	metrics := statreceivertest.NewMetricSource(
+		statreceiver.Metric{Application: "app", Key: []byte("k"), Val: 1, TS: ts},
+	)
+	dest := statreceivertest.NewMetricRecorder()
+
+	// sequences of the script are copied into the function and returned
+	// sequences are several metrics.
+	err := statreceivertest.RunLua(`
+		local suffixes = {"min", "max"}
+		mdeliver(metrics, luamap(function(app, inst, key, val)
+			local out = {}
+			for i, suffix in ipairs(suffixes) do
+				out[i] = {key = key .. "_" .. suffix, value = val + i}
+			end
+			return out, true
+		end, dest))
+	`, map[string]interface{}{"metrics": metrics, "dest": dest}, time.Second)
+	require.NoError(t, err)
+
+	require.Equal(t, []statreceiver.Metric{
+		{Application: "app", Key: []byte("k_min"), Val: 2, TS: ts},
+		{Application: "app", Key: []byte("k_max"), Val: 3, TS: ts},
+		{Application: "app", Key: []byte("k"), Val: 1, TS: ts},
+	}, dest.Metrics())
+
+	// the empty table is the empty sequence, so nothing is sent.
+	dest = statreceivertest.NewMetricRecorder()
+	mapper, err := statreceiver.NewLuaMap(luaFunction(t, `get(function() return {} end)`), dest)
+	require.NoError(t, err)
+	require.NoError(t, mapper.Metric("app", "", []byte("k value"), 1, ts))
+	require.Empty(t, dest.Metrics())
+}
+
+func TestLuaStages_Errors(t *testing.T) {
+	dest := statreceivertest.NewMetricRecorder()
+
+	filter, err := statreceiver.NewLuaFilter(luaFunction(t, `get(function(app) error("bad " .. app) end)`), dest)
+	require.NoError(t, err)
+	err = filter.Metric("app", "", []byte("k value"), 1, time.Now())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bad app")
+	require.Equal(t, int64(1), filter.Stats().Errors)
+
+	mapper, err := statreceiver.NewLuaMap(luaFunction(t, `get(function() return {value = "x"}, 1 end)`), dest)
+	require.NoError(t, err)
+	err = mapper.Metric("app", "", []byte("k value"), 1, time.Now())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `field "value"`)
+
+	mapper, err = statreceiver.NewLuaMap(luaFunction(t, `get(function() return {{{key = "x"}}} end)`), dest)
+	require.NoError(t, err)
+	err = mapper.Metric("app", "", []byte("k value"), 1, time.Now())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nested sequences")
+
+	mapper, err = statreceiver.NewLuaMap(luaFunction(t, `get(function() return {[1] = {key = "x"}, [3] = {key = "y"}} end)`), dest)
+	require.NoError(t, err)
+	err = mapper.Metric("app", "", []byte("k value"), 1, time.Now())
+	require.Error(t, err)
+	// the unknown field is "1" or "3", depending on map order.
+	require.Contains(t, err.Error(), `unknown field "`)
+	require.Contains(t, err.Error(), `expected application`)
+
+	_, err = statreceiver.NewLuaMap(nil, dest)
+	require.Error(t, err)
+
+	// functions can't use Go values of the script.
+	err = statreceivertest.RunLua("local d = dest\nf = luafilter(function() return d end, dest)",
+		map[string]interface{}{"dest": dest}, time.Second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "config:2:")
+	require.Empty(t, dest.Metrics())
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"io"
+	"sync"
+)
+
+// metricQueue hands batches of metrics produced by background goroutines,
+// like a network listener, to callers of NextMetric.
+type metricQueue struct {
+	name    string
+	batches chan []Metric
+
+	mu      sync.Mutex
+	current []Metric
+
+	closeOnce sync.Once
+}
+
+func newMetricQueue(name string, size int) *metricQueue {
+	return &metricQueue{
+		name:    name,
+		batches: make(chan []Metric, size),
+	}
+}
+
+// push queues a batch without blocking. It returns false if the queue is
+// full. push must not be called after close.
+func (q *metricQueue) push(batch []Metric) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	select {
+	case q.batches <- batch:
+		return true
+	default:
+		return false
+	}
+}
+
+// pushWait queues a batch, waiting for room until cancel is closed. It
+// returns false if cancel was closed first. pushWait must not be called after
+// close.
+func (q *metricQueue) pushWait(batch []Metric, cancel <-chan struct{}) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	select {
+	case q.batches <- batch:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// next returns the next metric, waiting for one if needed. It returns io.EOF
+// once the queue is closed and empty.
+func (q *metricQueue) next() (Metric, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.current) == 0 {
+		batch, ok := <-q.batches
+		if !ok {
+			return Metric{}, io.EOF
+		}
+		q.current = batch
+	}
+	m := q.current[0]
+	q.current = q.current[1:]
+	return m, nil
+}
+
+// close makes next return io.EOF once the queued metrics are consumed.
+func (q *metricQueue) close() {
+	q.closeOnce.Do(func() { close(q.batches) })
+}
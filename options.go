@@ -0,0 +1,157 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/common/memory"
+)
+
+// options holds "name=value" strings passed as trailing arguments to
+// constructors. The Lua bridge can't convert tables into Go values, so this is
+// how optional settings are given in a pipeline configuration, e.g.
+//
+//	graphite("localhost:2004", "protocol=pickle")
+//
+// Conversion errors are collected and reported by Err.
+type options struct {
+	vals map[string]string
+	used map[string]bool
+	errs errs.Group
+}
+
+// parseOptions parses a list of "name=value" strings.
+func parseOptions(opts []string) *options {
+	o := &options{
+		vals: map[string]string{},
+		used: map[string]bool{},
+	}
+	for _, opt := range opts {
+		eq := strings.IndexByte(opt, '=')
+		if eq <= 0 {
+			o.errs.Add(errs.New("invalid option %q: expected name=value", opt))
+			continue
+		}
+		o.vals[opt[:eq]] = opt[eq+1:]
+	}
+	return o
+}
+
+// String returns the named option, or def if it was not given.
+func (o *options) String(name, def string) string {
+	o.used[name] = true
+	if val, ok := o.vals[name]; ok {
+		return val
+	}
+	return def
+}
+
+// Int returns the named option as an integer, or def if it was not given.
+func (o *options) Int(name string, def int) int {
+	val, ok := o.vals[name]
+	o.used[name] = true
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		o.errs.Add(errs.New("invalid option %s=%q: %v", name, val, err))
+		return def
+	}
+	return n
+}
+
+// Bool returns the named option as a boolean, or def if it was not given.
+func (o *options) Bool(name string, def bool) bool {
+	val, ok := o.vals[name]
+	o.used[name] = true
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		o.errs.Add(errs.New("invalid option %s=%q: %v", name, val, err))
+		return def
+	}
+	return b
+}
+
+// Float returns the named option as a float, or def if it was not given.
+func (o *options) Float(name string, def float64) float64 {
+	val, ok := o.vals[name]
+	o.used[name] = true
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		o.errs.Add(errs.New("invalid option %s=%q: %v", name, val, err))
+		return def
+	}
+	return f
+}
+
+// Time returns the named option as an RFC 3339 time, or def if it was not
+// given.
+func (o *options) Time(name string, def time.Time) time.Time {
+	val, ok := o.vals[name]
+	o.used[name] = true
+	if !ok {
+		return def
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		o.errs.Add(errs.New("invalid option %s=%q: %v", name, val, err))
+		return def
+	}
+	return t
+}
+
+// Duration returns the named option as a duration, or def if it was not
+// given.
+func (o *options) Duration(name string, def time.Duration) time.Duration {
+	val, ok := o.vals[name]
+	o.used[name] = true
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		o.errs.Add(errs.New("invalid option %s=%q: %v", name, val, err))
+		return def
+	}
+	return d
+}
+
+// Size returns the named option as a number of bytes, like "64MB" or
+// "1GiB", or def if it was not given.
+func (o *options) Size(name string, def memory.Size) memory.Size {
+	val, ok := o.vals[name]
+	o.used[name] = true
+	if !ok {
+		return def
+	}
+	var size memory.Size
+	if err := size.Set(val); err != nil {
+		o.errs.Add(errs.New("invalid option %s=%q: %v", name, val, err))
+		return def
+	}
+	return size
+}
+
+// Err returns any conversion errors, and an error for every option that was
+// given but never asked for.
+func (o *options) Err() error {
+	for name := range o.vals {
+		if !o.used[name] {
+			o.errs.Add(errs.New("unknown option %q", name))
+		}
+	}
+	return o.errs.Err()
+}
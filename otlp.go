@@ -0,0 +1,271 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zeebo/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"storj.io/common/sync2"
+	"storj.io/statreceiver/otlp"
+)
+
+// OTLPDest is a MetricDest that exports metrics to an OpenTelemetry
+// collector as OTLP gauges, over HTTP/protobuf or gRPC.
+//
+// The application and instance become the service.name and
+// service.instance.id resource attributes. Monkit v3 keys are turned into a
+// metric named measurement.field with the tags as data point attributes;
+// other keys are used as the metric name.
+type OTLPDest struct {
+	*metricBatcher
+
+	endpoint string
+	client   *http.Client
+	conn     *grpc.ClientConn
+}
+
+// NewOTLPDest creates an OTLPDest. For the http protocol, endpoint is a URL
+// and /v1/metrics is used if it has no path. For grpc, it is a host:port.
+// The following options are supported:
+//
+//   - protocol=http|grpc selects the transport (default http).
+//   - tls=true uses TLS for grpc (default false).
+//   - batch=N exports once N metrics are pending (default 5000).
+//   - interval=D exports at least every D (default 5s).
+//   - timeout=D limits each export request (default 10s).
+func NewOTLPDest(endpoint string, opts ...string) (*OTLPDest, error) {
+	o := parseOptions(opts)
+	protocol := o.String("protocol", "http")
+	useTLS := o.Bool("tls", false)
+	batch := o.Int("batch", 5000)
+	interval := o.Duration("interval", 5*time.Second)
+	timeout := o.Duration("timeout", 10*time.Second)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	rv := &OTLPDest{endpoint: endpoint}
+	switch protocol {
+	case "http":
+		parsed, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Path == "" || parsed.Path == "/" {
+			parsed.Path = otlp.HTTPPath
+		}
+		rv.endpoint = parsed.String()
+		rv.client = &http.Client{Timeout: timeout}
+	case "grpc":
+		creds := grpc.WithInsecure()
+		if useTLS {
+			creds = grpc.WithTransportCredentials(credentials.NewTLS(nil))
+		}
+		conn, err := grpc.Dial(endpoint, creds)
+		if err != nil {
+			return nil, err
+		}
+		rv.conn = conn
+	default:
+		return nil, errs.New("otlp protocol %q not supported", protocol)
+	}
+
+	rv.metricBatcher = newMetricBatcher("otlp", batch, interval, true, func(ctx context.Context, batch []Metric) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return rv.export(ctx, batch)
+	})
+	return rv, nil
+}
+
+var _ MetricDest = (*OTLPDest)(nil)
+
+// Metric implements MetricDest.
+func (d *OTLPDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	return d.add(application, instance, key, val, ts)
+}
+
+// Close exports pending metrics and stops the exporting goroutine.
+func (d *OTLPDest) Close() error {
+	err := d.metricBatcher.close()
+	if d.conn != nil {
+		err = errs.Combine(err, d.conn.Close())
+	}
+	return err
+}
+
+// export sends a batch, retrying a few times on errors the collector marks
+// as temporary. Batches the collector permanently rejects, like for a wrong
+// endpoint or credentials, fail with a permanent error, so they are dropped
+// but reported.
+func (d *OTLPDest) export(ctx context.Context, batch []Metric) error {
+	const maxReqs = 4
+	baseDelay := 100 * time.Millisecond
+
+	req := otlpRequest(batch)
+	data := req.Marshal()
+
+	for iteration := 0; ; iteration++ {
+		var resp []byte
+		var retry bool
+		var err error
+		if d.conn != nil {
+			resp, retry, err = d.exportGRPC(ctx, data)
+		} else {
+			resp, retry, err = d.exportHTTP(ctx, data)
+		}
+
+		if err == nil {
+			var parsed otlp.ExportResponse
+			if err := parsed.Unmarshal(resp); err == nil && parsed.RejectedDataPoints > 0 {
+				log.Printf("otlp %s rejected %d data points: %s", d.endpoint, parsed.RejectedDataPoints, parsed.ErrorMessage)
+			}
+			return nil
+		}
+		if !retry {
+			return permanent(err)
+		}
+		if iteration+1 >= maxReqs {
+			return err
+		}
+
+		delay := baseDelay << iteration
+		log.Printf("failed exporting to %s: %v. Retrying %d/%d after %s", d.endpoint, err, iteration+1, maxReqs-1, delay)
+		if !sync2.Sleep(ctx, delay) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *OTLPDest) exportHTTP(ctx context.Context, data []byte) (resp []byte, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", d.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	httpResp, err := d.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer func() { err = errs.Combine(err, httpResp.Body.Close()) }()
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	switch status := httpResp.StatusCode; {
+	case status >= 200 && status < 300:
+		return body, false, nil
+	case status == http.StatusTooManyRequests,
+		status == http.StatusBadGateway,
+		status == http.StatusServiceUnavailable,
+		status == http.StatusGatewayTimeout:
+		return nil, true, errs.New("invalid status code: %d", status)
+	default:
+		return nil, false, errs.New("invalid status code: %d", status)
+	}
+}
+
+func (d *OTLPDest) exportGRPC(ctx context.Context, data []byte) (resp []byte, retry bool, err error) {
+	err = d.conn.Invoke(ctx, otlp.GRPCMethod, &data, &resp, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted,
+			codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+	return resp, false, nil
+}
+
+// otlpRequest converts a batch into an export request with a gauge per
+// metric name and resource.
+func otlpRequest(batch []Metric) *otlp.ExportRequest {
+	type resource struct{ application, instance string }
+
+	req := new(otlp.ExportRequest)
+	resources := map[resource]int{}
+	metrics := map[resource]map[string]int{}
+
+	for _, m := range batch {
+		res := resource{m.Application, m.Instance}
+		ri, ok := resources[res]
+		if !ok {
+			ri = len(req.ResourceMetrics)
+			resources[res] = ri
+			metrics[res] = map[string]int{}
+
+			attrs := []otlp.KeyValue{{Key: otlp.ServiceName, Value: m.Application}}
+			if m.Instance != "" {
+				attrs = append(attrs, otlp.KeyValue{Key: otlp.ServiceInstanceID, Value: m.Instance})
+			}
+			req.ResourceMetrics = append(req.ResourceMetrics, otlp.ResourceMetrics{
+				Resource:     attrs,
+				ScopeMetrics: []otlp.ScopeMetrics{{ScopeName: "storj.io/statreceiver"}},
+			})
+		}
+		scope := &req.ResourceMetrics[ri].ScopeMetrics[0]
+
+		measurement, tags, field := splitV3Key(m.Key)
+		name := measurement
+		if field != "" {
+			name += "." + field
+		}
+
+		mi, ok := metrics[res][name]
+		if !ok {
+			mi = len(scope.Metrics)
+			metrics[res][name] = mi
+			scope.Metrics = append(scope.Metrics, otlp.Metric{Name: name, Gauge: new(otlp.Gauge)})
+		}
+
+		point := otlp.NumberDataPoint{
+			TimeUnixNano: uint64(m.TS.UnixNano()),
+			Value:        m.Val,
+		}
+		for _, tag := range tags {
+			point.Attributes = append(point.Attributes, otlp.KeyValue{Key: tag.name, Value: tag.value})
+		}
+		gauge := scope.Metrics[mi].Gauge
+		gauge.DataPoints = append(gauge.DataPoints, point)
+	}
+	return req
+}
+
+// rawCodec is a gRPC codec that passes already encoded messages through.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.(*[]byte)
+	if !ok {
+		return nil, errs.New("unexpected message type %T", v)
+	}
+	return *data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	dst, ok := v.(*[]byte)
+	if !ok {
+		return errs.New("unexpected message type %T", v)
+	}
+	*dst = append((*dst)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
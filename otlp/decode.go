@@ -0,0 +1,353 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package otlp
+
+import (
+	"math"
+
+	"github.com/zeebo/errs"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Error is the class of decoding errors.
+var Error = errs.Class("otlp")
+
+// Unmarshal decodes a request from the protobuf wire format.
+func (req *ExportRequest) Unmarshal(b []byte) error {
+	*req = ExportRequest{}
+	return walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			var rm ResourceMetrics
+			if err := rm.unmarshal(v); err != nil {
+				return err
+			}
+			req.ResourceMetrics = append(req.ResourceMetrics, rm)
+		}
+		return nil
+	})
+}
+
+// Unmarshal decodes a response from the protobuf wire format.
+func (resp *ExportResponse) Unmarshal(b []byte) error {
+	*resp = ExportResponse{}
+	return walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		return walk(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				resp.RejectedDataPoints = int64(x)
+			case num == 2 && typ == protowire.BytesType:
+				resp.ErrorMessage = string(v)
+			}
+			return nil
+		})
+	})
+}
+
+func (rm *ResourceMetrics) unmarshal(b []byte) error {
+	return walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			return walk(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num != 1 || typ != protowire.BytesType {
+					return nil
+				}
+				kv, err := unmarshalKeyValue(v)
+				if err != nil {
+					return err
+				}
+				rm.Resource = append(rm.Resource, kv)
+				return nil
+			})
+		case 2:
+			var sm ScopeMetrics
+			if err := sm.unmarshal(v); err != nil {
+				return err
+			}
+			rm.ScopeMetrics = append(rm.ScopeMetrics, sm)
+		}
+		return nil
+	})
+}
+
+func (sm *ScopeMetrics) unmarshal(b []byte) error {
+	return walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			return walk(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					sm.ScopeName = string(v)
+				case num == 2 && typ == protowire.BytesType:
+					sm.ScopeVersion = string(v)
+				}
+				return nil
+			})
+		case 2:
+			var m Metric
+			if err := m.unmarshal(v); err != nil {
+				return err
+			}
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		return nil
+	})
+}
+
+func (m *Metric) unmarshal(b []byte) error {
+	return walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			m.Name = string(v)
+		case 2:
+			m.Description = string(v)
+		case 3:
+			m.Unit = string(v)
+		case 5:
+			m.Gauge = new(Gauge)
+			return walkPoints(v, func(p []byte) error {
+				point, err := unmarshalNumberDataPoint(p)
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, point)
+				return err
+			}, nil)
+		case 7:
+			m.Sum = new(Sum)
+			return walkPoints(v, func(p []byte) error {
+				point, err := unmarshalNumberDataPoint(p)
+				m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+				return err
+			}, func(num protowire.Number, x uint64) {
+				switch num {
+				case 2:
+					m.Sum.Temporality = Temporality(x)
+				case 3:
+					m.Sum.Monotonic = x != 0
+				}
+			})
+		case 9:
+			m.Histogram = new(Histogram)
+			return walkPoints(v, func(p []byte) error {
+				point, err := unmarshalHistogramDataPoint(p)
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, point)
+				return err
+			}, func(num protowire.Number, x uint64) {
+				if num == 2 {
+					m.Histogram.Temporality = Temporality(x)
+				}
+			})
+		case 11:
+			m.Summary = new(Summary)
+			return walkPoints(v, func(p []byte) error {
+				point, err := unmarshalSummaryDataPoint(p)
+				m.Summary.DataPoints = append(m.Summary.DataPoints, point)
+				return err
+			}, nil)
+		}
+		return nil
+	})
+}
+
+// walkPoints calls point for every data point (field 1) of a Gauge, Sum,
+// Histogram or Summary message and varint for every varint field.
+func walkPoints(b []byte, point func([]byte) error, varint func(protowire.Number, uint64)) error {
+	return walk(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return point(v)
+		case typ == protowire.VarintType && varint != nil:
+			varint(num, x)
+		}
+		return nil
+	})
+}
+
+func unmarshalNumberDataPoint(b []byte) (p NumberDataPoint, err error) {
+	err = walk(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 2 && typ == protowire.Fixed64Type:
+			p.StartTimeUnixNano = x
+		case num == 3 && typ == protowire.Fixed64Type:
+			p.TimeUnixNano = x
+		case num == 4 && typ == protowire.Fixed64Type:
+			p.Value = math.Float64frombits(x)
+		case num == 6 && typ == protowire.Fixed64Type:
+			p.Value = float64(int64(x))
+		case num == 7 && typ == protowire.BytesType:
+			kv, err := unmarshalKeyValue(v)
+			if err != nil {
+				return err
+			}
+			p.Attributes = append(p.Attributes, kv)
+		}
+		return nil
+	})
+	return p, err
+}
+
+func unmarshalHistogramDataPoint(b []byte) (p HistogramDataPoint, err error) {
+	err = walk(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 2 && typ == protowire.Fixed64Type:
+			p.StartTimeUnixNano = x
+		case num == 3 && typ == protowire.Fixed64Type:
+			p.TimeUnixNano = x
+		case num == 4 && typ == protowire.Fixed64Type:
+			p.Count = x
+		case num == 5 && typ == protowire.Fixed64Type:
+			sum := math.Float64frombits(x)
+			p.Sum = &sum
+		case num == 6:
+			return walkFixed64(typ, v, x, func(x uint64) { p.BucketCounts = append(p.BucketCounts, x) })
+		case num == 7:
+			return walkFixed64(typ, v, x, func(x uint64) {
+				p.ExplicitBounds = append(p.ExplicitBounds, math.Float64frombits(x))
+			})
+		case num == 9 && typ == protowire.BytesType:
+			kv, err := unmarshalKeyValue(v)
+			if err != nil {
+				return err
+			}
+			p.Attributes = append(p.Attributes, kv)
+		case num == 11 && typ == protowire.Fixed64Type:
+			min := math.Float64frombits(x)
+			p.Min = &min
+		case num == 12 && typ == protowire.Fixed64Type:
+			max := math.Float64frombits(x)
+			p.Max = &max
+		}
+		return nil
+	})
+	return p, err
+}
+
+func unmarshalSummaryDataPoint(b []byte) (p SummaryDataPoint, err error) {
+	err = walk(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 2 && typ == protowire.Fixed64Type:
+			p.StartTimeUnixNano = x
+		case num == 3 && typ == protowire.Fixed64Type:
+			p.TimeUnixNano = x
+		case num == 4 && typ == protowire.Fixed64Type:
+			p.Count = x
+		case num == 5 && typ == protowire.Fixed64Type:
+			p.Sum = math.Float64frombits(x)
+		case num == 6 && typ == protowire.BytesType:
+			var q ValueAtQuantile
+			err := walk(v, func(num protowire.Number, typ protowire.Type, _ []byte, x uint64) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					q.Quantile = math.Float64frombits(x)
+				case num == 2 && typ == protowire.Fixed64Type:
+					q.Value = math.Float64frombits(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p.Quantiles = append(p.Quantiles, q)
+		case num == 7 && typ == protowire.BytesType:
+			kv, err := unmarshalKeyValue(v)
+			if err != nil {
+				return err
+			}
+			p.Attributes = append(p.Attributes, kv)
+		}
+		return nil
+	})
+	return p, err
+}
+
+func unmarshalKeyValue(b []byte) (kv KeyValue, err error) {
+	err = walk(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			kv.Key = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			return walk(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					kv.Value = string(v)
+				case num == 2 && typ == protowire.VarintType:
+					kv.Value = x != 0
+				case num == 3 && typ == protowire.VarintType:
+					kv.Value = int64(x)
+				case num == 4 && typ == protowire.Fixed64Type:
+					kv.Value = math.Float64frombits(x)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return kv, err
+}
+
+// walkFixed64 handles a repeated fixed64 or double field, which may be
+// packed or not.
+func walkFixed64(typ protowire.Type, v []byte, x uint64, cb func(uint64)) error {
+	switch typ {
+	case protowire.Fixed64Type:
+		cb(x)
+	case protowire.BytesType:
+		for len(v) > 0 {
+			x, n := protowire.ConsumeFixed64(v)
+			if n < 0 {
+				return Error.Wrap(protowire.ParseError(n))
+			}
+			cb(x)
+			v = v[n:]
+		}
+	}
+	return nil
+}
+
+// walk calls cb for every field in b. Length delimited fields are passed in
+// v and varint and fixed fields in x.
+func walk(b []byte, cb func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return Error.Wrap(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var x32 uint32
+			x32, n = protowire.ConsumeFixed32(b)
+			x = uint64(x32)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return Error.Wrap(protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := cb(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package otlp
+
+import (
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Marshal encodes the request in the protobuf wire format.
+func (req *ExportRequest) Marshal() []byte {
+	var b []byte
+	for i := range req.ResourceMetrics {
+		b = appendMessage(b, 1, req.ResourceMetrics[i].marshal())
+	}
+	return b
+}
+
+// Marshal encodes the response in the protobuf wire format.
+func (resp *ExportResponse) Marshal() []byte {
+	if resp.RejectedDataPoints == 0 && resp.ErrorMessage == "" {
+		return nil
+	}
+	var partial []byte
+	if resp.RejectedDataPoints != 0 {
+		partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+		partial = protowire.AppendVarint(partial, uint64(resp.RejectedDataPoints))
+	}
+	partial = appendString(partial, 2, resp.ErrorMessage)
+	return appendMessage(nil, 1, partial)
+}
+
+func (rm *ResourceMetrics) marshal() []byte {
+	var resource []byte
+	for _, kv := range rm.Resource {
+		resource = appendMessage(resource, 1, kv.marshal())
+	}
+
+	var b []byte
+	b = appendMessage(b, 1, resource)
+	for i := range rm.ScopeMetrics {
+		b = appendMessage(b, 2, rm.ScopeMetrics[i].marshal())
+	}
+	return b
+}
+
+func (sm *ScopeMetrics) marshal() []byte {
+	var scope []byte
+	scope = appendString(scope, 1, sm.ScopeName)
+	scope = appendString(scope, 2, sm.ScopeVersion)
+
+	var b []byte
+	b = appendMessage(b, 1, scope)
+	for i := range sm.Metrics {
+		b = appendMessage(b, 2, sm.Metrics[i].marshal())
+	}
+	return b
+}
+
+func (m *Metric) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Name)
+	b = appendString(b, 2, m.Description)
+	b = appendString(b, 3, m.Unit)
+
+	switch {
+	case m.Gauge != nil:
+		var g []byte
+		for i := range m.Gauge.DataPoints {
+			g = appendMessage(g, 1, m.Gauge.DataPoints[i].marshal())
+		}
+		b = appendMessage(b, 5, g)
+	case m.Sum != nil:
+		var s []byte
+		for i := range m.Sum.DataPoints {
+			s = appendMessage(s, 1, m.Sum.DataPoints[i].marshal())
+		}
+		s = appendVarint(s, 2, uint64(m.Sum.Temporality))
+		if m.Sum.Monotonic {
+			s = appendVarint(s, 3, 1)
+		}
+		b = appendMessage(b, 7, s)
+	case m.Histogram != nil:
+		var h []byte
+		for i := range m.Histogram.DataPoints {
+			h = appendMessage(h, 1, m.Histogram.DataPoints[i].marshal())
+		}
+		h = appendVarint(h, 2, uint64(m.Histogram.Temporality))
+		b = appendMessage(b, 9, h)
+	case m.Summary != nil:
+		var s []byte
+		for i := range m.Summary.DataPoints {
+			s = appendMessage(s, 1, m.Summary.DataPoints[i].marshal())
+		}
+		b = appendMessage(b, 11, s)
+	}
+	return b
+}
+
+func (p *NumberDataPoint) marshal() []byte {
+	var b []byte
+	b = appendFixed64(b, 2, p.StartTimeUnixNano)
+	b = appendFixed64(b, 3, p.TimeUnixNano)
+	b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(p.Value))
+	for _, kv := range p.Attributes {
+		b = appendMessage(b, 7, kv.marshal())
+	}
+	return b
+}
+
+func (p *HistogramDataPoint) marshal() []byte {
+	var b []byte
+	b = appendFixed64(b, 2, p.StartTimeUnixNano)
+	b = appendFixed64(b, 3, p.TimeUnixNano)
+	b = appendFixed64(b, 4, p.Count)
+	if p.Sum != nil {
+		b = appendDouble(b, 5, *p.Sum)
+	}
+	if len(p.BucketCounts) > 0 {
+		var packed []byte
+		for _, c := range p.BucketCounts {
+			packed = protowire.AppendFixed64(packed, c)
+		}
+		b = appendMessage(b, 6, packed)
+	}
+	if len(p.ExplicitBounds) > 0 {
+		var packed []byte
+		for _, bound := range p.ExplicitBounds {
+			packed = protowire.AppendFixed64(packed, math.Float64bits(bound))
+		}
+		b = appendMessage(b, 7, packed)
+	}
+	for _, kv := range p.Attributes {
+		b = appendMessage(b, 9, kv.marshal())
+	}
+	if p.Min != nil {
+		b = appendDouble(b, 11, *p.Min)
+	}
+	if p.Max != nil {
+		b = appendDouble(b, 12, *p.Max)
+	}
+	return b
+}
+
+func (p *SummaryDataPoint) marshal() []byte {
+	var b []byte
+	b = appendFixed64(b, 2, p.StartTimeUnixNano)
+	b = appendFixed64(b, 3, p.TimeUnixNano)
+	b = appendFixed64(b, 4, p.Count)
+	b = appendDouble(b, 5, p.Sum)
+	for _, q := range p.Quantiles {
+		var vq []byte
+		vq = appendDouble(vq, 1, q.Quantile)
+		vq = appendDouble(vq, 2, q.Value)
+		b = appendMessage(b, 6, vq)
+	}
+	for _, kv := range p.Attributes {
+		b = appendMessage(b, 7, kv.marshal())
+	}
+	return b
+}
+
+func (kv *KeyValue) marshal() []byte {
+	var value []byte
+	switch v := kv.Value.(type) {
+	case string:
+		value = protowire.AppendTag(value, 1, protowire.BytesType)
+		value = protowire.AppendString(value, v)
+	case bool:
+		value = protowire.AppendTag(value, 2, protowire.VarintType)
+		value = protowire.AppendVarint(value, protowire.EncodeBool(v))
+	case int64:
+		value = protowire.AppendTag(value, 3, protowire.VarintType)
+		value = protowire.AppendVarint(value, uint64(v))
+	case float64:
+		value = protowire.AppendTag(value, 4, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, math.Float64bits(v))
+	}
+
+	var b []byte
+	b = appendString(b, 1, kv.Key)
+	b = appendMessage(b, 2, value)
+	return b
+}
+
+// FormatValue returns the string form of an attribute value.
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return ""
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
@@ -0,0 +1,148 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package otlp encodes and decodes the subset of OpenTelemetry OTLP metrics
+// export messages that statreceiver deals with, without depending on the
+// generated OpenTelemetry protobuf packages.
+//
+// The types mirror opentelemetry/proto/collector/metrics/v1 and
+// opentelemetry/proto/metrics/v1. Exponential histograms, exemplars and
+// array or key-value list attribute values are skipped when decoding.
+package otlp
+
+// HTTPPath is the path OTLP/HTTP receivers accept metric exports on.
+const HTTPPath = "/v1/metrics"
+
+// GRPCMethod is the full name of the OTLP/gRPC metrics export method.
+const GRPCMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// Resource attribute keys from the OpenTelemetry semantic conventions.
+const (
+	ServiceName       = "service.name"
+	ServiceInstanceID = "service.instance.id"
+)
+
+// ExportRequest is an ExportMetricsServiceRequest.
+type ExportRequest struct {
+	ResourceMetrics []ResourceMetrics
+}
+
+// ExportResponse is an ExportMetricsServiceResponse.
+type ExportResponse struct {
+	RejectedDataPoints int64
+	ErrorMessage       string
+}
+
+// ResourceMetrics is a collection of metrics from a resource.
+type ResourceMetrics struct {
+	Resource     []KeyValue
+	ScopeMetrics []ScopeMetrics
+}
+
+// ScopeMetrics is a collection of metrics from an instrumentation scope.
+type ScopeMetrics struct {
+	ScopeName    string
+	ScopeVersion string
+	Metrics      []Metric
+}
+
+// Temporality is the aggregation temporality of sums and histograms.
+type Temporality int32
+
+// Aggregation temporalities.
+const (
+	TemporalityUnspecified Temporality = 0
+	TemporalityDelta       Temporality = 1
+	TemporalityCumulative  Temporality = 2
+)
+
+// Metric is a named metric with exactly one of Gauge, Sum, Histogram or
+// Summary set.
+type Metric struct {
+	Name        string
+	Description string
+	Unit        string
+
+	Gauge     *Gauge
+	Sum       *Sum
+	Histogram *Histogram
+	Summary   *Summary
+}
+
+// Gauge is a set of values sampled at a point in time.
+type Gauge struct {
+	DataPoints []NumberDataPoint
+}
+
+// Sum is a set of summed values.
+type Sum struct {
+	DataPoints  []NumberDataPoint
+	Temporality Temporality
+	Monotonic   bool
+}
+
+// Histogram is a set of explicit bucket histograms.
+type Histogram struct {
+	DataPoints  []HistogramDataPoint
+	Temporality Temporality
+}
+
+// Summary is a set of quantile summaries.
+type Summary struct {
+	DataPoints []SummaryDataPoint
+}
+
+// NumberDataPoint is a single gauge or sum value. Integer values are
+// converted to floats.
+type NumberDataPoint struct {
+	Attributes        []KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Value             float64
+}
+
+// HistogramDataPoint is a single explicit bucket histogram.
+type HistogramDataPoint struct {
+	Attributes        []KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Count             uint64
+	Sum               *float64
+	BucketCounts      []uint64
+	ExplicitBounds    []float64
+	Min               *float64
+	Max               *float64
+}
+
+// SummaryDataPoint is a single quantile summary.
+type SummaryDataPoint struct {
+	Attributes        []KeyValue
+	StartTimeUnixNano uint64
+	TimeUnixNano      uint64
+	Count             uint64
+	Sum               float64
+	Quantiles         []ValueAtQuantile
+}
+
+// ValueAtQuantile is the value of a summary at a quantile.
+type ValueAtQuantile struct {
+	Quantile float64
+	Value    float64
+}
+
+// KeyValue is an attribute. Only string, bool, int and double values are
+// supported; Value holds a string, bool, int64 or float64 respectively.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Lookup returns the string form of the attribute named key, if present.
+func Lookup(attrs []KeyValue, key string) (string, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return FormatValue(kv.Value), true
+		}
+	}
+	return "", false
+}
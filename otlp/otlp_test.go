@@ -0,0 +1,65 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package otlp_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver/otlp"
+)
+
+func TestRoundTrip(t *testing.T) {
+	sum, min, max := 10.5, 1.0, 4.0
+	req := otlp.ExportRequest{ResourceMetrics: []otlp.ResourceMetrics{{
+		Resource: []otlp.KeyValue{
+			{Key: otlp.ServiceName, Value: "app"},
+			{Key: "flag", Value: true},
+			{Key: "count", Value: int64(-3)},
+			{Key: "ratio", Value: 0.5},
+		},
+		ScopeMetrics: []otlp.ScopeMetrics{{
+			ScopeName:    "scope",
+			ScopeVersion: "v1",
+			Metrics: []otlp.Metric{
+				{Name: "gauge", Unit: "1", Gauge: &otlp.Gauge{DataPoints: []otlp.NumberDataPoint{
+					{TimeUnixNano: 5, Value: 1.5, Attributes: []otlp.KeyValue{{Key: "k", Value: "v"}}},
+				}}},
+				{Name: "sum", Sum: &otlp.Sum{
+					Temporality: otlp.TemporalityCumulative,
+					Monotonic:   true,
+					DataPoints:  []otlp.NumberDataPoint{{StartTimeUnixNano: 1, TimeUnixNano: 5, Value: 7}},
+				}},
+				{Name: "histogram", Histogram: &otlp.Histogram{
+					Temporality: otlp.TemporalityDelta,
+					DataPoints: []otlp.HistogramDataPoint{{
+						TimeUnixNano:   5,
+						Count:          3,
+						Sum:            &sum,
+						BucketCounts:   []uint64{1, 2},
+						ExplicitBounds: []float64{2.5},
+						Min:            &min,
+						Max:            &max,
+					}},
+				}},
+				{Name: "summary", Summary: &otlp.Summary{DataPoints: []otlp.SummaryDataPoint{{
+					TimeUnixNano: 5,
+					Count:        2,
+					Sum:          3,
+					Quantiles:    []otlp.ValueAtQuantile{{Quantile: 0.5, Value: 1}},
+				}}}},
+			},
+		}},
+	}}}
+
+	var decoded otlp.ExportRequest
+	require.NoError(t, decoded.Unmarshal(req.Marshal()))
+	require.Equal(t, req, decoded)
+
+	resp := otlp.ExportResponse{RejectedDataPoints: 2, ErrorMessage: "bad"}
+	var decodedResp otlp.ExportResponse
+	require.NoError(t, decodedResp.Unmarshal(resp.Marshal()))
+	require.Equal(t, resp, decodedResp)
+}
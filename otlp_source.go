@@ -0,0 +1,221 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"storj.io/statreceiver/otlp"
+)
+
+// otlpSourceQueue is the number of export requests an OTLPSource keeps
+// before asking clients to retry later.
+const otlpSourceQueue = 100
+
+// otlpMaxRequestSize limits the size of an export request, both as sent and
+// after decompression.
+const otlpMaxRequestSize = 16 << 20
+
+// OTLPSource is a MetricSource that accepts OTLP/HTTP protobuf metric
+// exports.
+//
+// The resource attribute service.name becomes the application and
+// service.instance.id the instance. Data points become keys shaped like
+// monkit v3 keys, with the metric name as measurement and the point
+// attributes as tags:
+//
+//   - gauge and sum points have the field "value".
+//   - histogram points have the fields "count", "sum", "avg", "min" and
+//     "max", when known.
+//   - summary points have the fields "count", "sum" and a field per quantile
+//     like "p50" or "p99.9".
+//
+// Requests larger than 16 MiB, as sent or after decompression, are refused.
+type OTLPSource struct {
+	server   *http.Server
+	listener net.Listener
+
+	queue *metricQueue
+}
+
+// NewOTLPSource creates an OTLPSource listening for HTTP requests on
+// address.
+func NewOTLPSource(address string) (*OTLPSource, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &OTLPSource{
+		listener: listener,
+		queue:    newMetricQueue("otlp", otlpSourceQueue),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(otlp.HTTPPath, rv.handle)
+	rv.server = &http.Server{Handler: mux}
+
+	go func() {
+		err := rv.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("otlp source %s failed: %v", address, err)
+		}
+	}()
+	return rv, nil
+}
+
+var _ MetricSource = (*OTLPSource)(nil)
+
+// Addr returns the address the source is listening on.
+func (s *OTLPSource) Addr() net.Addr { return s.listener.Addr() }
+
+// NextMetric implements MetricSource.
+func (s *OTLPSource) NextMetric() (Metric, error) {
+	return s.queue.next()
+}
+
+// Close stops the server.
+func (s *OTLPSource) Close() error {
+	// Shutdown waits for running handlers, so nothing sends on the channel
+	// once it returns.
+	err := s.server.Shutdown(context.Background())
+	s.queue.close()
+	return err
+}
+
+func (s *OTLPSource) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", ct), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, otlpMaxRequestSize)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = gz.Close() }()
+		body = gz
+	}
+
+	// a small compressed request can expand into a huge one, so the
+	// decompressed size is limited too.
+	data, err := ioutil.ReadAll(io.LimitReader(body, otlpMaxRequestSize+1))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || len(data) > otlpMaxRequestSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req otlp.ExportRequest
+	if err := req.Unmarshal(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch := otlpMetrics(&req, time.Now())
+
+	if !s.queue.push(batch) {
+		// the collector retries 503s, so nothing gets lost.
+		http.Error(w, "queue full", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write((&otlp.ExportResponse{}).Marshal())
+}
+
+// otlpMetrics converts an export request into metrics. Points without a
+// timestamp get now.
+func otlpMetrics(req *otlp.ExportRequest, now time.Time) []Metric {
+	var out []Metric
+	for _, rm := range req.ResourceMetrics {
+		application, _ := otlp.Lookup(rm.Resource, otlp.ServiceName)
+		instance, _ := otlp.Lookup(rm.Resource, otlp.ServiceInstanceID)
+
+		emit := func(name string, attrs []otlp.KeyValue, field string, val float64, ts uint64) {
+			when := now
+			if ts != 0 {
+				when = time.Unix(0, int64(ts))
+			}
+			out = append(out, Metric{
+				Application: application,
+				Instance:    instance,
+				Key:         otlpKey(name, attrs, field),
+				Val:         val,
+				TS:          when,
+			})
+		}
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				switch {
+				case m.Gauge != nil:
+					for _, p := range m.Gauge.DataPoints {
+						emit(m.Name, p.Attributes, "value", p.Value, p.TimeUnixNano)
+					}
+				case m.Sum != nil:
+					for _, p := range m.Sum.DataPoints {
+						emit(m.Name, p.Attributes, "value", p.Value, p.TimeUnixNano)
+					}
+				case m.Histogram != nil:
+					for _, p := range m.Histogram.DataPoints {
+						emit(m.Name, p.Attributes, "count", float64(p.Count), p.TimeUnixNano)
+						if p.Sum != nil {
+							emit(m.Name, p.Attributes, "sum", *p.Sum, p.TimeUnixNano)
+							if p.Count > 0 {
+								emit(m.Name, p.Attributes, "avg", *p.Sum/float64(p.Count), p.TimeUnixNano)
+							}
+						}
+						if p.Min != nil {
+							emit(m.Name, p.Attributes, "min", *p.Min, p.TimeUnixNano)
+						}
+						if p.Max != nil {
+							emit(m.Name, p.Attributes, "max", *p.Max, p.TimeUnixNano)
+						}
+					}
+				case m.Summary != nil:
+					for _, p := range m.Summary.DataPoints {
+						emit(m.Name, p.Attributes, "count", float64(p.Count), p.TimeUnixNano)
+						emit(m.Name, p.Attributes, "sum", p.Sum, p.TimeUnixNano)
+						for _, q := range p.Quantiles {
+							field := "p" + strconv.FormatFloat(q.Quantile*100, 'f', -1, 64)
+							emit(m.Name, p.Attributes, field, q.Value, p.TimeUnixNano)
+						}
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// otlpKey builds a monkit v3 shaped key from a metric name, attributes and
+// field.
+func otlpKey(name string, attrs []otlp.KeyValue, field string) []byte {
+	tags := make([]keyTag, 0, len(attrs))
+	for _, kv := range attrs {
+		tags = append(tags, keyTag{name: kv.Key, value: otlp.FormatValue(kv.Value)})
+	}
+	return makeV3Key(name, tags, field)
+}
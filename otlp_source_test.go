@@ -0,0 +1,92 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/otlp"
+)
+
+func TestOTLPSource(t *testing.T) {
+	source, err := statreceiver.NewOTLPSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	sum := 10.0
+	ts := uint64(time.Unix(1600000000, 0).UnixNano())
+	req := otlp.ExportRequest{ResourceMetrics: []otlp.ResourceMetrics{{
+		Resource: []otlp.KeyValue{
+			{Key: otlp.ServiceName, Value: "app"},
+			{Key: otlp.ServiceInstanceID, Value: "inst"},
+		},
+		ScopeMetrics: []otlp.ScopeMetrics{{Metrics: []otlp.Metric{
+			{Name: "queue.size", Gauge: &otlp.Gauge{DataPoints: []otlp.NumberDataPoint{
+				{TimeUnixNano: ts, Value: 3, Attributes: []otlp.KeyValue{
+					{Key: "zone", Value: "b"}, {Key: "host", Value: "my host"}}},
+			}}},
+			{Name: "latency", Histogram: &otlp.Histogram{DataPoints: []otlp.HistogramDataPoint{
+				{TimeUnixNano: ts, Count: 4, Sum: &sum},
+			}}},
+		}}},
+	}}}
+
+	resp, err := http.Post("http://"+source.Addr().String()+otlp.HTTPPath,
+		"application/x-protobuf", bytes.NewReader(req.Marshal()))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var keys []string
+	for i := 0; i < 4; i++ {
+		m, err := source.NextMetric()
+		require.NoError(t, err)
+		require.Equal(t, "app", m.Application)
+		require.Equal(t, "inst", m.Instance)
+		require.Equal(t, int64(1600000000), m.TS.Unix())
+		keys = append(keys, string(m.Key))
+	}
+	require.Equal(t, []string{
+		`queue.size,host=my\ host,zone=b value`,
+		"latency count",
+		"latency sum",
+		"latency avg",
+	}, keys)
+}
+
+func TestOTLPSource_TooLarge(t *testing.T) {
+	source, err := statreceiver.NewOTLPSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+	url := "http://" + source.Addr().String() + otlp.HTTPPath
+
+	// 64MiB of zeros compress into a request of less than 100KiB.
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err = gz.Write(make([]byte, 64<<20))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	req, err := http.NewRequest(http.MethodPost, url, &compressed)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = http.Post(url, "application/x-protobuf", bytes.NewReader(make([]byte, 32<<20)))
+	if err == nil {
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/otlp"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestOTLPDest_HTTP(t *testing.T) {
+	requests := make(chan otlp.ExportRequest, 10)
+	failures := 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, otlp.HTTPPath, r.URL.Path)
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req otlp.ExportRequest
+		require.NoError(t, req.Unmarshal(body))
+		requests <- req
+	}))
+	defer server.Close()
+
+	dest, err := statreceiver.NewOTLPDest(server.URL, "interval=1h")
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Metric("app", "inst", []byte("function_times,name=x,scope=y p50"), 1.5, ts))
+	require.NoError(t, dest.Metric("app", "inst", []byte("function_times,name=z,scope=y p50"), 2.5, ts))
+	require.NoError(t, dest.Metric("other", "", []byte("env.process.uptime"), 3, ts))
+	require.NoError(t, dest.Flush())
+	require.NoError(t, dest.Close())
+
+	req := <-requests
+	require.Len(t, req.ResourceMetrics, 2)
+
+	app := req.ResourceMetrics[0]
+	name, _ := otlp.Lookup(app.Resource, otlp.ServiceName)
+	instance, _ := otlp.Lookup(app.Resource, otlp.ServiceInstanceID)
+	require.Equal(t, "app", name)
+	require.Equal(t, "inst", instance)
+	require.Len(t, app.ScopeMetrics[0].Metrics, 1)
+
+	metric := app.ScopeMetrics[0].Metrics[0]
+	require.Equal(t, "function_times.p50", metric.Name)
+	require.NotNil(t, metric.Gauge)
+	require.Len(t, metric.Gauge.DataPoints, 2)
+	point := metric.Gauge.DataPoints[1]
+	require.Equal(t, 2.5, point.Value)
+	require.Equal(t, uint64(ts.UnixNano()), point.TimeUnixNano)
+	tag, _ := otlp.Lookup(point.Attributes, "name")
+	require.Equal(t, "z", tag)
+
+	other := req.ResourceMetrics[1]
+	_, ok := otlp.Lookup(other.Resource, otlp.ServiceInstanceID)
+	require.False(t, ok)
+	require.Equal(t, "env.process.uptime", other.ScopeMetrics[0].Metrics[0].Name)
+}
+
+type rawServerCodec struct{}
+
+func (rawServerCodec) Marshal(v interface{}) ([]byte, error) { return *v.(*[]byte), nil }
+func (rawServerCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+func (rawServerCodec) String() string { return "proto" }
+
+func TestOTLPDest_GRPC(t *testing.T) {
+	requests := make(chan otlp.ExportRequest, 10)
+
+	server := grpc.NewServer(
+		grpc.CustomCodec(rawServerCodec{}), //nolint: staticcheck // raw messages without generated code
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			require.Equal(t, otlp.GRPCMethod, method)
+
+			var data []byte
+			if err := stream.RecvMsg(&data); err != nil {
+				return err
+			}
+			var req otlp.ExportRequest
+			if err := req.Unmarshal(data); err != nil {
+				return err
+			}
+			requests <- req
+
+			resp := (&otlp.ExportResponse{}).Marshal()
+			return stream.SendMsg(&resp)
+		}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(l) }()
+	defer server.Stop()
+
+	dest, err := statreceiver.NewOTLPDest(l.Addr().String(), "protocol=grpc", "interval=1h")
+	require.NoError(t, err)
+	require.NoError(t, dest.Metric("app", "inst", []byte("requests,path=/ count"), 7, time.Now()))
+	require.NoError(t, dest.Flush())
+	require.NoError(t, dest.Close())
+
+	req := <-requests
+	require.Len(t, req.ResourceMetrics, 1)
+	metric := req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	require.Equal(t, "requests.count", metric.Name)
+	require.Equal(t, 7.0, metric.Gauge.DataPoints[0].Value)
+}
+
+func TestOTLPDest_Rejected(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	dest, err := statreceiver.NewOTLPDest(server.URL, "interval=1h")
+	require.NoError(t, err)
+	ts := time.Unix(1600000000, 0)
+	require.NoError(t, dest.Metric("app", "inst", []byte("function_times,name=x,scope=y p50"), 1.5, ts))
+
+	// a permanent rejection isn't retried, but it's reported.
+	require.Error(t, dest.Flush())
+	require.Equal(t, 1, requests)
+	require.NotEmpty(t, dest.SinkStatus().LastError)
+	require.Zero(t, dest.Stats().Pending)
+	require.NoError(t, dest.Close())
+}
+
+func TestOTLPDest_Interval(t *testing.T) {
+	requests := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+	}))
+	defer server.Close()
+
+	clock := statreceivertest.NewClock(time.Unix(1600000000, 0))
+	defer statreceiver.SetClock(clock)()
+	dest, err := statreceiver.NewOTLPDest(server.URL, "interval=1m")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, dest.Close()) }()
+	require.NoError(t, dest.Metric("app", "inst", []byte("m value"), 1, clock.Now()))
+
+	// the metric is written once the flush interval passed on the clock.
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	require.Len(t, requests, 0)
+	now := clock.Advance(time.Minute)
+	<-requests
+	require.Eventually(t, func() bool { return dest.SinkStatus().LastFlush.Equal(now) }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestParser(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	truncated := statreceivertest.EncodePacket("app", "inst", nil, statreceivertest.Value{Key: "a value", Val: 1})
+	truncated = truncated[:len(truncated)-2]
+
+	for _, tt := range []struct {
+		name   string
+		packet []byte
+		keys   []string
+		err    bool
+	}{
+		{
+			name:   "metrics",
+			packet: statreceivertest.EncodePacket("app", "inst", nil, statreceivertest.Value{Key: "a value", Val: 1}, statreceivertest.Value{Key: "b value", Val: 2}),
+			keys:   []string{"a value", "b value"},
+		},
+		{
+			name: "headers are skipped",
+			packet: statreceivertest.EncodePacket("app", "inst", map[string]string{"h1": "v1", "h2": "v2"},
+				statreceivertest.Value{Key: "a value", Val: 1}),
+			keys: []string{"a value"},
+		},
+		{
+			name:   "no metrics",
+			packet: statreceivertest.EncodePacket("app", "inst", nil),
+		},
+		{
+			name:   "special values",
+			packet: statreceivertest.EncodePacket("app", "inst", nil, statreceivertest.Value{Key: "inf value", Val: math.Inf(1)}),
+			keys:   []string{"inf value"},
+		},
+		{name: "bad checksum", packet: truncated, err: true},
+		{name: "empty", packet: nil, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := statreceivertest.NewMetricRecorder()
+			err := statreceiver.NewParser(dest).Packet(tt.packet, ts)
+			if tt.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			dest.RequireKeys(t, tt.keys...)
+			for _, m := range dest.Metrics() {
+				require.Equal(t, "app", m.Application)
+				require.Equal(t, "inst", m.Instance)
+				require.Equal(t, ts, m.TS)
+			}
+		})
+	}
+}
+
+func TestParser_DestError(t *testing.T) {
+	// a failing destination doesn't stop the rest of the packet.
+	dest := statreceivertest.NewMetricRecorder()
+	dest.SetError(errors.New("unavailable"))
+	packet := statreceivertest.EncodePacket("app", "inst", nil,
+		statreceivertest.Value{Key: "a value", Val: 1}, statreceivertest.Value{Key: "b value", Val: 2})
+	require.NoError(t, statreceiver.NewParser(dest).Packet(packet, time.Now()))
+	dest.RequireKeys(t, "a value", "b value")
+}
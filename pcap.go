@@ -0,0 +1,540 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// PcapError is the class of errors reading pcap and pcapng files.
+var PcapError = errs.Class("pcap")
+
+const (
+	// pcapMaxFrame bounds the size of a frame or block, so a corrupt length
+	// doesn't allocate unbounded memory.
+	pcapMaxFrame = 1 << 24
+	// fragmentTimeout is how long, in capture time, fragments wait for the
+	// rest of their datagram.
+	fragmentTimeout = 30 * time.Second
+	// maxFragmented bounds the number of datagrams being reassembled.
+	maxFragmented = 1024
+)
+
+// PcapSource reads the UDP payloads of pcap or pcapng files, like those
+// written by tcpdump, as packets with the capture timestamps. Like
+// FileSource, the path may also be a directory or a glob pattern and
+// compressed files are decompressed. Fragmented IPv4 datagrams are
+// reassembled.
+type PcapSource struct {
+	path string
+	port int
+
+	mu       sync.Mutex
+	resolved bool
+	files    []string
+	current  io.Closer
+	reader   *pcapReader
+	frags    map[fragmentKey]*fragmented
+}
+
+// NewPcapSource creates a PcapSource. With the option port=N only UDP
+// datagrams from or to port N are read, otherwise all are.
+func NewPcapSource(path string, opts ...string) (*PcapSource, error) {
+	o := parseOptions(opts)
+	port := o.Int("port", 0)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	return &PcapSource{
+		path:  path,
+		port:  port,
+		frags: map[fragmentKey]*fragmented{},
+	}, nil
+}
+
+var _ Source = (*PcapSource)(nil)
+
+// Next implements the Source interface. It returns io.EOF after the last
+// file.
+func (p *PcapSource) Next() ([]byte, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.resolved {
+		files, err := captureFiles(p.path)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		p.files, p.resolved = files, true
+	}
+
+	for {
+		if p.reader == nil {
+			if len(p.files) == 0 {
+				return nil, time.Time{}, io.EOF
+			}
+			r, closer, err := openCapture(p.files[0])
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			p.files = p.files[1:]
+			p.current = closer
+			p.reader, err = newPcapReader(r)
+			if err != nil {
+				return nil, time.Time{}, errs.Combine(err, p.closeCurrent())
+			}
+		}
+
+		linkType, frame, ts, err := p.reader.next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if err == io.ErrUnexpectedEOF {
+				log.Printf("pcap file ends with a partial frame, skipping the rest")
+			}
+			if err := p.closeCurrent(); err != nil {
+				return nil, time.Time{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		if data, ok := p.decode(linkType, frame, ts); ok {
+			return data, ts, nil
+		}
+	}
+}
+
+// Close closes the file being read.
+func (p *PcapSource) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.files = nil
+	return p.closeCurrent()
+}
+
+func (p *PcapSource) closeCurrent() error {
+	var err error
+	if p.current != nil {
+		err = p.current.Close()
+	}
+	p.current, p.reader = nil, nil
+	return err
+}
+
+// link types of the frames that can be decoded.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkRawAlt   = 12 // raw IP on some BSDs
+	linkRawOld   = 14
+	linkLoop     = 108
+	linkLinuxSLL = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// decode returns the UDP payload of a frame if it matches the port filter.
+func (p *PcapSource) decode(linkType uint32, frame []byte, ts time.Time) ([]byte, bool) {
+	var ip []byte
+	switch linkType {
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+		etherType, rest := binary.BigEndian.Uint16(frame[12:]), frame[14:]
+		// skip VLAN tags.
+		for (etherType == 0x8100 || etherType == 0x88a8 || etherType == 0x9100) && len(rest) >= 4 {
+			etherType, rest = binary.BigEndian.Uint16(rest[2:]), rest[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return nil, false
+		}
+		ip = rest
+	case linkLinuxSLL:
+		if len(frame) < 16 {
+			return nil, false
+		}
+		ip = frame[16:]
+	case linkSLL2:
+		if len(frame) < 20 {
+			return nil, false
+		}
+		ip = frame[20:]
+	case linkNull, linkLoop:
+		// the address family is in the byte order of the capturing host, so
+		// the IP version is used instead.
+		if len(frame) < 4 {
+			return nil, false
+		}
+		ip = frame[4:]
+	case linkRaw, linkRawAlt, linkRawOld, linkIPv4, linkIPv6:
+		ip = frame
+	default:
+		return nil, false
+	}
+	if len(ip) == 0 {
+		return nil, false
+	}
+
+	var udp []byte
+	switch ip[0] >> 4 {
+	case 4:
+		udp = p.decodeIPv4(ip, ts)
+	case 6:
+		udp = decodeIPv6(ip)
+	}
+	if len(udp) < 8 {
+		return nil, false
+	}
+
+	srcPort, dstPort := int(binary.BigEndian.Uint16(udp)), int(binary.BigEndian.Uint16(udp[2:]))
+	if p.port != 0 && srcPort != p.port && dstPort != p.port {
+		return nil, false
+	}
+	length := int(binary.BigEndian.Uint16(udp[4:]))
+	if length < 8 || length > len(udp) {
+		// truncated by the snapshot length.
+		return nil, false
+	}
+	return udp[8:length], true
+}
+
+// decodeIPv4 returns the UDP datagram of an IPv4 packet, reassembling it if
+// it is fragmented. It returns nil if the packet is not UDP or the datagram is
+// not complete yet.
+func (p *PcapSource) decodeIPv4(ip []byte, ts time.Time) []byte {
+	if len(ip) < 20 {
+		return nil
+	}
+	headerLen := int(ip[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(ip[2:]))
+	if headerLen < 20 || totalLen < headerLen || totalLen > len(ip) {
+		return nil
+	}
+	if ip[9] != 17 {
+		return nil
+	}
+	payload := ip[headerLen:totalLen]
+
+	flags := binary.BigEndian.Uint16(ip[6:])
+	more, offset := flags&0x2000 != 0, int(flags&0x1fff)*8
+	if !more && offset == 0 {
+		return payload
+	}
+
+	var key fragmentKey
+	copy(key.src[:], ip[12:16])
+	copy(key.dst[:], ip[16:20])
+	key.id = binary.BigEndian.Uint16(ip[4:])
+	return p.reassemble(key, offset, more, payload, ts)
+}
+
+// decodeIPv6 returns the UDP datagram of an IPv6 packet, skipping extension
+// headers. Fragmented IPv6 packets are not reassembled.
+func decodeIPv6(ip []byte) []byte {
+	if len(ip) < 40 {
+		return nil
+	}
+	payloadLen := int(binary.BigEndian.Uint16(ip[4:]))
+	if 40+payloadLen > len(ip) {
+		return nil
+	}
+	next, payload := ip[6], ip[40:40+payloadLen]
+	for {
+		switch next {
+		case 17:
+			return payload
+		case 0, 43, 60: // hop-by-hop, routing and destination options
+			if len(payload) < 8 {
+				return nil
+			}
+			n := (int(payload[1]) + 1) * 8
+			if n > len(payload) {
+				return nil
+			}
+			next, payload = payload[0], payload[n:]
+		default:
+			return nil
+		}
+	}
+}
+
+// fragmentKey identifies the fragments of an IPv4 datagram.
+type fragmentKey struct {
+	src, dst [4]byte
+	id       uint16
+}
+
+// fragmented holds the fragments of a datagram received so far.
+type fragmented struct {
+	first time.Time
+	total int // -1 until the last fragment is received
+	parts []fragment
+}
+
+type fragment struct {
+	offset int
+	data   []byte
+}
+
+// reassemble adds a fragment and returns the datagram once all of its
+// fragments were received.
+func (p *PcapSource) reassemble(key fragmentKey, offset int, more bool, data []byte, ts time.Time) []byte {
+	for k, frags := range p.frags {
+		if ts.Sub(frags.first) > fragmentTimeout {
+			delete(p.frags, k)
+		}
+	}
+
+	frags, ok := p.frags[key]
+	if !ok {
+		if len(p.frags) >= maxFragmented {
+			log.Printf("too many fragmented datagrams, dropping fragment")
+			return nil
+		}
+		frags = &fragmented{first: ts, total: -1}
+		p.frags[key] = frags
+	}
+	frags.parts = append(frags.parts, fragment{offset: offset, data: append([]byte(nil), data...)})
+	if !more {
+		frags.total = offset + len(data)
+	}
+	if frags.total < 0 {
+		return nil
+	}
+
+	sort.Slice(frags.parts, func(i, j int) bool { return frags.parts[i].offset < frags.parts[j].offset })
+	covered := 0
+	for _, part := range frags.parts {
+		if part.offset > covered {
+			return nil
+		}
+		if end := part.offset + len(part.data); end > covered {
+			covered = end
+		}
+	}
+	if covered < frags.total {
+		return nil
+	}
+
+	delete(p.frags, key)
+	datagram := make([]byte, frags.total)
+	for _, part := range frags.parts {
+		if part.offset < len(datagram) {
+			copy(datagram[part.offset:], part.data)
+		}
+	}
+	return datagram
+}
+
+// pcapReader reads the frames of a pcap or pcapng file.
+type pcapReader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+
+	// pcap
+	linkType uint32
+	perSec   uint64
+
+	// pcapng
+	interfaces []pcapInterface
+}
+
+// pcapInterface is an interface of a pcapng section.
+type pcapInterface struct {
+	linkType uint32
+	perSec   uint64
+	offset   int64
+}
+
+const pcapngSection = 0x0a0d0d0a
+
+// newPcapReader detects the format of r and reads its header.
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	p := &pcapReader{r: bufio.NewReader(r)}
+	magic, err := p.r.Peek(4)
+	if err != nil {
+		return nil, PcapError.New("reading header: %v", err)
+	}
+
+	switch {
+	case binary.BigEndian.Uint32(magic) == pcapngSection:
+		p.ng = true
+		return p, nil
+	case binary.BigEndian.Uint32(magic) == 0xa1b2c3d4:
+		p.order, p.perSec = binary.BigEndian, 1e6
+	case binary.LittleEndian.Uint32(magic) == 0xa1b2c3d4:
+		p.order, p.perSec = binary.LittleEndian, 1e6
+	case binary.BigEndian.Uint32(magic) == 0xa1b23c4d:
+		p.order, p.perSec = binary.BigEndian, 1e9
+	case binary.LittleEndian.Uint32(magic) == 0xa1b23c4d:
+		p.order, p.perSec = binary.LittleEndian, 1e9
+	default:
+		return nil, PcapError.New("not a pcap or pcapng file")
+	}
+
+	var header [24]byte
+	if _, err := io.ReadFull(p.r, header[:]); err != nil {
+		return nil, PcapError.New("reading header: %v", err)
+	}
+	// the upper bits may hold the FCS length.
+	p.linkType = p.order.Uint32(header[20:]) & 0x0fffffff
+	return p, nil
+}
+
+// next returns the next frame with its link type and capture time.
+func (p *pcapReader) next() (linkType uint32, frame []byte, ts time.Time, err error) {
+	if p.ng {
+		return p.nextBlock()
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(p.r, header[:]); err != nil {
+		return 0, nil, time.Time{}, err
+	}
+	length := p.order.Uint32(header[8:])
+	if length > pcapMaxFrame {
+		return 0, nil, time.Time{}, PcapError.New("frame of %d bytes too large", length)
+	}
+	frame = make([]byte, length)
+	if _, err := io.ReadFull(p.r, frame); err != nil {
+		return 0, nil, time.Time{}, noEOF(err)
+	}
+	ts = time.Unix(int64(p.order.Uint32(header[0:])), int64(uint64(p.order.Uint32(header[4:]))*1e9/p.perSec))
+	return p.linkType, frame, ts, nil
+}
+
+// nextBlock returns the next packet of a pcapng file, reading the section
+// and interface blocks before it.
+func (p *pcapReader) nextBlock() (linkType uint32, frame []byte, ts time.Time, err error) {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(p.r, header[:]); err != nil {
+			return 0, nil, time.Time{}, err
+		}
+		blockType := binary.BigEndian.Uint32(header[:])
+		if blockType == pcapngSection {
+			bom, err := p.r.Peek(4)
+			if err != nil {
+				return 0, nil, time.Time{}, noEOF(err)
+			}
+			switch {
+			case binary.BigEndian.Uint32(bom) == 0x1a2b3c4d:
+				p.order = binary.BigEndian
+			case binary.LittleEndian.Uint32(bom) == 0x1a2b3c4d:
+				p.order = binary.LittleEndian
+			default:
+				return 0, nil, time.Time{}, PcapError.New("invalid byte order magic")
+			}
+			p.interfaces = nil
+		} else {
+			blockType = p.order.Uint32(header[:])
+		}
+
+		length := p.order.Uint32(header[4:])
+		if length < 12 || length%4 != 0 || length > pcapMaxFrame {
+			return 0, nil, time.Time{}, PcapError.New("invalid block length %d", length)
+		}
+		// the body is followed by the length again.
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return 0, nil, time.Time{}, noEOF(err)
+		}
+		body = body[:len(body)-4]
+
+		switch blockType {
+		case 1: // interface description
+			if len(body) < 8 {
+				return 0, nil, time.Time{}, PcapError.New("short interface block")
+			}
+			iface := pcapInterface{linkType: uint32(p.order.Uint16(body)), perSec: 1e6}
+			p.readInterfaceOptions(&iface, body[8:])
+			p.interfaces = append(p.interfaces, iface)
+
+		case 6, 2: // enhanced packet and obsolete packet
+			if len(body) < 20 {
+				return 0, nil, time.Time{}, PcapError.New("short packet block")
+			}
+			var ifaceID uint32
+			if blockType == 6 {
+				ifaceID = p.order.Uint32(body)
+			} else {
+				ifaceID = uint32(p.order.Uint16(body))
+			}
+			if int(ifaceID) >= len(p.interfaces) {
+				return 0, nil, time.Time{}, PcapError.New("packet of unknown interface %d", ifaceID)
+			}
+			capLen := p.order.Uint32(body[12:])
+			if int64(capLen) > int64(len(body)-20) {
+				return 0, nil, time.Time{}, PcapError.New("invalid captured length %d", capLen)
+			}
+			iface := p.interfaces[ifaceID]
+			ticks := uint64(p.order.Uint32(body[4:]))<<32 | uint64(p.order.Uint32(body[8:]))
+			return iface.linkType, body[20 : 20+capLen], iface.time(ticks), nil
+		}
+		// other blocks, like statistics or name resolution, are skipped.
+	}
+}
+
+// readInterfaceOptions reads the timestamp resolution and offset of an
+// interface.
+func (p *pcapReader) readInterfaceOptions(iface *pcapInterface, opts []byte) {
+	for len(opts) >= 4 {
+		code, length := p.order.Uint16(opts), int(p.order.Uint16(opts[2:]))
+		opts = opts[4:]
+		if code == 0 || length > len(opts) {
+			return
+		}
+		val := opts[:length]
+		switch {
+		case code == 9 && length == 1: // if_tsresol
+			exp := uint(val[0] & 0x7f)
+			if val[0]&0x80 != 0 && exp < 64 {
+				iface.perSec = 1 << exp
+			} else if val[0]&0x80 == 0 && exp <= 19 {
+				iface.perSec = 1
+				for i := uint(0); i < exp; i++ {
+					iface.perSec *= 10
+				}
+			}
+		case code == 14 && length == 8: // if_tsoffset
+			iface.offset = int64(p.order.Uint64(val))
+		}
+		if padded := (length + 3) &^ 3; padded <= len(opts) {
+			opts = opts[padded:]
+		} else {
+			return
+		}
+	}
+}
+
+// time converts a timestamp in units of the interface resolution.
+func (iface pcapInterface) time(ticks uint64) time.Time {
+	secs, rem := ticks/iface.perSec, ticks%iface.perSec
+	hi, lo := bits.Mul64(rem, 1e9)
+	nanos, _ := bits.Div64(hi, lo, iface.perSec)
+	return time.Unix(int64(secs)+iface.offset, int64(nanos))
+}
+
+// noEOF turns io.EOF in the middle of a frame into io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+)
+
+// ipv4 builds an IPv4 packet holding payload at the fragment offset.
+func ipv4(id uint16, offset int, more bool, payload []byte) []byte {
+	ip := make([]byte, 20, 20+len(payload))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(payload)))
+	binary.BigEndian.PutUint16(ip[4:], id)
+	flags := uint16(offset / 8)
+	if more {
+		flags |= 0x2000
+	}
+	binary.BigEndian.PutUint16(ip[6:], flags)
+	ip[8], ip[9] = 64, 17
+	copy(ip[12:], []byte{10, 0, 0, 1, 10, 0, 0, 2})
+	return append(ip, payload...)
+}
+
+// udp builds a UDP datagram.
+func udp(srcPort, dstPort uint16, data []byte) []byte {
+	datagram := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint16(datagram[0:], srcPort)
+	binary.BigEndian.PutUint16(datagram[2:], dstPort)
+	binary.BigEndian.PutUint16(datagram[4:], uint16(8+len(data)))
+	return append(datagram, data...)
+}
+
+// ethernet wraps an IPv4 packet in an Ethernet frame with a VLAN tag.
+func ethernet(ip []byte) []byte {
+	frame := make([]byte, 12, 18+len(ip))
+	frame = append(frame, 0x81, 0x00, 0x00, 0x05, 0x08, 0x00)
+	return append(frame, ip...)
+}
+
+func testFrames() [][]byte {
+	big := bytes.Repeat([]byte("fragmented"), 10)
+	datagram := udp(40000, 9000, big)
+	return [][]byte{
+		ethernet(ipv4(1, 0, false, udp(40000, 9000, []byte("first")))),
+		ethernet(ipv4(2, 0, false, udp(40000, 53, []byte("dns")))),
+		// fragments arriving out of order.
+		ethernet(ipv4(3, 64, false, datagram[64:])),
+		ethernet(ipv4(3, 0, true, datagram[:64])),
+		ethernet(ipv4(4, 0, false, udp(9000, 40000, []byte("reply")))),
+	}
+}
+
+func readPcap(t *testing.T, path string, opts ...string) (packets []string, times []time.Time) {
+	source, err := statreceiver.NewPcapSource(path, opts...)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+	for {
+		data, ts, err := source.Next()
+		if err == io.EOF {
+			return packets, times
+		}
+		require.NoError(t, err)
+		packets = append(packets, string(data))
+		times = append(times, ts)
+	}
+}
+
+func TestPcapSource(t *testing.T) {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	buf.Write(header)
+	for i, frame := range testFrames() {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], 1600000000)
+		binary.LittleEndian.PutUint32(record[4:], uint32(i*1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+		buf.Write(record)
+		buf.Write(frame)
+	}
+	// a partial frame at the end is ignored.
+	buf.Write([]byte{1, 2, 3})
+
+	path := filepath.Join(t.TempDir(), "dump.pcap")
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+	packets, times := readPcap(t, path, "port=9000")
+	require.Equal(t, []string{"first", string(bytes.Repeat([]byte("fragmented"), 10)), "reply"}, packets)
+	require.Equal(t, time.Unix(1600000000, 0).UnixNano(), times[0].UnixNano())
+	// a reassembled datagram has the time of its last fragment.
+	require.Equal(t, time.Unix(1600000000, 3000000).UnixNano(), times[1].UnixNano())
+
+	packets, _ = readPcap(t, path)
+	require.Len(t, packets, 4)
+}
+
+func TestPcapSource_Pcapng(t *testing.T) {
+	block := func(blockType uint32, body []byte) []byte {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		b := make([]byte, 8, 12+len(body))
+		binary.BigEndian.PutUint32(b[0:], blockType)
+		binary.BigEndian.PutUint32(b[4:], uint32(12+len(body)))
+		b = append(b, body...)
+		return append(b, b[4:8]...)
+	}
+
+	var buf bytes.Buffer
+	section := []byte{0x1a, 0x2b, 0x3c, 0x4d, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	buf.Write(block(0x0a0d0d0a, section))
+	// a raw IP interface with nanosecond timestamps.
+	buf.Write(block(1, []byte{0, 101, 0, 0, 0, 0, 0, 0, 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0}))
+	// a name resolution block is skipped.
+	buf.Write(block(4, []byte{0, 0, 0, 0}))
+
+	ts := time.Unix(1600000000, 123456789)
+	frame := ipv4(1, 0, false, udp(40000, 9000, []byte("packet")))
+	epb := make([]byte, 20, 20+len(frame))
+	binary.BigEndian.PutUint32(epb[4:], uint32(uint64(ts.UnixNano())>>32))
+	binary.BigEndian.PutUint32(epb[8:], uint32(ts.UnixNano()))
+	binary.BigEndian.PutUint32(epb[12:], uint32(len(frame)))
+	binary.BigEndian.PutUint32(epb[16:], uint32(len(frame)))
+	buf.Write(block(6, append(epb, frame...)))
+
+	path := filepath.Join(t.TempDir(), "dump.pcapng")
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+	packets, times := readPcap(t, path, "port=9000")
+	require.Equal(t, []string{"packet"}, packets)
+	require.Equal(t, ts.UnixNano(), times[0].UnixNano())
+}
+
+func TestPcapSource_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.pcap")
+	require.NoError(t, ioutil.WriteFile(path, []byte("not a pcap file"), 0644))
+	source, err := statreceiver.NewPcapSource(path)
+	require.NoError(t, err)
+	_, _, err = source.Next()
+	require.Error(t, err)
+}
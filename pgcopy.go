@@ -0,0 +1,215 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zeebo/errs"
+)
+
+var pgIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// PostgresCopyDest is a MetricDest that stores every metric as a row of a
+// time-partitioned Postgres table, streaming batches with COPY FROM STDIN.
+//
+// When the TimescaleDB extension is installed, the table is made a
+// hypertable. Otherwise it is a natively partitioned table with a partition
+// per day, created as metrics for that day arrive.
+//
+// The table has the columns time, application, instance, measurement, tags
+// (jsonb), field and value. Monkit v3 keys are split into measurement, tags
+// and field; other keys are stored as the measurement with an empty field.
+//
+// Failed batches are retried, except ones Postgres rejects for their data,
+// like values out of range, which are logged and dropped.
+type PostgresCopyDest struct {
+	*metricBatcher
+
+	db        *sql.DB
+	table     string
+	timescale bool
+
+	mu         sync.Mutex
+	partitions map[string]bool
+}
+
+// NewPostgresCopyDest creates a PostgresCopyDest writing to the database at
+// the given connection string, creating the table if needed. The following
+// options are supported:
+//
+//   - table=NAME sets the table name (default metric_points).
+//   - batch=N flushes once N metrics are pending (default 10000).
+//   - interval=D flushes at least every D (default 5s).
+func NewPostgresCopyDest(address string, opts ...string) (*PostgresCopyDest, error) {
+	o := parseOptions(opts)
+	table := o.String("table", "metric_points")
+	batch := o.Int("batch", 10000)
+	interval := o.Duration("interval", 5*time.Second)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	if !pgIdentifier.MatchString(table) {
+		return nil, errs.New("invalid table name %q", table)
+	}
+
+	db, err := sql.Open("postgres", address)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &PostgresCopyDest{
+		db:         db,
+		table:      table,
+		partitions: map[string]bool{},
+	}
+	if err := rv.createTable(context.Background()); err != nil {
+		return nil, errs.Combine(err, db.Close())
+	}
+	rv.metricBatcher = newMetricBatcher("pgcopy", batch, interval, true, rv.write)
+	return rv, nil
+}
+
+var _ MetricDest = (*PostgresCopyDest)(nil)
+
+// Metric implements MetricDest.
+func (d *PostgresCopyDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	return d.add(application, instance, key, val, ts)
+}
+
+// Close flushes pending metrics, stops the flushing goroutine and closes the
+// database.
+func (d *PostgresCopyDest) Close() error {
+	return errs.Combine(d.metricBatcher.close(), d.db.Close())
+}
+
+// createTable creates the table as a hypertable or a partitioned table,
+// depending on whether TimescaleDB is available.
+func (d *PostgresCopyDest) createTable(ctx context.Context) error {
+	var extensions int
+	err := d.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM pg_extension WHERE extname = 'timescaledb'`).Scan(&extensions)
+	if err != nil {
+		return err
+	}
+	d.timescale = extensions > 0
+
+	columns := `(
+		time timestamptz NOT NULL,
+		application text NOT NULL,
+		instance text NOT NULL,
+		measurement text NOT NULL,
+		tags jsonb NOT NULL,
+		field text NOT NULL,
+		value double precision
+	)`
+
+	if d.timescale {
+		_, err = d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.table+` `+columns)
+		if err != nil {
+			return err
+		}
+		_, err = d.db.ExecContext(ctx, `SELECT create_hypertable($1, 'time', if_not_exists => TRUE)`, d.table)
+		return err
+	}
+
+	_, err = d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.table+` `+columns+` PARTITION BY RANGE (time)`)
+	return err
+}
+
+// ensurePartitions creates the daily partitions needed for batch.
+func (d *PostgresCopyDest) ensurePartitions(ctx context.Context, batch []Metric) error {
+	if d.timescale {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, m := range batch {
+		name, ddl := pgPartition(d.table, m.TS)
+		if d.partitions[name] {
+			continue
+		}
+		if _, err := d.db.ExecContext(ctx, ddl); err != nil {
+			return err
+		}
+		d.partitions[name] = true
+	}
+	return nil
+}
+
+func (d *PostgresCopyDest) write(ctx context.Context, batch []Metric) (err error) {
+	defer func() { err = dbPermanent(err) }()
+
+	if err := d.ensurePartitions(ctx, batch); err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(d.table,
+		"time", "application", "instance", "measurement", "tags", "field", "value"))
+	if err != nil {
+		return err
+	}
+
+	for _, m := range batch {
+		row, err := pgCopyRow(m)
+		if err != nil {
+			return errs.Combine(err, stmt.Close())
+		}
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return errs.Combine(err, stmt.Close())
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return errs.Combine(err, stmt.Close())
+	}
+	return stmt.Close()
+}
+
+// pgPartition returns the name of the daily partition of table holding ts,
+// and the statement creating it.
+func pgPartition(table string, ts time.Time) (name, ddl string) {
+	day := ts.UTC().Truncate(24 * time.Hour)
+	name = table + "_" + day.Format("20060102")
+	ddl = fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+		name, table, day.Format(time.RFC3339), day.Add(24*time.Hour).Format(time.RFC3339))
+	return name, ddl
+}
+
+// pgCopyRow returns the column values of m, in the order of the COPY
+// statement.
+func pgCopyRow(m Metric) ([]interface{}, error) {
+	measurement, tags, field := splitV3Key(m.Key)
+	tagMap := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		tagMap[tag.name] = tag.value
+	}
+	tagJSON, err := json.Marshal(tagMap)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{m.TS, m.Application, m.Instance, measurement, string(tagJSON), field, m.Val}, nil
+}
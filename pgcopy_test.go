@@ -0,0 +1,48 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgPartition(t *testing.T) {
+	// partitions are by UTC day, wherever the timestamp was taken.
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	for _, ts := range []time.Time{
+		time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 1, 23, 59, 59, 999, time.UTC),
+		time.Date(2026, 3, 2, 1, 0, 0, 0, zone),
+	} {
+		name, ddl := pgPartition("metric_points", ts)
+		require.Equal(t, "metric_points_20260301", name, ts)
+		require.Equal(t, `CREATE TABLE IF NOT EXISTS metric_points_20260301 PARTITION OF metric_points `+
+			`FOR VALUES FROM ('2026-03-01T00:00:00Z') TO ('2026-03-02T00:00:00Z')`, ddl, ts)
+	}
+
+	name, _ := pgPartition("points", time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC))
+	require.Equal(t, "points_20261231", name)
+}
+
+func TestPgCopyRow(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	for _, tt := range []struct {
+		key         string
+		measurement string
+		tags        string
+		field       string
+	}{
+		{"function,name=x,scope=y count", "function", `{"name":"x","scope":"y"}`, "count"},
+		{"env.process.uptime", "env.process.uptime", `{}`, ""},
+		{`req,path=/a\ b,quote="x" count`, "req", `{"path":"/a b","quote":"\"x\""}`, "count"},
+		{"m,novalue,tag=v value", "m", `{"tag":"v"}`, "value"},
+	} {
+		row, err := pgCopyRow(Metric{Application: "app", Instance: "inst", Key: []byte(tt.key), Val: 1.5, TS: ts})
+		require.NoError(t, err, tt.key)
+		require.Equal(t, []interface{}{ts, "app", "inst", tt.measurement, tt.tags, tt.field, 1.5}, row, tt.key)
+	}
+}
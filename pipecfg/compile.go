@@ -0,0 +1,236 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package pipecfg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"storj.io/statreceiver/luacfg"
+)
+
+var functionType = reflect.TypeOf((*luacfg.Function)(nil))
+
+// Compile builds the nodes of cfg by calling constructors, keyed by node
+// type, like the functions statreceiver registers with luacfg.Scope. Then it
+// makes the calls of cfg.Run. It returns the built named nodes.
+//
+// Scalar arguments are converted to the parameter types: numbers can be
+// passed for strings, and whole numbers for integers. {var: NAME} arguments
+// are looked up in vars. A constructor whose last result is a non-nil error
+// stops the compilation with that error.
+func Compile(cfg *Config, constructors map[string]interface{}, vars map[string]string) (map[string]interface{}, error) {
+	order, err := cfg.order()
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	c := &compiler{
+		constructors: constructors,
+		vars:         vars,
+		built:        map[string]interface{}{},
+	}
+	for _, name := range order {
+		val, err := c.build(name, cfg.Nodes[name])
+		if err != nil {
+			return nil, err
+		}
+		c.built[name] = val
+	}
+	for i, node := range cfg.Run {
+		if _, err := c.build(fmt.Sprintf("run[%d]", i), node); err != nil {
+			return nil, err
+		}
+	}
+	return c.built, nil
+}
+
+type compiler struct {
+	constructors map[string]interface{}
+	vars         map[string]string
+	built        map[string]interface{}
+}
+
+// build calls the constructor of node. path names the node in errors.
+func (c *compiler) build(path string, node *Node) (interface{}, error) {
+	fn := reflect.ValueOf(c.constructors[node.Type])
+	if fn.Kind() != reflect.Func {
+		return nil, Error.New("%s: unknown type %q", path, node.Type)
+	}
+	typ := fn.Type()
+
+	args := node.args()
+	expected := typ.NumIn()
+	if typ.IsVariadic() {
+		if len(args) < expected-1 {
+			return nil, Error.New("%s: %s takes %d or more arguments, got %d", path, node.Type, expected-1, len(args))
+		}
+	} else if len(args) != expected {
+		return nil, Error.New("%s: %s takes %d arguments, got %d", path, node.Type, expected, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if typ.IsVariadic() && i >= expected-1 {
+			param = typ.In(expected - 1).Elem()
+		} else {
+			param = typ.In(i)
+		}
+		argPath := fmt.Sprintf("%s.args[%d]", path, i)
+		if i >= len(node.Args) {
+			argPath = path + ".options"
+		}
+
+		var err error
+		in[i], err = c.convert(argPath, arg, param)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := fn.Call(in)
+	if n := len(out); luacfg.ReturnsError(typ) {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return nil, Error.New("%s: %v", path, err)
+		}
+		out = out[:n-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// convert returns val as a value of typ.
+func (c *compiler) convert(path string, val Value, typ reflect.Type) (reflect.Value, error) {
+	var built interface{}
+	switch {
+	case val.Ref != "":
+		built = c.built[val.Ref]
+	case val.Node != nil:
+		var err error
+		built, err = c.build(path, val.Node)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	case val.Lua != "":
+		if typ != functionType {
+			return reflect.Value{}, Error.New("%s: a Lua function can't be used as %s", path, typ)
+		}
+		// errors of the function name path as its source.
+		fn, err := luacfg.ParseFunction(path, val.Lua)
+		if err != nil {
+			return reflect.Value{}, Error.Wrap(err)
+		}
+		return reflect.ValueOf(fn), nil
+	case val.resolved():
+		str, err := c.resolve(path, val)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return convertScalar(path, str, typ)
+	default:
+		return convertScalar(path, val.Scalar, typ)
+	}
+
+	if built == nil {
+		return convertScalar(path, nil, typ)
+	}
+	rv := reflect.ValueOf(built)
+	if !rv.Type().AssignableTo(typ) {
+		return reflect.Value{}, Error.New("%s: %T can't be used as %s", path, built, typ)
+	}
+	return rv, nil
+}
+
+// resolve returns the string of an env, var, secret or concat value.
+func (c *compiler) resolve(path string, val Value) (string, error) {
+	switch {
+	case val.Env != "":
+		str, ok := os.LookupEnv(val.Env)
+		if !ok {
+			return "", Error.New("%s: environment variable %s is not set", path, val.Env)
+		}
+		return str, nil
+	case val.Var != "":
+		str, ok := c.vars[val.Var]
+		if !ok {
+			return "", Error.New("%s: var %s is not set", path, val.Var)
+		}
+		return str, nil
+	case val.Secret != "":
+		data, err := ioutil.ReadFile(val.Secret)
+		if err != nil {
+			return "", Error.New("%s: %v", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	var b strings.Builder
+	for i, part := range val.Concat {
+		if !part.resolved() {
+			b.WriteString(formatScalar(part.Scalar))
+			continue
+		}
+		str, err := c.resolve(fmt.Sprintf("%s.concat[%d]", path, i), part)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(str)
+	}
+	return b.String(), nil
+}
+
+// convertScalar returns a scalar as a value of typ.
+func convertScalar(path string, val interface{}, typ reflect.Type) (reflect.Value, error) {
+	rv := reflect.New(typ).Elem()
+	ok := false
+	switch typ.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func:
+		if val == nil {
+			return rv, nil
+		}
+		if typ.Kind() == reflect.Interface && reflect.TypeOf(val).AssignableTo(typ) {
+			rv.Set(reflect.ValueOf(val))
+			ok = true
+		}
+	case reflect.String:
+		switch val.(type) {
+		case string, int, float64:
+			rv.SetString(formatScalar(val))
+			ok = true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, isInt := val.(int); isInt && !rv.OverflowInt(int64(n)) {
+			rv.SetInt(int64(n))
+			ok = true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, isInt := val.(int); isInt && n >= 0 && !rv.OverflowUint(uint64(n)) {
+			rv.SetUint(uint64(n))
+			ok = true
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := val.(type) {
+		case int:
+			rv.SetFloat(float64(n))
+			ok = true
+		case float64:
+			rv.SetFloat(n)
+			ok = true
+		}
+	case reflect.Bool:
+		var b bool
+		b, ok = val.(bool)
+		rv.SetBool(b)
+	}
+	if !ok {
+		return reflect.Value{}, Error.New("%s: %#v can't be used as %s", path, val, typ)
+	}
+	return rv, nil
+}
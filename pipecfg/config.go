@@ -0,0 +1,531 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package pipecfg implements declarative pipeline configurations, an
+// alternative to Lua scripts written in YAML or JSON. A configuration is a set
+// of named nodes, each a call of a component constructor like udpin or mbuf
+// with its arguments, and a list of calls that run the pipeline, like
+// deliver:
+//
+//	nodes:
+//	  metrics:
+//	    type: mbuf
+//	    args: [influx, {type: influx, args: ["http://localhost:8086/write?db=stats"]}, 10000]
+//	run:
+//	  - type: mdeliver
+//	    args: [{type: statsdin, args: [":8125"]}, {ref: metrics}]
+//
+// Arguments are scalars, nodes only used in that place, references to named
+// nodes with {ref: name}, or Lua functions with {lua: "function(...) end"}.
+// Options are appended to the arguments as "name=value" strings. A named node
+// is built once, so all its references share it.
+//
+// Strings that shouldn't be in the configuration, like passwords, are
+// resolved when the pipeline is built: {env: NAME} is an environment
+// variable, {var: NAME} a var passed to Compile, {secret: path} the contents
+// of a file without trailing newlines, and {concat: [...]} joins strings,
+// numbers and such values:
+//
+//	args: [{concat: ["http://localhost:8086/write?db=stats&p=", {env: INFLUX_PASSWORD}]}]
+package pipecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Error is the class of configuration errors.
+var Error = errs.Class("pipecfg")
+
+// Config is a declarative pipeline.
+type Config struct {
+	// Nodes are the named nodes of the pipeline.
+	Nodes map[string]*Node `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+	// Run are the calls made after building the nodes, like deliver.
+	Run []*Node `json:"run,omitempty" yaml:"run,omitempty"`
+}
+
+// Node is a call of the component constructor registered as Type.
+type Node struct {
+	Type    string                 `json:"type" yaml:"type"`
+	Args    []Value                `json:"args,omitempty" yaml:"args,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// Value is an argument of a node. At most one of its fields is set, and none
+// for a nil argument.
+type Value struct {
+	// Scalar is a bool, an int, a float64 or a string.
+	Scalar interface{}
+	// Node is a node only used as this argument.
+	Node *Node
+	// Ref is the name of a node of the configuration.
+	Ref string
+	// Lua is the source of a Lua function, for arguments like the function of
+	// luafilter.
+	Lua string
+	// Env is the name of an environment variable holding the argument.
+	Env string
+	// Var is the name of a var holding the argument.
+	Var string
+	// Secret is the path of a file holding the argument, like a password
+	// mounted by a secret manager.
+	Secret string
+	// Concat are strings, numbers and values resolved to strings, joined into
+	// the argument.
+	Concat []Value
+}
+
+// resolved returns whether val is a string that is only known once the
+// pipeline is built, from an environment variable, var or secret.
+func (val Value) resolved() bool {
+	return val.Env != "" || val.Var != "" || val.Secret != "" || val.Concat != nil
+}
+
+// stringish returns whether val can be joined into a string.
+func (val Value) stringish() bool {
+	switch val.Scalar.(type) {
+	case string, int, float64:
+		return true
+	}
+	return val.resolved()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (val Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(val.encode())
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (val Value) MarshalYAML() (interface{}, error) {
+	return val.encode(), nil
+}
+
+func (val Value) encode() interface{} {
+	switch {
+	case val.Node != nil:
+		return val.Node
+	case val.Ref != "":
+		return map[string]string{"ref": val.Ref}
+	case val.Lua != "":
+		return map[string]string{"lua": val.Lua}
+	case val.Env != "":
+		return map[string]string{"env": val.Env}
+	case val.Var != "":
+		return map[string]string{"var": val.Var}
+	case val.Secret != "":
+		return map[string]string{"secret": val.Secret}
+	case val.Concat != nil:
+		parts := make([]interface{}, len(val.Concat))
+		for i, part := range val.Concat {
+			parts[i] = part.encode()
+		}
+		return map[string]interface{}{"concat": parts}
+	default:
+		return val.Scalar
+	}
+}
+
+// args returns the arguments of the node, followed by its options in the
+// order of their names.
+func (node *Node) args() []Value {
+	names := make([]string, 0, len(node.Options))
+	for name := range node.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := append([]Value(nil), node.Args...)
+	for _, name := range names {
+		args = append(args, Value{Scalar: name + "=" + formatScalar(node.Options[name])})
+	}
+	return args
+}
+
+// refs calls fn with the names the node and its argument nodes refer to.
+func (node *Node) refs(fn func(ref string) error) error {
+	for _, arg := range node.Args {
+		switch {
+		case arg.Ref != "":
+			if err := fn(arg.Ref); err != nil {
+				return err
+			}
+		case arg.Node != nil:
+			if err := arg.Node.refs(fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// order returns the names of the nodes so that every node comes after the
+// nodes it refers to. It fails on undefined references and cycles.
+func (cfg *Config) order() ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	order := make([]string, 0, len(cfg.Nodes))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return errs.New("%s: node refers to itself", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		err := cfg.Nodes[name].refs(func(ref string) error {
+			if _, ok := cfg.Nodes[ref]; !ok {
+				return errs.New("%s: undefined node %q", name, ref)
+			}
+			return visit(ref)
+		})
+		if err != nil {
+			return err
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	names := make([]string, 0, len(cfg.Nodes))
+	for name := range cfg.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	for i, node := range cfg.Run {
+		err := node.refs(func(ref string) error {
+			if _, ok := cfg.Nodes[ref]; !ok {
+				return errs.New("run[%d]: undefined node %q", i, ref)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Format is the format of a configuration file.
+type Format int
+
+const (
+	// YAML is a declarative configuration in YAML.
+	YAML Format = iota
+	// JSON is a declarative configuration in JSON.
+	JSON
+	// Lua is a Lua script.
+	Lua
+)
+
+// FormatOf returns the format of a file by its extension. ok is false for
+// unknown extensions.
+func FormatOf(path string) (format Format, ok bool) {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return YAML, true
+	case ".json":
+		return JSON, true
+	case ".lua":
+		return Lua, true
+	}
+	return 0, false
+}
+
+// Decode reads a configuration in format from r. name is used in errors.
+// Lua scripts are converted with FromLua.
+func Decode(name string, r io.Reader, format Format) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	var raw interface{}
+	switch format {
+	case YAML:
+		err = yaml.Unmarshal(data, &raw)
+	case JSON:
+		err = json.Unmarshal(data, &raw)
+	case Lua:
+		return FromLua(name, data)
+	default:
+		return nil, Error.New("unknown format %d", format)
+	}
+	if err != nil {
+		return nil, Error.New("%s: %v", name, err)
+	}
+
+	cfg, err := decodeConfig(raw)
+	if err != nil {
+		return nil, Error.New("%s: %v", name, err)
+	}
+	if _, err := cfg.order(); err != nil {
+		return nil, Error.New("%s: %v", name, err)
+	}
+	return cfg, nil
+}
+
+// Encode returns cfg in format.
+func Encode(cfg *Config, format Format) ([]byte, error) {
+	switch format {
+	case YAML:
+		data, err := yaml.Marshal(cfg)
+		return data, Error.Wrap(err)
+	case JSON:
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return nil, Error.Wrap(err)
+		}
+		return append(data, '\n'), nil
+	case Lua:
+		return ToLua(cfg)
+	}
+	return nil, Error.New("unknown format %d", format)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// decodeConfig converts a configuration decoded into Go values by the YAML or
+// JSON decoder.
+func decodeConfig(raw interface{}) (*Config, error) {
+	cfg := &Config{Nodes: map[string]*Node{}}
+	if raw == nil {
+		return cfg, nil
+	}
+	top, err := toMap(raw, "configuration")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range sortedKeys(top) {
+		switch key {
+		case "nodes":
+			nodes, err := toMap(top[key], "nodes")
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range sortedKeys(nodes) {
+				if !identifier.MatchString(name) || luaKeywords[name] {
+					return nil, errs.New("invalid node name %q: names are letters, digits and underscores", name)
+				}
+				node, err := decodeNode(nodes[name], name)
+				if err != nil {
+					return nil, err
+				}
+				cfg.Nodes[name] = node
+			}
+		case "run":
+			run, ok := top[key].([]interface{})
+			if !ok {
+				return nil, errs.New("run: expected a list, got %T", top[key])
+			}
+			for i, raw := range run {
+				node, err := decodeNode(raw, fmt.Sprintf("run[%d]", i))
+				if err != nil {
+					return nil, err
+				}
+				cfg.Run = append(cfg.Run, node)
+			}
+		default:
+			return nil, errs.New("unknown key %q", key)
+		}
+	}
+	return cfg, nil
+}
+
+func decodeNode(raw interface{}, path string) (*Node, error) {
+	fields, err := toMap(raw, path)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &Node{}
+	for _, key := range sortedKeys(fields) {
+		switch val := fields[key]; key {
+		case "type":
+			typ, ok := val.(string)
+			if !ok || !identifier.MatchString(typ) {
+				return nil, errs.New("%s: invalid type %v", path, val)
+			}
+			node.Type = typ
+		case "args":
+			args, ok := val.([]interface{})
+			if !ok {
+				return nil, errs.New("%s.args: expected a list, got %T", path, val)
+			}
+			for i, raw := range args {
+				arg, err := decodeValue(raw, fmt.Sprintf("%s.args[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				node.Args = append(node.Args, arg)
+			}
+		case "options":
+			options, err := toMap(val, path+".options")
+			if err != nil {
+				return nil, err
+			}
+			node.Options = map[string]interface{}{}
+			for name, raw := range options {
+				option, err := decodeScalar(raw, path+".options."+name)
+				if err != nil {
+					return nil, err
+				}
+				node.Options[name] = option
+			}
+		default:
+			return nil, errs.New("%s: unknown key %q", path, key)
+		}
+	}
+	if node.Type == "" {
+		return nil, errs.New("%s: type is required", path)
+	}
+	return node, nil
+}
+
+func decodeValue(raw interface{}, path string) (Value, error) {
+	if _, ok := raw.([]interface{}); ok {
+		return Value{}, errs.New("%s: lists are not supported, pass several arguments instead", path)
+	}
+	fields, err := toMap(raw, path)
+	if err != nil {
+		scalar, err := decodeScalar(raw, path)
+		return Value{Scalar: scalar}, err
+	}
+
+	if raw, ok := fields["concat"]; ok {
+		parts, ok := raw.([]interface{})
+		if !ok || len(fields) != 1 {
+			return Value{}, errs.New("%s: concat must be the only key, with a list", path)
+		}
+		val := Value{Concat: []Value{}}
+		for i, raw := range parts {
+			partPath := fmt.Sprintf("%s.concat[%d]", path, i)
+			part, err := decodeValue(raw, partPath)
+			if err != nil {
+				return Value{}, err
+			}
+			if !part.stringish() {
+				return Value{}, errs.New("%s: only strings, numbers, env, var, secret and concat can be joined", partPath)
+			}
+			val.Concat = append(val.Concat, part)
+		}
+		return val, nil
+	}
+
+	for _, key := range []string{"ref", "lua", "env", "var", "secret"} {
+		val, ok := fields[key]
+		if !ok {
+			continue
+		}
+		str, ok := val.(string)
+		if !ok || str == "" || len(fields) != 1 {
+			return Value{}, errs.New("%s: %s must be the only key, with a string", path, key)
+		}
+		switch key {
+		case "ref":
+			return Value{Ref: str}, nil
+		case "env":
+			return Value{Env: str}, nil
+		case "var":
+			return Value{Var: str}, nil
+		case "secret":
+			return Value{Secret: str}, nil
+		}
+		return Value{Lua: strings.TrimSpace(str)}, nil
+	}
+
+	node, err := decodeNode(raw, path)
+	return Value{Node: node}, err
+}
+
+// decodeScalar returns nil, a bool, a string, an int or a float64 that isn't
+// a whole number.
+func decodeScalar(raw interface{}, path string) (interface{}, error) {
+	var num float64
+	switch raw := raw.(type) {
+	case nil, bool, string:
+		return raw, nil
+	case int:
+		return raw, nil
+	case int64:
+		num = float64(raw)
+	case uint64:
+		num = float64(raw)
+	case float64:
+		num = raw
+	default:
+		return nil, errs.New("%s: expected a scalar, got %T", path, raw)
+	}
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return nil, errs.New("%s: unsupported number %v", path, num)
+	}
+	if num == math.Trunc(num) && math.Abs(num) <= 1<<53 {
+		return int(num), nil
+	}
+	return num, nil
+}
+
+// toMap returns the map of a YAML or JSON object.
+func toMap(raw interface{}, path string) (map[string]interface{}, error) {
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		return raw, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(raw))
+		for key, val := range raw {
+			str, ok := key.(string)
+			if !ok {
+				return nil, errs.New("%s: key %v is not a string", path, key)
+			}
+			m[str] = val
+		}
+		return m, nil
+	}
+	return nil, errs.New("%s: expected a map, got %T", path, raw)
+}
+
+// formatScalar formats a scalar as a string argument.
+func formatScalar(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return fmt.Sprint(val)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package pipecfg_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/pipecfg"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+// testPipeline has a named recorder shared by two filters.
+const testPipeline = `
+nodes:
+  recorded:
+    type: recorder
+  db:
+    type: keyfilter
+    args: ["^db ", {ref: recorded}]
+run:
+  - type: mdeliver
+    args:
+      - type: metrics
+      - type: mcopy
+        args:
+          - {ref: db}
+          - type: luafilter
+            args:
+              - lua: |
+                  function(app, inst, key, val)
+                    return val > 1
+                  end
+              - {ref: recorded}
+`
+
+// testComponents returns constructors for testPipeline, which record the
+// deliveries and how often recorder was called.
+func testComponents(recorder *statreceivertest.MetricRecorder, deliveries *[]*statreceiver.Delivery, recorders *int) map[string]interface{} {
+	ts := time.Unix(1600000000, 0)
+	return map[string]interface{}{
+		"metrics": func() statreceiver.MetricSource {
+			return statreceivertest.NewMetricSource(
+				statreceiver.Metric{Application: "app", Key: []byte("db count"), Val: 1, TS: ts},
+				statreceiver.Metric{Application: "app", Key: []byte("http count"), Val: 2, TS: ts},
+			)
+		},
+		"recorder": func() statreceiver.MetricDest {
+			*recorders++
+			return recorder
+		},
+		"mdeliver": func(source statreceiver.MetricSource, dest statreceiver.MetricDest) *statreceiver.Delivery {
+			delivery := statreceiver.DeliverMetrics(source, dest)
+			*deliveries = append(*deliveries, delivery)
+			return delivery
+		},
+		"keyfilter":  statreceiver.NewKeyFilter,
+		"mcopy":      statreceiver.NewMetricCopier,
+		"luafilter":  statreceiver.NewLuaFilter,
+		"mbuf":       statreceiver.NewMetricBuffer,
+		"appfilter":  statreceiver.NewApplicationFilter,
+		"fileout":    statreceiver.NewFileDest,
+		"parse":      statreceiver.NewParser,
+		"sanitize":   statreceiver.NewSanitizer,
+		"textfilein": statreceiver.NewTextFileSource,
+	}
+}
+
+func TestCompile(t *testing.T) {
+	for _, format := range []pipecfg.Format{pipecfg.YAML, pipecfg.JSON} {
+		cfg, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(testPipeline), pipecfg.YAML)
+		require.NoError(t, err)
+		if format == pipecfg.JSON {
+			data, err := pipecfg.Encode(cfg, pipecfg.JSON)
+			require.NoError(t, err)
+			cfg, err = pipecfg.Decode("pipeline.json", strings.NewReader(string(data)), pipecfg.JSON)
+			require.NoError(t, err)
+		}
+
+		recorder := statreceivertest.NewMetricRecorder()
+		var deliveries []*statreceiver.Delivery
+		var recorders int
+		nodes, err := pipecfg.Compile(cfg, testComponents(recorder, &deliveries, &recorders), nil)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		<-deliveries[0].Done()
+		require.NoError(t, deliveries[0].Close())
+
+		require.Equal(t, 1, recorders)
+		require.Equal(t, recorder, nodes["recorded"])
+		require.Equal(t, []string{"db count", "http count"}, recorder.Keys())
+	}
+}
+
+func TestCompile_Conversions(t *testing.T) {
+	var got []interface{}
+	constructors := map[string]interface{}{
+		"values": func(name string, size int, ratio float64, enabled bool, dest statreceiver.MetricDest, opts ...string) int {
+			got = []interface{}{name, size, ratio, enabled, dest, opts}
+			return size
+		},
+	}
+
+	cfg, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(`
+run:
+  - type: values
+    args: [8125, 10, 1.5, true, null]
+    options: {interval: 10s, batch: 100}
+`), pipecfg.YAML)
+	require.NoError(t, err)
+	_, err = pipecfg.Compile(cfg, constructors, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"8125", 10, 1.5, true, statreceiver.MetricDest(nil), []string{"batch=100", "interval=10s"}}, got)
+}
+
+func TestCompile_Resolved(t *testing.T) {
+	var got []string
+	constructors := map[string]interface{}{
+		"values": func(args ...string) int {
+			got = args
+			return len(args)
+		},
+	}
+	secret := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, ioutil.WriteFile(secret, []byte("hunter2\n"), 0600))
+	require.NoError(t, os.Setenv("PIPECFG_TEST_USER", "admin"))
+	defer func() { require.NoError(t, os.Unsetenv("PIPECFG_TEST_USER")) }()
+
+	cfg, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(`
+run:
+  - type: values
+    args:
+      - {env: PIPECFG_TEST_USER}
+      - {var: db}
+      - {secret: `+secret+`}
+      - {concat: ["u=", {env: PIPECFG_TEST_USER}, "&p=", {secret: `+secret+`}, "&n=", 1]}
+`), pipecfg.YAML)
+	require.NoError(t, err)
+	_, err = pipecfg.Compile(cfg, constructors, map[string]string{"db": "stats"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin", "stats", "hunter2", "u=admin&p=hunter2&n=1"}, got)
+
+	// values that aren't set fail the compilation.
+	_, err = pipecfg.Compile(cfg, constructors, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "run[0].args[1]: var db is not set")
+	require.NoError(t, os.Unsetenv("PIPECFG_TEST_USER"))
+	_, err = pipecfg.Compile(cfg, constructors, map[string]string{"db": "stats"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "run[0].args[0]: environment variable PIPECFG_TEST_USER is not set")
+}
+
+func TestDecode_Errors(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		err    string
+	}{
+		{"nodes: []", "nodes: expected a map"},
+		{"pipeline: {}", `unknown key "pipeline"`},
+		{"nodes: {a: {args: [1]}}", "a: type is required"},
+		{"nodes: {a: {type: mcopy, arg: [1]}}", `a: unknown key "arg"`},
+		{"nodes: {a-b: {type: mcopy}}", `invalid node name "a-b"`},
+		{"nodes: {end: {type: mcopy}}", `invalid node name "end"`},
+		{"nodes: {a: {type: mcopy, args: [[1, 2]]}}", "a.args[0]: lists are not supported"},
+		{"nodes: {a: {type: mcopy, args: [{ref: b}]}}", `a: undefined node "b"`},
+		{"nodes: {a: {type: mcopy, args: [{ref: b}]}, b: {type: mcopy, args: [{ref: a}]}}", "a: node refers to itself"},
+		{"nodes: {a: {type: mcopy, args: [{ref: b, type: mcopy}]}}", "a.args[0]: ref must be the only key"},
+		{"run: [{type: mdeliver, args: [{ref: source}]}]", `run[0]: undefined node "source"`},
+		{"run: [{type: influx, args: [{env: URL, var: URL}]}]", "run[0].args[0]: env must be the only key"},
+		{"run: [{type: influx, args: [{concat: x}]}]", "run[0].args[0]: concat must be the only key, with a list"},
+		{"run: [{type: influx, args: [{concat: [{ref: a}]}]}]", "run[0].args[0].concat[0]: only strings, numbers, env, var, secret and concat can be joined"},
+	} {
+		_, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(test.config), pipecfg.YAML)
+		require.Error(t, err, test.config)
+		require.Contains(t, err.Error(), "pipeline.yaml: "+test.err, test.config)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	recorder := statreceivertest.NewMetricRecorder()
+	var deliveries []*statreceiver.Delivery
+	var recorders int
+	constructors := testComponents(recorder, &deliveries, &recorders)
+
+	for _, test := range []struct {
+		config string
+		err    string
+	}{
+		{"nodes: {a: {type: influx}}", `a: unknown type "influx"`},
+		{"nodes: {a: {type: keyfilter, args: [x]}}", "a: keyfilter takes 2 arguments, got 1"},
+		{"nodes: {a: {type: mbuf, args: [x, {type: recorder}, big]}}", `a.args[2]: "big" can't be used as int`},
+		{"nodes: {a: {type: mbuf, args: [x, {type: metrics}, 1]}}", "a.args[1]: *statreceivertest.MetricSource can't be used as statreceiver.MetricDest"},
+		{"nodes: {a: {type: appfilter, args: [x, {type: keyfilter, args: ['(', {type: recorder}]}]}}", "a.args[1]: error parsing regexp"},
+		{"nodes: {a: {type: luafilter, args: [x, {type: recorder}]}}", `a.args[0]: "x" can't be used as *luacfg.Function`},
+		{"nodes: {a: {type: luafilter, args: [{lua: 'function('}, {type: recorder}]}}", "a.args[0]:1:"},
+		{"nodes: {a: {type: keyfilter, args: [{lua: 'function() end'}, {type: recorder}]}}", "a.args[0]: a Lua function can't be used as string"},
+	} {
+		cfg, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(test.config), pipecfg.YAML)
+		require.NoError(t, err, test.config)
+		_, err = pipecfg.Compile(cfg, constructors, nil)
+		require.Error(t, err, test.config)
+		require.Contains(t, err.Error(), test.err, test.config)
+	}
+	require.Empty(t, deliveries)
+}
+
+func TestDecode_Example(t *testing.T) {
+	data, err := ioutil.ReadFile("../example.yaml")
+	require.NoError(t, err)
+	cfg, err := pipecfg.Decode("example.yaml", bytes.NewReader(data), pipecfg.YAML)
+	require.NoError(t, err)
+	require.Len(t, cfg.Nodes, 6)
+
+	script, err := pipecfg.ToLua(cfg)
+	require.NoError(t, err)
+	// options become arguments in Lua, so the script converts back into the
+	// same script.
+	converted, err := pipecfg.FromLua("example.lua", script)
+	require.NoError(t, err)
+	again, err := pipecfg.ToLua(converted)
+	require.NoError(t, err)
+	require.Equal(t, string(script), string(again))
+}
@@ -0,0 +1,966 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package pipecfg
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+// luaKeywords can't be used as node names.
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "goto": true,
+	"if": true, "in": true, "local": true, "nil": true, "not": true, "or": true,
+	"repeat": true, "return": true, "then": true, "true": true, "until": true,
+	"while": true,
+}
+
+// ToLua returns a Lua script that builds the same pipeline as cfg. Named
+// nodes become globals assigned in the order of their references.
+func ToLua(cfg *Config) ([]byte, error) {
+	order, err := cfg.order()
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+	// a node named like a component would hide the component in Lua.
+	types := map[string]bool{}
+	var collect func(node *Node)
+	collect = func(node *Node) {
+		types[node.Type] = true
+		for _, arg := range node.Args {
+			if arg.Node != nil {
+				collect(arg.Node)
+			}
+		}
+	}
+	for _, node := range cfg.Nodes {
+		collect(node)
+	}
+	for _, node := range cfg.Run {
+		collect(node)
+	}
+	for _, name := range order {
+		if types[name] {
+			return nil, Error.New("%s: node has the name of a type", name)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, name := range order {
+		buf.WriteString(name + " = ")
+		if err := writeLuaNode(&buf, name, cfg.Nodes[name], 0); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+	}
+	if len(order) > 0 && len(cfg.Run) > 0 {
+		buf.WriteString("\n")
+	}
+	for i, node := range cfg.Run {
+		if err := writeLuaNode(&buf, fmt.Sprintf("run[%d]", i), node, 0); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// writeLuaNode writes the call of node. Calls with nodes or functions for
+// arguments get one line per argument.
+func writeLuaNode(buf *bytes.Buffer, path string, node *Node, depth int) error {
+	args := node.args()
+	multiline := false
+	for _, arg := range args {
+		if arg.Node != nil || arg.Lua != "" {
+			multiline = true
+		}
+	}
+
+	buf.WriteString(node.Type + "(")
+	for i, arg := range args {
+		if multiline {
+			buf.WriteString("\n" + strings.Repeat("  ", depth+1))
+		}
+		argPath := fmt.Sprintf("%s.args[%d]", path, i)
+		switch {
+		case arg.Node != nil:
+			if err := writeLuaNode(buf, argPath, arg.Node, depth+1); err != nil {
+				return err
+			}
+		case arg.Ref != "":
+			buf.WriteString(arg.Ref)
+		case arg.Lua != "":
+			// the lines of the function are indented like its first line.
+			indent := "\n" + strings.Repeat("  ", depth+1)
+			buf.WriteString(strings.Replace(arg.Lua, "\n", indent, -1))
+		case arg.resolved():
+			if err := writeLuaResolved(buf, argPath, arg); err != nil {
+				return err
+			}
+		default:
+			if err := writeLuaScalar(buf, argPath, arg.Scalar); err != nil {
+				return err
+			}
+		}
+		if i < len(args)-1 {
+			buf.WriteString(",")
+			if !multiline {
+				buf.WriteString(" ")
+			}
+		}
+	}
+	buf.WriteString(")")
+	return nil
+}
+
+func writeLuaScalar(buf *bytes.Buffer, path string, val interface{}) error {
+	switch val := val.(type) {
+	case nil:
+		buf.WriteString("nil")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case int:
+		buf.WriteString(strconv.Itoa(val))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(val, 'g', -1, 64))
+	case string:
+		buf.WriteString(quoteLua(val))
+	default:
+		return Error.New("%s: unsupported value %#v", path, val)
+	}
+	return nil
+}
+
+// writeLuaResolved writes an env, var, secret or concat value as the Lua
+// expression that gets the same string in a script.
+func writeLuaResolved(buf *bytes.Buffer, path string, val Value) error {
+	switch {
+	case val.Env != "":
+		buf.WriteString("os.getenv(" + quoteLua(val.Env) + ")")
+	case val.Var != "":
+		if identifier.MatchString(val.Var) && !luaKeywords[val.Var] {
+			buf.WriteString("vars." + val.Var)
+		} else {
+			buf.WriteString("vars[" + quoteLua(val.Var) + "]")
+		}
+	case val.Secret != "":
+		buf.WriteString("secret(" + quoteLua(val.Secret) + ")")
+	case len(val.Concat) == 0:
+		buf.WriteString(`""`)
+	default:
+		for i, part := range val.Concat {
+			if i > 0 {
+				buf.WriteString(" .. ")
+			}
+			partPath := fmt.Sprintf("%s.concat[%d]", path, i)
+			var err error
+			if part.resolved() {
+				err = writeLuaResolved(buf, partPath, part)
+			} else {
+				err = writeLuaScalar(buf, partPath, part.Scalar)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// quoteLua returns s as a Lua string literal.
+func quoteLua(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < ' ' || c == 0x7f {
+				// a following digit would be read as part of the escape.
+				fmt.Fprintf(&b, `\%03d`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// FromLua converts a Lua script into a Config, if the script only consists of
+// the parts a Config can express:
+//
+//   - assignments of component calls, which become named nodes,
+//   - assignments of strings, numbers, booleans, nil and functions, which are
+//     substituted where they are used,
+//   - assignments of tables of such values, which functions can use,
+//   - and calls of components, like deliver, which become the run calls.
+//
+// Arguments can be values, names assigned before, component calls, string
+// concatenations and functions. os.getenv("NAME"), vars.name and
+// secret("path") become env, var and secret values, and string.format with
+// %s, %d and %% and concatenations of them become concat values. Values and
+// tables of the script a function uses are copied into it, by wrapping it in
+// a function that declares them as locals.
+// Names assigned again become new nodes with a numbered name. Comments are
+// dropped. name is used in errors.
+func FromLua(name string, src []byte) (*Config, error) {
+	tokens, err := tokenizeLua(string(src))
+	if err != nil {
+		return nil, Error.New("%s:%v", name, err)
+	}
+	p := &luaParser{
+		src:    string(src),
+		tokens: tokens,
+		cfg:    &Config{Nodes: map[string]*Node{}},
+		names:  map[string]Value{},
+		tables: map[string]string{},
+	}
+	if err := p.parse(); err != nil {
+		return nil, Error.New("%s:%v", name, err)
+	}
+	return p.cfg, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	// text is the name, symbol or number, or the contents of a string.
+	text       string
+	line       int
+	start, end int
+}
+
+func (tok token) is(kind tokenKind, text string) bool {
+	return tok.kind == kind && tok.text == text
+}
+
+func (tok token) String() string {
+	switch tok.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return quoteLua(tok.text)
+	}
+	return "'" + tok.text + "'"
+}
+
+// luaSymbols are the symbols of Lua, longest first.
+var luaSymbols = []string{
+	"...", "..", "==", "~=", "<=", ">=", "::", "//", "<<", ">>",
+	"+", "-", "*", "/", "%", "^", "#", "&", "~", "|", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+// tokenizeLua splits Lua source into tokens, without comments.
+func tokenizeLua(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			i += 2
+			if level, ok := longBracket(src[i:]); ok {
+				end := strings.Index(src[i:], "]"+strings.Repeat("=", level)+"]")
+				if end < 0 {
+					return nil, errs.New("%d: unfinished long comment", line)
+				}
+				end += i + level + 2
+				line += strings.Count(src[i:end], "\n")
+				i = end
+			} else {
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			}
+		case c == '_' || isLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenName, text: src[start:i], line: line, start: start, end: i})
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i]) || src[i] == '.' ||
+				((src[i] == '+' || src[i] == '-') && strings.ContainsRune("eEpP", rune(src[i-1])))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], line: line, start: start, end: i})
+		case c == '"' || c == '\'':
+			start, startLine := i, line
+			text, n, err := unquoteLua(src[i:])
+			if err != nil {
+				return nil, errs.New("%d: %v", line, err)
+			}
+			i += n
+			tokens = append(tokens, token{kind: tokenString, text: text, line: startLine, start: start, end: i})
+		default:
+			if level, ok := longBracket(src[i:]); ok {
+				start, startLine := i, line
+				open := level + 2
+				end := strings.Index(src[i+open:], "]"+strings.Repeat("=", level)+"]")
+				if end < 0 {
+					return nil, errs.New("%d: unfinished long string", line)
+				}
+				text := src[i+open : i+open+end]
+				line += strings.Count(text, "\n")
+				// a newline right after the opening bracket is skipped.
+				text = strings.TrimPrefix(strings.TrimPrefix(text, "\r"), "\n")
+				i += open + end + open
+				tokens = append(tokens, token{kind: tokenString, text: text, line: startLine, start: start, end: i})
+				continue
+			}
+			symbol := ""
+			for _, s := range luaSymbols {
+				if strings.HasPrefix(src[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, errs.New("%d: unexpected character %q", line, c)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol, line: line, start: i, end: i + len(symbol)})
+			i += len(symbol)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, line: line, start: len(src), end: len(src)}), nil
+}
+
+// longBracket returns the level of the long bracket s starts with, like 2 for
+// "[==[".
+func longBracket(s string) (level int, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return 0, false
+	}
+	level = 1
+	for level < len(s) && s[level] == '=' {
+		level++
+	}
+	if level < len(s) && s[level] == '[' {
+		return level - 1, true
+	}
+	return 0, false
+}
+
+// unquoteLua returns the contents of the quoted string s starts with and its
+// length in s.
+func unquoteLua(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, errs.New("unfinished string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i >= len(s) {
+			break
+		}
+		switch c := s[i]; c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n', '\n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\', '"', '\'':
+			b.WriteByte(c)
+		case 'x':
+			if i+2 >= len(s) {
+				return "", 0, errs.New("invalid escape sequence")
+			}
+			n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", 0, errs.New("invalid escape sequence \\x%s", s[i+1:i+3])
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		case 'z':
+			for i+1 < len(s) && strings.IndexByte(" \t\r\n\f\v", s[i+1]) >= 0 {
+				i++
+			}
+		default:
+			if !isDigit(c) {
+				return "", 0, errs.New("invalid escape sequence \\%c", c)
+			}
+			end := i
+			for end < len(s) && end < i+3 && isDigit(s[end]) {
+				end++
+			}
+			n, err := strconv.ParseUint(s[i:end], 10, 8)
+			if err != nil {
+				return "", 0, errs.New("invalid escape sequence \\%s", s[i:end])
+			}
+			b.WriteByte(byte(n))
+			i = end - 1
+		}
+	}
+	return "", 0, errs.New("unfinished string")
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// luaParser parses the statements FromLua supports. Errors start with the
+// line number.
+type luaParser struct {
+	src    string
+	tokens []token
+	pos    int
+	cfg    *Config
+	// names are the values of the names assigned so far, where nodes are
+	// references.
+	names map[string]Value
+	// tables are the sources of the tables assigned so far.
+	tables map[string]string
+}
+
+func (p *luaParser) peek() token { return p.tokens[p.pos] }
+
+func (p *luaParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *luaParser) expect(text string) error {
+	if tok := p.next(); !tok.is(tokenSymbol, text) {
+		return unexpected(tok)
+	}
+	return nil
+}
+
+func unexpected(tok token) error {
+	return errs.New("%d: unexpected %v, only assignments and calls of components can be converted", tok.line, tok)
+}
+
+func (p *luaParser) parse() error {
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == tokenEOF:
+			return nil
+		case tok.is(tokenSymbol, ";"):
+		case tok.is(tokenName, "local"):
+			name := p.next()
+			if name.is(tokenName, "function") {
+				if err := p.functionStatement(); err != nil {
+					return err
+				}
+				continue
+			}
+			if name.kind != tokenName || luaKeywords[name.text] {
+				return unexpected(name)
+			}
+			if err := p.expect("="); err != nil {
+				return err
+			}
+			if err := p.assign(name.text); err != nil {
+				return err
+			}
+		case tok.is(tokenName, "function"):
+			if err := p.functionStatement(); err != nil {
+				return err
+			}
+		case tok.kind == tokenName && !luaKeywords[tok.text]:
+			if p.peek().is(tokenSymbol, "=") {
+				p.next()
+				if err := p.assign(tok.text); err != nil {
+					return err
+				}
+				continue
+			}
+			node, err := p.call(tok)
+			if err != nil {
+				return err
+			}
+			p.cfg.Run = append(p.cfg.Run, node)
+		default:
+			return unexpected(tok)
+		}
+	}
+}
+
+// assign parses the value assigned to name.
+func (p *luaParser) assign(name string) error {
+	if open := p.peek(); open.is(tokenSymbol, "{") {
+		p.next()
+		src, err := p.table(open)
+		if err != nil {
+			return err
+		}
+		delete(p.names, name)
+		p.tables[name] = src
+		return nil
+	}
+	delete(p.tables, name)
+
+	val, err := p.expr()
+	if err != nil {
+		return err
+	}
+	if val.Node == nil {
+		p.names[name] = val
+		return nil
+	}
+
+	nodeName := name
+	for i := 2; p.cfg.Nodes[nodeName] != nil; i++ {
+		nodeName = fmt.Sprintf("%s_%d", name, i)
+	}
+	p.cfg.Nodes[nodeName] = val.Node
+	p.names[name] = Value{Ref: nodeName}
+	return nil
+}
+
+// functionStatement parses "function name(...) ... end" after the function
+// keyword, which assigns the function to name.
+func (p *luaParser) functionStatement() error {
+	keyword := p.tokens[p.pos-1]
+	name := p.next()
+	if name.kind != tokenName || luaKeywords[name.text] {
+		return unexpected(name)
+	}
+	src, locals, err := p.functionBody(keyword)
+	if err != nil {
+		return err
+	}
+	p.names[name.text] = wrapFunction("function"+src[name.end-keyword.start:], locals)
+	return nil
+}
+
+// expr parses a value, where concatenated strings and numbers are joined.
+func (p *luaParser) expr() (Value, error) {
+	val, err := p.term()
+	if err != nil {
+		return Value{}, err
+	}
+	for p.peek().is(tokenSymbol, "..") {
+		concat := p.next()
+		next, err := p.term()
+		if err != nil {
+			return Value{}, err
+		}
+		if !val.stringish() || !next.stringish() {
+			return Value{}, errs.New("%d: only strings and numbers can be joined with ..", concat.line)
+		}
+		val = join(val, next)
+	}
+	return val, nil
+}
+
+// join joins strings, numbers and resolved values into a string, or a concat
+// value if any of them is resolved.
+func join(vals ...Value) Value {
+	var parts []Value
+	add := func(val Value) {
+		if val.resolved() {
+			parts = append(parts, val)
+			return
+		}
+		str := formatScalar(val.Scalar)
+		if n := len(parts); n > 0 && !parts[n-1].resolved() {
+			parts[n-1].Scalar = parts[n-1].Scalar.(string) + str
+			return
+		}
+		parts = append(parts, Value{Scalar: str})
+	}
+	for _, val := range vals {
+		if val.Concat != nil {
+			for _, part := range val.Concat {
+				add(part)
+			}
+			continue
+		}
+		add(val)
+	}
+
+	switch {
+	case len(parts) == 0:
+		return Value{Scalar: ""}
+	case len(parts) == 1:
+		return parts[0]
+	}
+	return Value{Concat: parts}
+}
+
+func (p *luaParser) term() (Value, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokenString:
+		return Value{Scalar: tok.text}, nil
+	case tok.kind == tokenNumber:
+		return parseNumber(tok, false)
+	case tok.is(tokenSymbol, "-") && p.peek().kind == tokenNumber:
+		return parseNumber(p.next(), true)
+	case tok.is(tokenSymbol, "("):
+		val, err := p.expr()
+		if err != nil {
+			return Value{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return Value{}, err
+		}
+		// a called function, like the ones functions using values of the
+		// script are wrapped in, returns a function.
+		if val.Lua != "" && p.peek().is(tokenSymbol, "(") {
+			p.next()
+			if err := p.expect(")"); err != nil {
+				return Value{}, err
+			}
+			return Value{Lua: p.source(tok)}, nil
+		}
+		return val, nil
+	case tok.is(tokenName, "true"), tok.is(tokenName, "false"):
+		return Value{Scalar: tok.text == "true"}, nil
+	case tok.is(tokenName, "nil"):
+		return Value{}, nil
+	case tok.is(tokenName, "function"):
+		return p.function(tok)
+	case tok.kind == tokenName && !luaKeywords[tok.text]:
+		if val, ok, err := p.builtin(tok); ok {
+			return val, err
+		}
+		if next := p.peek(); next.is(tokenSymbol, "(") || next.kind == tokenString {
+			node, err := p.call(tok)
+			return Value{Node: node}, err
+		}
+		if next := p.peek(); next.is(tokenSymbol, ".") || next.is(tokenSymbol, ":") || next.is(tokenSymbol, "[") {
+			return Value{}, unexpected(next)
+		}
+		if _, ok := p.tables[tok.text]; ok {
+			return Value{}, errs.New("%d: %s is a table, which only functions can use", tok.line, tok.text)
+		}
+		val, ok := p.names[tok.text]
+		if !ok {
+			return Value{}, errs.New("%d: %s is not assigned before", tok.line, tok.text)
+		}
+		return val, nil
+	}
+	return Value{}, unexpected(tok)
+}
+
+// builtin parses the uses of the Lua environment that have a counterpart in
+// a Config, unless the script assigned the names: os.getenv("NAME"),
+// vars.name, secret("path") and string.format. ok is whether tok starts one.
+func (p *luaParser) builtin(tok token) (val Value, ok bool, err error) {
+	_, isName := p.names[tok.text]
+	if _, isTable := p.tables[tok.text]; isName || isTable {
+		return Value{}, false, nil
+	}
+
+	next := p.peek()
+	switch {
+	case tok.text == "os" && next.is(tokenSymbol, ".") && p.tokens[p.pos+1].is(tokenName, "getenv"):
+		p.pos += 2
+		name, err := p.stringArg()
+		return Value{Env: name}, true, err
+	case tok.text == "vars" && next.is(tokenSymbol, "."):
+		p.next()
+		name := p.next()
+		if name.kind != tokenName {
+			return Value{}, true, unexpected(name)
+		}
+		return Value{Var: name.text}, true, nil
+	case tok.text == "vars" && next.is(tokenSymbol, "["):
+		p.next()
+		name := p.next()
+		if name.kind != tokenString || name.text == "" {
+			return Value{}, true, unexpected(name)
+		}
+		return Value{Var: name.text}, true, p.expect("]")
+	case tok.text == "secret" && (next.is(tokenSymbol, "(") || next.kind == tokenString):
+		path, err := p.stringArg()
+		return Value{Secret: path}, true, err
+	case tok.text == "string" && next.is(tokenSymbol, ".") && p.tokens[p.pos+1].is(tokenName, "format"):
+		p.pos += 2
+		val, err := p.format(tok)
+		return val, true, err
+	}
+	return Value{}, false, nil
+}
+
+// stringArg parses the arguments of a call taking a single string literal.
+func (p *luaParser) stringArg() (string, error) {
+	if tok := p.peek(); tok.kind == tokenString {
+		p.next()
+		return tok.text, nil
+	}
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	tok := p.next()
+	if tok.kind != tokenString || tok.text == "" {
+		return "", unexpected(tok)
+	}
+	return tok.text, p.expect(")")
+}
+
+// format parses the arguments of string.format, which may only use the %s,
+// %d and %% conversions.
+func (p *luaParser) format(name token) (Value, error) {
+	if err := p.expect("("); err != nil {
+		return Value{}, err
+	}
+	layout, err := p.expr()
+	if err != nil {
+		return Value{}, err
+	}
+	template, ok := layout.Scalar.(string)
+	if !ok {
+		return Value{}, errs.New("%d: the format of string.format must be a string", name.line)
+	}
+	var args []Value
+	for {
+		tok := p.next()
+		if tok.is(tokenSymbol, ")") {
+			break
+		}
+		if !tok.is(tokenSymbol, ",") {
+			return Value{}, unexpected(tok)
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return Value{}, err
+		}
+		args = append(args, arg)
+	}
+
+	parts := []Value{}
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			parts = append(parts, Value{Scalar: template[i : i+1]})
+			continue
+		}
+		i++
+		if i == len(template) {
+			return Value{}, errs.New("%d: unfinished conversion in string.format", name.line)
+		}
+		verb := template[i]
+		if verb == '%' {
+			parts = append(parts, Value{Scalar: "%"})
+			continue
+		}
+		if len(args) == 0 {
+			return Value{}, errs.New("%d: missing argument for %%%c in string.format", name.line, verb)
+		}
+		arg := args[0]
+		args = args[1:]
+		_, isInt := arg.Scalar.(int)
+		switch {
+		case verb == 's' && arg.stringish(), verb == 'd' && isInt:
+			parts = append(parts, arg)
+		case verb == 's' || verb == 'd':
+			return Value{}, errs.New("%d: invalid argument for %%%c in string.format", name.line, verb)
+		default:
+			return Value{}, errs.New("%d: only %%s, %%d and %%%% of string.format can be converted", name.line)
+		}
+	}
+	return join(parts...), nil
+}
+
+func parseNumber(tok token, negative bool) (Value, error) {
+	var num float64
+	if n, err := strconv.ParseInt(tok.text, 0, 64); err == nil {
+		num = float64(n)
+	} else if num, err = strconv.ParseFloat(tok.text, 64); err != nil {
+		return Value{}, errs.New("%d: invalid number %s", tok.line, tok.text)
+	}
+	if negative {
+		num = -num
+	}
+	if num == math.Trunc(num) && math.Abs(num) <= 1<<53 {
+		return Value{Scalar: int(num)}, nil
+	}
+	return Value{Scalar: num}, nil
+}
+
+// call parses the arguments of a call of the component name.
+func (p *luaParser) call(name token) (*Node, error) {
+	_, isName := p.names[name.text]
+	if _, isTable := p.tables[name.text]; isName || isTable {
+		return nil, errs.New("%d: %s is not a component", name.line, name.text)
+	}
+	node := &Node{Type: name.text}
+	if tok := p.peek(); tok.kind == tokenString {
+		p.next()
+		node.Args = []Value{{Scalar: tok.text}}
+		return node, nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if p.peek().is(tokenSymbol, ")") {
+		p.next()
+		return node, nil
+	}
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		node.Args = append(node.Args, arg)
+		if tok := p.next(); tok.is(tokenSymbol, ")") {
+			return node, nil
+		} else if !tok.is(tokenSymbol, ",") {
+			return nil, unexpected(tok)
+		}
+	}
+}
+
+// function parses a function after its function keyword, up to its end.
+// Values and tables of the script the function uses are declared as locals of
+// a function wrapping it, which returns it. Components and other functions
+// of the script aren't available to it once converted.
+func (p *luaParser) function(keyword token) (Value, error) {
+	src, locals, err := p.functionBody(keyword)
+	if err != nil {
+		return Value{}, err
+	}
+	return wrapFunction(src, locals), nil
+}
+
+// functionBody parses a function after its function keyword, up to its end,
+// and returns its source and the declarations of the values and tables of
+// the script it uses.
+func (p *luaParser) functionBody(keyword token) (src string, locals []string, err error) {
+	declared := map[string]bool{}
+	depth := 1
+	for depth > 0 {
+		tok := p.next()
+		switch {
+		case tok.kind == tokenEOF:
+			return "", nil, errs.New("%d: function is not closed", keyword.line)
+		case tok.is(tokenName, "function"), tok.is(tokenName, "if"), tok.is(tokenName, "do"), tok.is(tokenName, "repeat"):
+			depth++
+		case tok.is(tokenName, "end"), tok.is(tokenName, "until"):
+			depth--
+		case tok.kind == tokenName:
+			prev := p.tokens[p.pos-2]
+			if declared[tok.text] || prev.is(tokenSymbol, ".") || prev.is(tokenSymbol, ":") {
+				continue
+			}
+			if src, ok := p.tables[tok.text]; ok {
+				declared[tok.text] = true
+				locals = append(locals, "local "+tok.text+" = "+src)
+				continue
+			}
+			val, ok := p.names[tok.text]
+			if !ok {
+				continue
+			}
+			if val.Node != nil || val.Ref != "" || val.Lua != "" || val.resolved() {
+				return "", nil, errs.New("%d: function uses %s of the script", tok.line, tok.text)
+			}
+			var buf bytes.Buffer
+			if err := writeLuaScalar(&buf, tok.text, val.Scalar); err != nil {
+				return "", nil, errs.New("%d: %v", tok.line, err)
+			}
+			declared[tok.text] = true
+			locals = append(locals, "local "+tok.text+" = "+buf.String())
+		}
+	}
+	return p.source(keyword), locals, nil
+}
+
+// wrapFunction returns the function src, wrapped in a function declaring
+// locals if there are any.
+func wrapFunction(src string, locals []string) Value {
+	if len(locals) == 0 {
+		return Value{Lua: src}
+	}
+	lines := []string{"(function()"}
+	for _, local := range locals {
+		lines = append(lines, "  "+strings.Replace(local, "\n", "\n  ", -1))
+	}
+	lines = append(lines, "  return "+strings.Replace(src, "\n", "\n  ", -1), "end)()")
+	return Value{Lua: strings.Join(lines, "\n")}
+}
+
+// table parses a table constructor after its opening brace, up to its end,
+// and returns its source. Its fields must be values.
+func (p *luaParser) table(open token) (string, error) {
+	depth := 1
+	for depth > 0 {
+		tok := p.next()
+		switch {
+		case tok.kind == tokenEOF:
+			return "", errs.New("%d: table is not closed", open.line)
+		case tok.is(tokenSymbol, "{"):
+			depth++
+		case tok.is(tokenSymbol, "}"):
+			depth--
+		case tok.is(tokenName, "true"), tok.is(tokenName, "false"), tok.is(tokenName, "nil"):
+		case tok.kind == tokenName:
+			// names are only allowed as the names of fields.
+			prev := p.tokens[p.pos-2]
+			field := prev.is(tokenSymbol, "{") || prev.is(tokenSymbol, ",") || prev.is(tokenSymbol, ";")
+			if luaKeywords[tok.text] || !field || !p.peek().is(tokenSymbol, "=") {
+				return "", unexpected(tok)
+			}
+		}
+	}
+	return p.source(open), nil
+}
+
+// source returns the source from first to the last token parsed. The
+// indentation of the line first is on is removed from the following lines,
+// which ToLua adds again.
+func (p *luaParser) source(first token) string {
+	lineStart := strings.LastIndexByte(p.src[:first.start], '\n') + 1
+	indent := p.src[lineStart:first.start]
+	indent = indent[:len(indent)-len(strings.TrimLeft(indent, " \t"))]
+	lines := strings.Split(p.src[first.start:p.tokens[p.pos-1].end], "\n")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.TrimPrefix(lines[i], indent)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,233 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package pipecfg_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/luacfg"
+	"storj.io/statreceiver/pipecfg"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestToLua(t *testing.T) {
+	cfg, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(testPipeline), pipecfg.YAML)
+	require.NoError(t, err)
+	script, err := pipecfg.ToLua(cfg)
+	require.NoError(t, err)
+	require.Equal(t, `recorded = recorder()
+db = keyfilter("^db ", recorded)
+
+mdeliver(
+  metrics(),
+  mcopy(
+    db,
+    luafilter(
+      function(app, inst, key, val)
+        return val > 1
+      end,
+      recorded)))
+`, string(script))
+
+	// the script runs the same pipeline.
+	recorder := statreceivertest.NewMetricRecorder()
+	var deliveries []*statreceiver.Delivery
+	var recorders int
+	components := testComponents(recorder, &deliveries, &recorders)
+	err = statreceivertest.RunLua(string(script), map[string]interface{}{
+		"metrics":  components["metrics"],
+		"recorder": components["recorder"],
+	}, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 1, recorders)
+	require.Equal(t, []string{"db count", "http count"}, recorder.Keys())
+
+	// and converts back into the same configuration.
+	converted, err := pipecfg.FromLua("pipeline.lua", script)
+	require.NoError(t, err)
+	require.Equal(t, cfg, converted)
+}
+
+func TestFromLua(t *testing.T) {
+	cfg, err := pipecfg.FromLua("pipeline.lua", []byte(`
+-- constants are substituted
+local size = 1000
+local url = "http://localhost:8086/write?db=" ..
+  'stats' -- joined
+local function keep(app)
+  if app == "satellite" then return true end
+  return false
+end
+
+out = fileout("dump.out", "compression=zstd")
+metrics = mbuf([[influx]], sanitize(out), size)
+metrics = appfilter("^satellite$", metrics);
+deliver(textfilein(url), parse(luafilter(keep, metrics)))
+`))
+	require.NoError(t, err)
+	require.Equal(t, &pipecfg.Config{
+		Nodes: map[string]*pipecfg.Node{
+			"out": {Type: "fileout", Args: []pipecfg.Value{{Scalar: "dump.out"}, {Scalar: "compression=zstd"}}},
+			"metrics": {Type: "mbuf", Args: []pipecfg.Value{
+				{Scalar: "influx"},
+				{Node: &pipecfg.Node{Type: "sanitize", Args: []pipecfg.Value{{Ref: "out"}}}},
+				{Scalar: 1000},
+			}},
+			"metrics_2": {Type: "appfilter", Args: []pipecfg.Value{{Scalar: "^satellite$"}, {Ref: "metrics"}}},
+		},
+		Run: []*pipecfg.Node{
+			{Type: "deliver", Args: []pipecfg.Value{
+				{Node: &pipecfg.Node{Type: "textfilein", Args: []pipecfg.Value{{Scalar: "http://localhost:8086/write?db=stats"}}}},
+				{Node: &pipecfg.Node{Type: "parse", Args: []pipecfg.Value{
+					{Node: &pipecfg.Node{Type: "luafilter", Args: []pipecfg.Value{
+						{Lua: "function(app)\n  if app == \"satellite\" then return true end\n  return false\nend"},
+						{Ref: "metrics_2"},
+					}}},
+				}}},
+			}},
+		},
+	}, cfg)
+
+	yaml, err := pipecfg.Encode(cfg, pipecfg.YAML)
+	require.NoError(t, err)
+	decoded, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(string(yaml)), pipecfg.YAML)
+	require.NoError(t, err)
+	require.Equal(t, cfg, decoded)
+}
+
+func TestFromLua_Locals(t *testing.T) {
+	cfg, err := pipecfg.FromLua("pipeline.lua", []byte(`
+local suffix = "_total"
+local renames = {
+  count = "total",
+  ["sum"] = "all",
+}
+local function rename(app, inst, key)
+  return {key = (renames[key] or key) .. suffix}
+end
+deliver(source(), parse(luamap(rename, recorder())))
+`))
+	require.NoError(t, err)
+	fn := cfg.Run[0].Args[1].Node.Args[0].Node.Args[0]
+	require.Equal(t, `(function()
+  local renames = {
+    count = "total",
+    ["sum"] = "all",
+  }
+  local suffix = "_total"
+  return function(app, inst, key)
+    return {key = (renames[key] or key) .. suffix}
+  end
+end)()`, fn.Lua)
+
+	// the wrapped function converts back into the same configuration and
+	// compiles into a luamap.
+	script, err := pipecfg.ToLua(cfg)
+	require.NoError(t, err)
+	converted, err := pipecfg.FromLua("pipeline.lua", script)
+	require.NoError(t, err)
+	require.Equal(t, cfg, converted)
+
+	mapped, err := luacfg.ParseFunction("pipeline.lua", fn.Lua)
+	require.NoError(t, err)
+	results, err := mapped.Call("app", "inst", "count")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{map[string]interface{}{"key": "total_total"}}, results)
+}
+
+func TestFromLua_Example(t *testing.T) {
+	data, err := ioutil.ReadFile("../example.lua")
+	require.NoError(t, err)
+	cfg, err := pipecfg.FromLua("example.lua", data)
+	require.NoError(t, err)
+	require.NotEmpty(t, cfg.Run)
+}
+
+func TestFromLua_Resolved(t *testing.T) {
+	cfg, err := pipecfg.FromLua("pipeline.lua", []byte(`
+local user = os.getenv("INFLUX_USER")
+local url = string.format("%s/write?db=%s&u=%s&p=", "http://localhost:8086", vars.db, user) .. secret("influx.pw")
+out = influx(url, "batch=" .. 100)
+deliver(textfilein(vars["input-path"]), parse(out))
+`))
+	require.NoError(t, err)
+	require.Equal(t, []pipecfg.Value{
+		{Concat: []pipecfg.Value{
+			{Scalar: "http://localhost:8086/write?db="},
+			{Var: "db"},
+			{Scalar: "&u="},
+			{Env: "INFLUX_USER"},
+			{Scalar: "&p="},
+			{Secret: "influx.pw"},
+		}},
+		{Scalar: "batch=100"},
+	}, cfg.Nodes["out"].Args)
+	require.Equal(t, pipecfg.Value{Var: "input-path"}, cfg.Run[0].Args[0].Node.Args[0])
+
+	// the values convert back into Lua and YAML.
+	script, err := pipecfg.ToLua(cfg)
+	require.NoError(t, err)
+	require.Contains(t, string(script), `"http://localhost:8086/write?db=" .. vars.db .. "&u=" .. os.getenv("INFLUX_USER") .. "&p=" .. secret("influx.pw")`)
+	require.Contains(t, string(script), `textfilein(vars["input-path"])`)
+	converted, err := pipecfg.FromLua("pipeline.lua", script)
+	require.NoError(t, err)
+	require.Equal(t, cfg, converted)
+
+	yaml, err := pipecfg.Encode(cfg, pipecfg.YAML)
+	require.NoError(t, err)
+	decoded, err := pipecfg.Decode("pipeline.yaml", strings.NewReader(string(yaml)), pipecfg.YAML)
+	require.NoError(t, err)
+	require.Equal(t, cfg, decoded)
+}
+
+func TestFromLua_Statreceiver(t *testing.T) {
+	data, err := ioutil.ReadFile("../statreceiver.lua")
+	require.NoError(t, err)
+	cfg, err := pipecfg.FromLua("statreceiver.lua", data)
+	require.NoError(t, err)
+	require.Equal(t, []pipecfg.Value{{Concat: []pipecfg.Value{
+		{Scalar: "http://influx-internal.datasci.storj.io:8086/write?db=v3_stats_new&u="},
+		{Env: "INFLUX_USERNAME"},
+		{Scalar: "&p="},
+		{Env: "INFLUX_PASSWORD"},
+	}}}, cfg.Nodes["influx_out_v3"].Args)
+
+	yaml, err := pipecfg.Encode(cfg, pipecfg.YAML)
+	require.NoError(t, err)
+	decoded, err := pipecfg.Decode("statreceiver.yaml", strings.NewReader(string(yaml)), pipecfg.YAML)
+	require.NoError(t, err)
+	require.Equal(t, cfg, decoded)
+}
+
+func TestFromLua_Errors(t *testing.T) {
+	for _, test := range []struct {
+		script string
+		err    string
+	}{
+		{`out = influx(os.time())`, `pipeline.lua:1: unexpected '.'`},
+		{`out = influx(string.format("%q", "x"))`, `pipeline.lua:1: only %s, %d and %% of string.format`},
+		{`out = influx(string.format("%s/%s", "x"))`, `pipeline.lua:1: missing argument for %s`},
+		{"local pw = os.getenv(\"PW\")\nf = luafilter(function() return pw end, print())", `pipeline.lua:2: function uses pw of the script`},
+		{"x = 1\nif x then print() end", `pipeline.lua:2: unexpected 'if'`},
+		{`out = graphite({address = "localhost"})`, `pipeline.lua:1: unexpected '{'`},
+		{`deliver(source, dest)`, `pipeline.lua:1: source is not assigned before`},
+		{"out = print()\nout()", `pipeline.lua:2: out is not a component`},
+		{"out = print()\nf = luafilter(function(app) return out end, out)", `pipeline.lua:2: function uses out of the script`},
+		{"local t = {x = y}", `pipeline.lua:1: unexpected 'y'`},
+		{"local t = {1, 2}\nf = luafilter(t, print())", `pipeline.lua:2: t is a table, which only functions can use`},
+		{"local t = {1, 2", `pipeline.lua:1: table is not closed`},
+		{`out = print() .. "x"`, `pipeline.lua:1: only strings and numbers can be joined`},
+		{`out = print("unfinished)`, `pipeline.lua:1: unfinished string`},
+	} {
+		_, err := pipecfg.FromLua("pipeline.lua", []byte(test.script))
+		require.Error(t, err, test.script)
+		require.Contains(t, err.Error(), test.err, test.script)
+	}
+}
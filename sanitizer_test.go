@@ -0,0 +1,37 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestSanitizer(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"plain", "plain"},
+		{"with space", "with_space"},
+		{"storj.io/storj/satellite", "storj.io.storj.satellite"},
+		{"double..dot", "double.dot"},
+		{"a/.b", "a.b"},
+		{"dash-ok", "dash-ok"},
+		{"tags,key=val", "tags_key_val"},
+		{"ünïcode", "ünïcode"},
+		{"", ""},
+	} {
+		dest := statreceivertest.NewMetricRecorder()
+		require.NoError(t, statreceiver.NewSanitizer(dest).Metric(tt.in, tt.in, []byte(tt.in), 1, time.Now()))
+		m := dest.Metrics()[0]
+		require.Equal(t, tt.out, m.Application, tt.in)
+		require.Equal(t, tt.out, m.Instance, tt.in)
+		require.Equal(t, tt.out, string(m.Key), tt.in)
+	}
+}
@@ -1,9 +1,21 @@
+-- This schema is created and migrated automatically by the db destination.
+-- It is kept here for reference.
+
 create table if not exists metrics (
-  metric text,
-  instance text,
+  application text not null,
+  metric text not null,
+  instance text not null,
   val real,
   timestamp integer,
-  primary key (metric, instance)
+  primary key (application, metric, instance)
+);
+
+create table if not exists metric_history (
+  application text not null,
+  metric text not null,
+  instance text not null,
+  val real,
+  timestamp integer not null
 );
 
-create unique index metrics_index ON metrics(metric, instance);
+create index if not exists metric_history_timestamp on metric_history (timestamp);
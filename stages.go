@@ -0,0 +1,64 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+// Stage is a pipeline component that configurations can create.
+type Stage struct {
+	// New is the constructor of the stage.
+	New interface{}
+	// Closes is whether the values New returns hold resources, like buffered
+	// data or connections, that must be closed on shutdown.
+	Closes bool
+	// Local is whether the stage only passes packets or metrics on in memory,
+	// without files, connections or goroutines of its own.
+	Local bool
+}
+
+// Stages returns the pipeline components by the names configurations call
+// them with, both Lua scripts and declarative ones.
+func Stages() map[string]Stage {
+	return map[string]Stage{
+		"filein":                {New: NewFileSource},
+		"fileout":               {New: NewFileDest, Closes: true},
+		"pcapin":                {New: NewPcapSource},
+		"udpin":                 {New: NewUDPSource},
+		"udpout":                {New: NewUDPDest},
+		"otlpin":                {New: NewOTLPSource},
+		"statsdin":              {New: NewStatsDSource},
+		"graphitein":            {New: NewGraphiteSource},
+		"influxin":              {New: NewInfluxSource},
+		"textfilein":            {New: NewTextFileSource},
+		"textin":                {New: NewTextSource},
+		"forwardin":             {New: NewForwardSource},
+		"parse":                 {New: NewParser, Local: true},
+		"print":                 {New: NewPrinter},
+		"packetprint":           {New: NewPacketPrinter},
+		"pcopy":                 {New: NewPacketCopier, Local: true},
+		"mcopy":                 {New: NewMetricCopier, Local: true},
+		"pbuf":                  {New: NewPacketBuffer, Closes: true},
+		"mbuf":                  {New: NewMetricBuffer, Closes: true},
+		"packetfilter":          {New: NewPacketFilter, Local: true},
+		"headermultivalmatcher": {New: NewHeaderMultiValMatcher, Local: true},
+		"appfilter":             {New: NewApplicationFilter, Local: true},
+		"instfilter":            {New: NewInstanceFilter, Local: true},
+		"keyfilter":             {New: NewKeyFilter, Local: true},
+		"filterfile":            {New: NewPatternFile},
+		"sanitize":              {New: NewSanitizer, Local: true},
+		"luafilter":             {New: NewLuaFilter, Local: true},
+		"luamap":                {New: NewLuaMap, Local: true},
+		"graphite":              {New: NewGraphiteDest, Closes: true},
+		"influx":                {New: NewInfluxDest, Closes: true},
+		"influxmulti":           {New: NewInfluxMultiDest, Closes: true},
+		"db":                    {New: NewDBDest, Closes: true},
+		"pgcopy":                {New: NewPostgresCopyDest, Closes: true},
+		"otlp":                  {New: NewOTLPDest, Closes: true},
+		"forward":               {New: NewForwardDest, Closes: true},
+		"pbufprep":              {New: NewPacketBufPrep, Local: true},
+		"mbufprep":              {New: NewMetricBufPrep, Local: true},
+		"versionsplit":          {New: NewVersionSplit, Local: true},
+		"zeroinstanceif":        {New: NewInstanceZeroerIf, Local: true},
+		"zeroinstanceifnot":     {New: NewInstanceZeroerIfNot, Local: true},
+		"eventkit":              {New: NewEventkit, Closes: true},
+	}
+}
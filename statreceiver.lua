@@ -28,6 +28,8 @@ pbufsize = 1000
 --  * print() goes to stdout
 --  * db("sqlite3", path) goes to sqlite
 --  * db("postgres", connstring) goes to postgres
+--    db takes options "batch=N", "interval=5s", "history=true" and
+--    "retention=720h"
 
 influx_base = "http://influx-internal.datasci.storj.io:8086"
 influx_user = os.getenv("INFLUX_USERNAME")
@@ -0,0 +1,90 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"sync"
+	"time"
+
+	"storj.io/statreceiver"
+)
+
+// Clock is a fake statreceiver.Clock that only moves when told to. Use it
+// with statreceiver.SetClock to control the pacing and flush intervals of
+// components, or as the Clock of sources.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []clockWaiter
+}
+
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewClock creates a Clock at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+var _ statreceiver.Clock = (*Clock)(nil)
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the time of the clock once it moved
+// forward by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, clockWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Waiters returns how many channels returned by After didn't receive yet,
+// so tests can wait for a component to wait on the clock before moving it.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+	return c.now
+}
+
+// Set moves the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(now)
+}
+
+// set moves the clock and wakes the waiters that are due.
+func (c *Clock) set(now time.Time) {
+	c.now = now
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if now.Before(w.at) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- now
+	}
+	c.waiters = waiting
+}
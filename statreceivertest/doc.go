@@ -0,0 +1,9 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package statreceivertest provides in-memory sources and destinations and
+// admission packet helpers for testing statreceiver pipelines, including ones
+// configured in Lua, fake Influx, Graphite and eventkit servers for testing
+// destinations without the real services, and a fake Clock for components
+// that pace packets or flush on an interval.
+package statreceivertest
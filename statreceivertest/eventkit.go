@@ -0,0 +1,111 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/eventkit/transport"
+)
+
+// EventkitEvent is an event received by an EventkitServer.
+type EventkitEvent struct {
+	Application string
+	Instance    string
+	Name        string
+	Scope       []string
+	Tags        map[string]string
+}
+
+// EventkitServer is an in-process eventkit UDP collector recording the events
+// sent to it.
+type EventkitServer struct {
+	listener *transport.UDPListener
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	events []EventkitEvent
+}
+
+// NewEventkitServer starts an EventkitServer on a free local port, which is
+// closed when the test ends.
+func NewEventkitServer(t testing.TB) *EventkitServer {
+	l, err := transport.ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &EventkitServer{listener: l}
+	s.wg.Add(1)
+	go s.receive()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address the server listens on.
+func (s *EventkitServer) Addr() string {
+	return s.listener.LocalAddr().String()
+}
+
+func (s *EventkitServer) receive() {
+	defer s.wg.Done()
+	for {
+		payload, _, err := s.listener.Next()
+		if err != nil {
+			return
+		}
+		packet, err := transport.ParsePacket(payload)
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		for _, event := range packet.Events {
+			tags := map[string]string{}
+			for _, tag := range event.Tags {
+				tags[tag.Key] = tag.ValueString()
+			}
+			s.events = append(s.events, EventkitEvent{
+				Application: packet.Application,
+				Instance:    packet.Instance,
+				Name:        event.Name,
+				Scope:       event.Scope,
+				Tags:        tags,
+			})
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Events returns the events received.
+func (s *EventkitServer) Events() []EventkitEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]EventkitEvent(nil), s.events...)
+}
+
+// Wait waits until at least n events were received, failing the test after
+// WaitTimeout.
+func (s *EventkitServer) Wait(t testing.TB, n int) []EventkitEvent {
+	t.Helper()
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		events := s.Events()
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			require.FailNowf(t, "timed out waiting for eventkit events", "got %d of %d", len(events), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Close stops the server.
+func (s *EventkitServer) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// GraphiteServer is an in-process Graphite plaintext listener. It records the
+// lines sent to it and can drop its connections.
+type GraphiteServer struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	lines []string
+}
+
+// NewGraphiteServer starts a GraphiteServer on a free local port, which is
+// closed when the test ends.
+func NewGraphiteServer(t testing.TB) *GraphiteServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &GraphiteServer{listener: l, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.accept()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address the server listens on.
+func (s *GraphiteServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *GraphiteServer) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.read(conn)
+	}
+}
+
+func (s *GraphiteServer) read(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.mu.Lock()
+		s.lines = append(s.lines, scanner.Text())
+		s.mu.Unlock()
+	}
+}
+
+// DropConns closes every accepted connection from the server side.
+func (s *GraphiteServer) DropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// Lines returns the lines received.
+func (s *GraphiteServer) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// Wait waits until at least n lines were received, failing the test after
+// WaitTimeout.
+func (s *GraphiteServer) Wait(t testing.TB, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		lines := s.Lines()
+		if len(lines) >= n {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			require.FailNowf(t, "timed out waiting for graphite lines", "got %d of %d: %q", len(lines), n, lines)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Close stops the server and closes its connections.
+func (s *GraphiteServer) Close() {
+	_ = s.listener.Close()
+	s.DropConns()
+	s.wg.Wait()
+}
@@ -0,0 +1,241 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// InfluxLine is a line of the Influx line protocol.
+type InfluxLine struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+	TS          time.Time
+}
+
+// InfluxServer is an in-process Influx write endpoint. It records the lines
+// written to it and can be made to fail or respond slowly.
+type InfluxServer struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	lines    []InfluxLine
+	requests int
+	failures []int
+	latency  time.Duration
+}
+
+// NewInfluxServer starts an InfluxServer, which is closed when the test ends.
+func NewInfluxServer(t testing.TB) *InfluxServer {
+	s := &InfluxServer{}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// WriteURL returns the URL to write to, for statreceiver.NewInfluxDest.
+func (s *InfluxServer) WriteURL() string {
+	return s.server.URL + "/write?db=statreceiver"
+}
+
+// Fail makes the next n requests fail with the HTTP status, like 500 or 413.
+func (s *InfluxServer) Fail(status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// SetLatency makes requests wait d before they are answered.
+func (s *InfluxServer) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Requests returns the number of requests received, including failed ones.
+func (s *InfluxServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Lines returns the lines written by successful requests.
+func (s *InfluxServer) Lines() []InfluxLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]InfluxLine(nil), s.lines...)
+}
+
+// Wait waits until at least n lines were written, failing the test after
+// WaitTimeout.
+func (s *InfluxServer) Wait(t testing.TB, n int) []InfluxLine {
+	t.Helper()
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		lines := s.Lines()
+		if len(lines) >= n {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			require.FailNowf(t, "timed out waiting for influx lines", "got %d of %d", len(lines), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Close stops the server.
+func (s *InfluxServer) Close() {
+	s.server.Close()
+}
+
+func (s *InfluxServer) handle(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	latency := s.latency
+	status := http.StatusNoContent
+	if len(s.failures) > 0 {
+		status, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status != http.StatusNoContent {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var lines []InfluxLine
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		line, err := ParseInfluxLine(scanner.Text())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	s.mu.Lock()
+	s.lines = append(s.lines, lines...)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ParseInfluxLine parses a line of the Influx line protocol with numeric or
+// boolean fields.
+func ParseInfluxLine(text string) (InfluxLine, error) {
+	parts := splitEscaped(text, ' ')
+	if len(parts) < 2 || len(parts) > 3 {
+		return InfluxLine{}, fmt.Errorf("invalid line %q", text)
+	}
+
+	series := splitEscaped(parts[0], ',')
+	line := InfluxLine{
+		Measurement: unescape(series[0]),
+		Tags:        map[string]string{},
+		Fields:      map[string]float64{},
+	}
+	if line.Measurement == "" {
+		return InfluxLine{}, fmt.Errorf("missing measurement in %q", text)
+	}
+	for _, tag := range series[1:] {
+		kv := splitEscaped(tag, '=')
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return InfluxLine{}, fmt.Errorf("invalid tag %q in %q", tag, text)
+		}
+		line.Tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	for _, field := range splitEscaped(parts[1], ',') {
+		kv := splitEscaped(field, '=')
+		if len(kv) != 2 || kv[0] == "" {
+			return InfluxLine{}, fmt.Errorf("invalid field %q in %q", field, text)
+		}
+		val, err := parseInfluxField(kv[1])
+		if err != nil {
+			return InfluxLine{}, fmt.Errorf("invalid field %q in %q: %v", field, text, err)
+		}
+		line.Fields[unescape(kv[0])] = val
+	}
+
+	if len(parts) == 3 {
+		ns, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return InfluxLine{}, fmt.Errorf("invalid timestamp in %q: %v", text, err)
+		}
+		line.TS = time.Unix(0, ns)
+	}
+	return line, nil
+}
+
+func parseInfluxField(val string) (float64, error) {
+	switch val {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+	if strings.HasSuffix(val, "i") || strings.HasSuffix(val, "u") {
+		n, err := strconv.ParseInt(val[:len(val)-1], 10, 64)
+		return float64(n), err
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+// splitEscaped splits s at sep when it is not escaped by a backslash.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape removes the backslashes escaping characters.
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
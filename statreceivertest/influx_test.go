@@ -0,0 +1,36 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	line, err := statreceivertest.ParseInfluxLine(`cpu\ load,host=a\,b,region=eu value=0.5,count=3i,ok=t 1600000000000000000`)
+	require.NoError(t, err)
+	require.Equal(t, statreceivertest.InfluxLine{
+		Measurement: "cpu load",
+		Tags:        map[string]string{"host": "a,b", "region": "eu"},
+		Fields:      map[string]float64{"value": 0.5, "count": 3, "ok": 1},
+		TS:          time.Unix(1600000000, 0),
+	}, line)
+
+	for _, invalid := range []string{
+		"",
+		"measurement",
+		"measurement,tag value=1",
+		"measurement value=abc",
+		"measurement value=1 notatime",
+		",tag=v value=1",
+	} {
+		_, err := statreceivertest.ParseInfluxLine(invalid)
+		require.Error(t, err, invalid)
+	}
+}
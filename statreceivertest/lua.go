@@ -0,0 +1,71 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/luacfg"
+)
+
+// RunLua runs a Lua configuration with the local stages of statreceiver,
+// deliver, mdeliver and vals, like sources and recorders, registered. It
+// waits for all deliveries to finish, so sources of this package are drained
+// when it returns, and fails if they don't within timeout.
+func RunLua(config string, vals map[string]interface{}, timeout time.Duration) error {
+	var mu sync.Mutex
+	var deliveries []*statreceiver.Delivery
+	track := func(delivery *statreceiver.Delivery) *statreceiver.Delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, delivery)
+		return delivery
+	}
+
+	scope := luacfg.NewScope()
+	var group errs.Group
+	group.Add(
+		scope.RegisterVal("deliver", func(source statreceiver.Source, dest statreceiver.PacketDest) *statreceiver.Delivery {
+			return track(statreceiver.Deliver(source, dest))
+		}),
+		scope.RegisterVal("mdeliver", func(source statreceiver.MetricSource, dest statreceiver.MetricDest) *statreceiver.Delivery {
+			return track(statreceiver.DeliverMetrics(source, dest))
+		}),
+	)
+	for name, stage := range statreceiver.Stages() {
+		if stage.Local {
+			group.Add(scope.RegisterVal(name, stage.New))
+		}
+	}
+	for name, val := range vals {
+		group.Add(scope.RegisterVal(name, val))
+	}
+	if err := group.Err(); err != nil {
+		return err
+	}
+
+	err := scope.Run(strings.NewReader(config))
+
+	mu.Lock()
+	defer mu.Unlock()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for _, delivery := range deliveries {
+		select {
+		case <-delivery.Done():
+		case <-timer.C:
+			err = errs.Combine(err, errs.New("deliveries did not finish within %s", timeout))
+			for _, delivery := range deliveries {
+				_ = delivery.Close()
+			}
+			return err
+		}
+	}
+	return err
+}
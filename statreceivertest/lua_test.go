@@ -0,0 +1,59 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestRunLua(t *testing.T) {
+	clock := statreceivertest.NewClock(time.Unix(1600000000, 0))
+	source := statreceivertest.NewSource(
+		statreceiver.Packet{Data: statreceivertest.EncodePacket("satellite", "sat 1", nil,
+			statreceivertest.Value{Key: "db,scope=x count", Val: 1},
+			statreceivertest.Value{Key: "http,scope=x count", Val: 2})},
+		statreceiver.Packet{Data: statreceivertest.EncodePacket("storagenode", "node", nil,
+			statreceivertest.Value{Key: "db,scope=x count", Val: 3})},
+	)
+	source.Clock = clock
+	metrics := statreceivertest.NewMetricSource(statreceiver.Metric{Application: "otlp", Key: []byte("db value"), Val: 4})
+	metrics.Clock = clock
+	dest := statreceivertest.NewMetricRecorder()
+
+	err := statreceivertest.RunLua(`
+		filtered = appfilter("^satellite$", keyfilter("^db,", sanitize(dest)))
+		deliver(source, parse(filtered))
+		mdeliver(metrics, dest)
+	`, map[string]interface{}{
+		"source":  source,
+		"metrics": metrics,
+		"dest":    dest,
+	}, time.Second)
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{"db_scope_x_count", "db value"}, dest.Keys())
+	dest.RequireMetric(t, "satellite", "sat_1", "db_scope_x_count", 1)
+	dest.RequireMetric(t, "otlp", "", "db value", 4)
+	for _, m := range dest.Metrics() {
+		require.Equal(t, clock.Now(), m.TS)
+	}
+}
+
+func TestRunLua_Error(t *testing.T) {
+	require.Error(t, statreceivertest.RunLua(`undefined()`, nil, time.Second))
+	require.Error(t, statreceivertest.RunLua(`x = 1`, map[string]interface{}{"parse": 1}, time.Second))
+}
+
+func TestRunLua_ConstructorError(t *testing.T) {
+	err := statreceivertest.RunLua("dest = recorder\nfilter = keyfilter(\"[\", dest)",
+		map[string]interface{}{"recorder": statreceivertest.NewMetricRecorder()}, time.Second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "config:2: error parsing regexp")
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"sort"
+
+	"github.com/zeebo/admission/v3/admproto"
+)
+
+// Value is a metric of a packet.
+type Value struct {
+	Key string
+	Val float64
+}
+
+// EncodePacket encodes an admission packet with a checksum, like the ones
+// sent by monkit. Headers are written in key order. It panics if the packet
+// can't be encoded, like with an application name longer than 255 bytes.
+func EncodePacket(application, instance string, headers map[string]string, values ...Value) []byte {
+	w := admproto.NewWriterWith(admproto.Options{FloatEncoding: admproto.Float64Encoding})
+	buf, err := w.Begin(nil, application, []byte(instance), len(headers))
+	if err != nil {
+		panic(err)
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		buf, err = w.AppendHeader(buf, []byte(key), []byte(headers[key]))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, value := range values {
+		buf, err = w.Append(buf, value.Key, value.Val)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return admproto.AddChecksum(buf)
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+)
+
+// WaitTimeout is how long the Wait methods of recorders wait.
+var WaitTimeout = 10 * time.Second
+
+// MetricRecorder is a statreceiver.MetricDest recording the metrics it gets.
+type MetricRecorder struct {
+	mu      sync.Mutex
+	metrics []statreceiver.Metric
+	err     error
+}
+
+// NewMetricRecorder creates a MetricRecorder.
+func NewMetricRecorder() *MetricRecorder {
+	return &MetricRecorder{}
+}
+
+var _ statreceiver.MetricDest = (*MetricRecorder)(nil)
+
+// Metric implements statreceiver.MetricDest. It returns the error set with
+// SetError, after recording the metric.
+func (r *MetricRecorder) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, statreceiver.Metric{
+		Application: application,
+		Instance:    instance,
+		Key:         append([]byte(nil), key...),
+		Val:         val,
+		TS:          ts,
+	})
+	return r.err
+}
+
+// SetError makes Metric return err.
+func (r *MetricRecorder) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Metrics returns the recorded metrics.
+func (r *MetricRecorder) Metrics() []statreceiver.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]statreceiver.Metric(nil), r.metrics...)
+}
+
+// Keys returns the keys of the recorded metrics.
+func (r *MetricRecorder) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		keys = append(keys, string(m.Key))
+	}
+	return keys
+}
+
+// Find returns the last recorded metric with key.
+func (r *MetricRecorder) Find(key string) (statreceiver.Metric, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.metrics) - 1; i >= 0; i-- {
+		if string(r.metrics[i].Key) == key {
+			return r.metrics[i], true
+		}
+	}
+	return statreceiver.Metric{}, false
+}
+
+// Reset forgets the recorded metrics.
+func (r *MetricRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = nil
+}
+
+// Wait waits until at least n metrics were recorded, failing the test after
+// WaitTimeout.
+func (r *MetricRecorder) Wait(t testing.TB, n int) []statreceiver.Metric {
+	t.Helper()
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		metrics := r.Metrics()
+		if len(metrics) >= n {
+			return metrics
+		}
+		if time.Now().After(deadline) {
+			require.FailNowf(t, "timed out waiting for metrics", "got %d of %d", len(metrics), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// RequireKeys requires the keys of the recorded metrics to be keys, in order.
+func (r *MetricRecorder) RequireKeys(t testing.TB, keys ...string) {
+	t.Helper()
+	if len(keys) == 0 {
+		keys = []string{}
+	}
+	require.Equal(t, keys, r.Keys())
+}
+
+// RequireMetric requires a metric with key to be recorded, for application
+// and instance with value val.
+func (r *MetricRecorder) RequireMetric(t testing.TB, application, instance, key string, val float64) {
+	t.Helper()
+	m, ok := r.Find(key)
+	require.True(t, ok, "no metric %q in %q", key, r.Keys())
+	require.Equal(t, application, m.Application, "application of %q", key)
+	require.Equal(t, instance, m.Instance, "instance of %q", key)
+	require.Equal(t, val, m.Val, "value of %q", key)
+}
+
+// PacketRecorder is a statreceiver.PacketDest recording the packets it gets.
+type PacketRecorder struct {
+	mu      sync.Mutex
+	packets []statreceiver.Packet
+	err     error
+}
+
+// NewPacketRecorder creates a PacketRecorder.
+func NewPacketRecorder() *PacketRecorder {
+	return &PacketRecorder{}
+}
+
+var _ statreceiver.PacketDest = (*PacketRecorder)(nil)
+
+// Packet implements statreceiver.PacketDest. It returns the error set with
+// SetError, after recording the packet.
+func (r *PacketRecorder) Packet(data []byte, ts time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = append(r.packets, statreceiver.Packet{Data: append([]byte(nil), data...), TS: ts})
+	return r.err
+}
+
+// SetError makes Packet return err.
+func (r *PacketRecorder) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Packets returns the recorded packets.
+func (r *PacketRecorder) Packets() []statreceiver.Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]statreceiver.Packet(nil), r.packets...)
+}
+
+// Reset forgets the recorded packets.
+func (r *PacketRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = nil
+}
+
+// Wait waits until at least n packets were recorded, failing the test after
+// WaitTimeout.
+func (r *PacketRecorder) Wait(t testing.TB, n int) []statreceiver.Packet {
+	t.Helper()
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		packets := r.Packets()
+		if len(packets) >= n {
+			return packets
+		}
+		if time.Now().After(deadline) {
+			require.FailNowf(t, "timed out waiting for packets", "got %d of %d", len(packets), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// RequireCount requires n packets to be recorded.
+func (r *PacketRecorder) RequireCount(t testing.TB, n int) {
+	t.Helper()
+	require.Len(t, r.Packets(), n)
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceivertest
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"storj.io/statreceiver"
+)
+
+// Source is a statreceiver.Source returning packets given as Go values. It
+// returns io.EOF once all packets were returned, which ends a delivery.
+type Source struct {
+	// Clock, if set, gives the time of packets without a timestamp. They get
+	// the current time otherwise.
+	Clock *Clock
+
+	mu      sync.Mutex
+	packets []statreceiver.Packet
+}
+
+// NewSource creates a Source returning packets in order.
+func NewSource(packets ...statreceiver.Packet) *Source {
+	return &Source{packets: packets}
+}
+
+var _ statreceiver.Source = (*Source)(nil)
+
+// Add adds a packet to return after the others.
+func (s *Source) Add(data []byte, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packets = append(s.packets, statreceiver.Packet{Data: data, TS: ts})
+}
+
+// Next implements statreceiver.Source.
+func (s *Source) Next() ([]byte, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.packets) == 0 {
+		return nil, time.Time{}, io.EOF
+	}
+	p := s.packets[0]
+	s.packets = s.packets[1:]
+	if p.TS.IsZero() {
+		p.TS = now(s.Clock)
+	}
+	return p.Data, p.TS, nil
+}
+
+// now returns the time of clock, or the current time if it is nil.
+func now(clock *Clock) time.Time {
+	if clock != nil {
+		return clock.Now()
+	}
+	return time.Now()
+}
+
+// MetricSource is a statreceiver.MetricSource returning metrics given as Go
+// values. It returns io.EOF once all metrics were returned.
+type MetricSource struct {
+	// Clock, if set, gives the time of metrics without a timestamp. They get
+	// the current time otherwise.
+	Clock *Clock
+
+	mu      sync.Mutex
+	metrics []statreceiver.Metric
+}
+
+// NewMetricSource creates a MetricSource returning metrics in order.
+func NewMetricSource(metrics ...statreceiver.Metric) *MetricSource {
+	return &MetricSource{metrics: metrics}
+}
+
+var _ statreceiver.MetricSource = (*MetricSource)(nil)
+
+// Add adds a metric to return after the others.
+func (s *MetricSource) Add(application, instance, key string, val float64, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, statreceiver.Metric{
+		Application: application,
+		Instance:    instance,
+		Key:         []byte(key),
+		Val:         val,
+		TS:          ts,
+	})
+}
+
+// NextMetric implements statreceiver.MetricSource.
+func (s *MetricSource) NextMetric() (statreceiver.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.metrics) == 0 {
+		return statreceiver.Metric{}, io.EOF
+	}
+	m := s.metrics[0]
+	s.metrics = s.metrics[1:]
+	if m.TS.IsZero() {
+		m.TS = now(s.Clock)
+	}
+	return m, nil
+}
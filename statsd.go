@@ -0,0 +1,415 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// StatsDSource is a MetricSource that listens for StatsD and DogStatsD lines
+// over UDP and aggregates them per flush interval like statsd does.
+//
+// Every flush emits, with the StatsD name as measurement and the DogStatsD
+// tags as tags:
+//
+//   - counters: "count", the sum of the sampled values, and "rate", the count
+//     per second.
+//   - gauges: "value", the last value. Gauges keep being reported until the
+//     source is closed or, with gauge_expiry, until they weren't updated for
+//     that many intervals, and "+N" or "-N" values change the current value.
+//   - timers, histograms and distributions: "count", "sum", "min", "max",
+//     "mean", "p50", "p90" and "p99".
+//   - sets: "count", the number of unique values.
+//
+// DogStatsD events and service checks are ignored. Invalid lines are dropped
+// and logged once per flush interval with how many there were.
+type StatsDSource struct {
+	conn           *net.UDPConn
+	application    string
+	instance       string
+	applicationTag string
+	instanceTag    string
+	interval       time.Duration
+	gaugeExpiry    int
+	clock          Clock
+	queue          *metricQueue
+
+	mu       sync.Mutex
+	counters map[string]*statsdCounter
+	gauges   map[string]*statsdGauge
+	timers   map[string]*statsdTimer
+	sets     map[string]*statsdSet
+
+	// invalid counts the invalid lines since the last flush, and lastInvalid
+	// describes the last of them.
+	invalid     int
+	lastInvalid string
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+type statsdSeries struct {
+	application, instance, name string
+	tags                        []keyTag
+}
+
+type statsdCounter struct {
+	statsdSeries
+	sum float64
+}
+
+type statsdGauge struct {
+	statsdSeries
+	value   float64
+	updated bool
+	idle    int
+}
+
+type statsdTimer struct {
+	statsdSeries
+	count  float64
+	values []float64
+}
+
+type statsdSet struct {
+	statsdSeries
+	values map[string]struct{}
+}
+
+// NewStatsDSource creates a StatsDSource listening on the UDP address. The
+// following options are supported:
+//
+//   - application=NAME sets the application of all metrics (default statsd).
+//   - instance=NAME sets the instance of all metrics (default empty).
+//   - application_tag=TAG takes the application from the DogStatsD tag TAG
+//     when present, removing the tag.
+//   - instance_tag=TAG does the same for the instance.
+//   - interval=D sets the flush interval (default 10s).
+//   - gauge_expiry=N stops reporting gauges that weren't updated for N flush
+//     intervals (default 0, never).
+func NewStatsDSource(address string, opts ...string) (*StatsDSource, error) {
+	o := parseOptions(opts)
+	application := o.String("application", "statsd")
+	instance := o.String("instance", "")
+	applicationTag := o.String("application_tag", "")
+	instanceTag := o.String("instance_tag", "")
+	interval := o.Duration("interval", 10*time.Second)
+	gaugeExpiry := o.Int("gauge_expiry", 0)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	if gaugeExpiry < 0 {
+		return nil, errs.New("invalid gauge_expiry %d: must not be negative", gaugeExpiry)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &StatsDSource{
+		conn:           conn,
+		application:    application,
+		instance:       instance,
+		applicationTag: applicationTag,
+		instanceTag:    instanceTag,
+		interval:       interval,
+		gaugeExpiry:    gaugeExpiry,
+		clock:          currentClock(),
+		queue:          newMetricQueue("statsd", 100),
+		counters:       map[string]*statsdCounter{},
+		gauges:         map[string]*statsdGauge{},
+		timers:         map[string]*statsdTimer{},
+		sets:           map[string]*statsdSet{},
+		stop:           make(chan struct{}),
+	}
+	rv.stopped.Add(2)
+	go rv.read()
+	go rv.flushLoop()
+	return rv, nil
+}
+
+var _ MetricSource = (*StatsDSource)(nil)
+
+// Addr returns the address the source is listening on.
+func (s *StatsDSource) Addr() net.Addr { return s.conn.LocalAddr() }
+
+// NextMetric implements MetricSource.
+func (s *StatsDSource) NextMetric() (Metric, error) {
+	return s.queue.next()
+}
+
+// Close stops listening, emits the last aggregates and makes NextMetric fail
+// once they are consumed.
+func (s *StatsDSource) Close() error {
+	close(s.stop)
+	err := s.conn.Close()
+	s.stopped.Wait()
+	s.flush(s.clock.Now())
+	s.queue.close()
+	return err
+}
+
+func (s *StatsDSource) read() {
+	defer s.stopped.Done()
+
+	var buf [64 * 1024]byte
+	for {
+		n, _, err := s.conn.ReadFrom(buf[:])
+		if err != nil {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			log.Printf("failed reading statsd packet: %v", err)
+			continue
+		}
+		for _, line := range bytes.Split(buf[:n], []byte{'\n'}) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			if err := s.line(string(line)); err != nil {
+				s.mu.Lock()
+				s.invalid++
+				s.lastInvalid = fmt.Sprintf("%q: %v", line, err)
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (s *StatsDSource) flushLoop() {
+	defer s.stopped.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-s.clock.After(s.interval):
+			s.flush(now)
+		}
+	}
+}
+
+// line parses and aggregates a single StatsD line of the form
+//
+//	name:value[:value...]|type[|@rate][|#tag:value,tag...]
+//
+// DogStatsD events (_e{...}) and service checks (_sc|...) are skipped.
+func (s *StatsDSource) line(line string) error {
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil
+	}
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return errs.New("missing value")
+	}
+	name := line[:colon]
+	sections := strings.Split(line[colon+1:], "|")
+	if len(sections) < 2 {
+		return errs.New("missing type")
+	}
+	values, kind := strings.Split(sections[0], ":"), sections[1]
+
+	rate := 1.0
+	series := statsdSeries{application: s.application, instance: s.instance, name: name}
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			r, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return errs.New("invalid sample rate %q", section)
+			}
+			rate = r
+		case strings.HasPrefix(section, "#"):
+			for _, tag := range strings.Split(section[1:], ",") {
+				tagName, value := tag, "true"
+				if i := strings.IndexByte(tag, ':'); i >= 0 {
+					tagName, value = tag[:i], tag[i+1:]
+				}
+				switch {
+				case tagName == "":
+				case s.applicationTag != "" && tagName == s.applicationTag:
+					series.application = value
+				case s.instanceTag != "" && tagName == s.instanceTag:
+					series.instance = value
+				default:
+					series.tags = append(series.tags, keyTag{name: tagName, value: value})
+				}
+			}
+		}
+	}
+	sort.Slice(series.tags, func(i, j int) bool { return series.tags[i].name < series.tags[j].name })
+
+	id := series.id()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, raw := range values {
+		if kind == "s" {
+			set, ok := s.sets[id]
+			if !ok {
+				set = &statsdSet{statsdSeries: series, values: map[string]struct{}{}}
+				s.sets[id] = set
+			}
+			set.values[raw] = struct{}{}
+			continue
+		}
+
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errs.New("invalid value %q", raw)
+		}
+
+		switch kind {
+		case "c":
+			counter, ok := s.counters[id]
+			if !ok {
+				counter = &statsdCounter{statsdSeries: series}
+				s.counters[id] = counter
+			}
+			counter.sum += value / rate
+		case "g":
+			gauge, ok := s.gauges[id]
+			if !ok {
+				gauge = &statsdGauge{statsdSeries: series}
+				s.gauges[id] = gauge
+			}
+			if raw[0] == '+' || raw[0] == '-' {
+				gauge.value += value
+			} else {
+				gauge.value = value
+			}
+			gauge.updated = true
+		case "ms", "h", "d":
+			timer, ok := s.timers[id]
+			if !ok {
+				timer = &statsdTimer{statsdSeries: series}
+				s.timers[id] = timer
+			}
+			timer.count += 1 / rate
+			timer.values = append(timer.values, value)
+		default:
+			return errs.New("unknown type %q", kind)
+		}
+	}
+	return nil
+}
+
+// id identifies the series in the aggregation maps.
+func (series *statsdSeries) id() string {
+	var b strings.Builder
+	b.WriteString(series.application)
+	b.WriteByte(0)
+	b.WriteString(series.instance)
+	b.WriteByte(0)
+	b.WriteString(series.name)
+	for _, tag := range series.tags {
+		b.WriteByte(0)
+		b.WriteString(tag.name)
+		b.WriteByte('=')
+		b.WriteString(tag.value)
+	}
+	return b.String()
+}
+
+func (series *statsdSeries) metric(field string, val float64, ts time.Time) Metric {
+	return Metric{
+		Application: series.application,
+		Instance:    series.instance,
+		Key:         makeV3Key(series.name, series.tags, field),
+		Val:         val,
+		TS:          ts,
+	}
+}
+
+// flush emits the aggregates of the interval and resets everything but the
+// gauges, which are only dropped once they expire.
+func (s *StatsDSource) flush(now time.Time) {
+	s.mu.Lock()
+	counters, timers, sets := s.counters, s.timers, s.sets
+	s.counters = map[string]*statsdCounter{}
+	s.timers = map[string]*statsdTimer{}
+	s.sets = map[string]*statsdSet{}
+	invalid, lastInvalid := s.invalid, s.lastInvalid
+	s.invalid, s.lastInvalid = 0, ""
+
+	var batch []Metric
+	for id, gauge := range s.gauges {
+		if gauge.updated {
+			gauge.updated, gauge.idle = false, 0
+		} else {
+			gauge.idle++
+		}
+		if s.gaugeExpiry > 0 && gauge.idle >= s.gaugeExpiry {
+			delete(s.gauges, id)
+			continue
+		}
+		batch = append(batch, gauge.metric("value", gauge.value, now))
+	}
+	s.mu.Unlock()
+
+	if invalid > 0 {
+		log.Printf("dropped %d invalid statsd lines, the last was %s", invalid, lastInvalid)
+	}
+
+	seconds := s.interval.Seconds()
+	for _, counter := range counters {
+		batch = append(batch,
+			counter.metric("count", counter.sum, now),
+			counter.metric("rate", counter.sum/seconds, now))
+	}
+	for _, set := range sets {
+		batch = append(batch, set.metric("count", float64(len(set.values)), now))
+	}
+	for _, timer := range timers {
+		values := timer.values
+		sort.Float64s(values)
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		batch = append(batch,
+			timer.metric("count", timer.count, now),
+			timer.metric("sum", sum, now),
+			timer.metric("min", values[0], now),
+			timer.metric("max", values[len(values)-1], now),
+			timer.metric("mean", sum/float64(len(values)), now),
+			timer.metric("p50", statsdPercentile(values, 50), now),
+			timer.metric("p90", statsdPercentile(values, 90), now),
+			timer.metric("p99", statsdPercentile(values, 99), now))
+	}
+
+	if !s.queue.push(batch) {
+		log.Printf("statsd queue full, dropped %d metrics", len(batch))
+	}
+}
+
+// statsdPercentile returns the nearest rank percentile of sorted values.
+func statsdPercentile(sorted []float64, percentile float64) float64 {
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+	"storj.io/statreceiver/statreceivertest"
+)
+
+func TestStatsDSource(t *testing.T) {
+	source, err := statreceiver.NewStatsDSource("127.0.0.1:0",
+		"interval=1h", "instance_tag=host")
+	require.NoError(t, err)
+
+	conn, err := net.Dial("udp", source.Addr().String())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	packets := []string{
+		"requests:1|c|#path:/,host:a\nrequests:2|c|@0.5|#host:a,path:/",
+		"queue:10|g\nqueue:-3|g",
+		"latency:1:2:3:4|ms",
+		"users:alice|s\nusers:bob|s\nusers:alice|s|#beta",
+	}
+	for _, packet := range packets {
+		_, err := conn.Write([]byte(packet))
+		require.NoError(t, err)
+	}
+
+	// wait for the packets to be read before flushing.
+	time.Sleep(100 * time.Millisecond)
+	recorder := statreceivertest.NewMetricRecorder()
+	delivery := statreceiver.DeliverMetrics(source, recorder)
+	require.NoError(t, source.Close())
+
+	// the delivery finishes once the closed source is drained.
+	select {
+	case <-delivery.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery did not finish")
+	}
+	require.NoError(t, delivery.Close())
+	_, err = source.NextMetric()
+	require.Equal(t, io.EOF, err)
+
+	got := map[string]float64{}
+	for _, m := range recorder.Metrics() {
+		require.Equal(t, "statsd", m.Application)
+		got[m.Instance+" "+string(m.Key)] = m.Val
+	}
+
+	require.Equal(t, 5.0, got["a requests,path=/ count"])
+	require.Equal(t, 7.0, got[" queue value"])
+	require.Equal(t, 4.0, got[" latency count"])
+	require.Equal(t, 10.0, got[" latency sum"])
+	require.Equal(t, 1.0, got[" latency min"])
+	require.Equal(t, 4.0, got[" latency max"])
+	require.Equal(t, 2.5, got[" latency mean"])
+	require.Equal(t, 2.0, got[" latency p50"])
+	require.Equal(t, 4.0, got[" latency p99"])
+	require.Equal(t, 2.0, got[" users count"])
+	require.Equal(t, 1.0, got[" users,beta=true count"])
+}
+
+func TestStatsDSource_Expiry(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	clock := statreceivertest.NewClock(time.Unix(1600000000, 0))
+	defer statreceiver.SetClock(clock)()
+
+	source, err := statreceiver.NewStatsDSource("127.0.0.1:0",
+		"interval=10s", "gauge_expiry=2")
+	require.NoError(t, err)
+
+	conn, err := net.Dial("udp", source.Addr().String())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	_, err = conn.Write([]byte("queue:5|g\n_e{5,4}:title|text|#host:a\n_sc|check|0|#host:a\nbad\nqueue:x|g"))
+	require.NoError(t, err)
+
+	// wait for the packet to be read and the flush to be waiting.
+	time.Sleep(100 * time.Millisecond)
+	flush := func() {
+		require.Eventually(t, func() bool { return clock.Waiters() == 1 },
+			5*time.Second, time.Millisecond)
+		clock.Advance(10 * time.Second)
+	}
+
+	// the gauge is reported for the interval it was updated in and the next
+	// one, then it expires.
+	for i := 0; i < 2; i++ {
+		flush()
+		m, err := source.NextMetric()
+		require.NoError(t, err)
+		require.Equal(t, "queue value", string(m.Key))
+		require.Equal(t, 5.0, m.Val)
+	}
+	flush()
+	require.NoError(t, source.Close())
+	_, err = source.NextMetric()
+	require.Equal(t, io.EOF, err)
+
+	// events and service checks are skipped, and the invalid lines are
+	// logged once.
+	require.Equal(t, 1, strings.Count(logs.String(), "invalid statsd lines"))
+	require.Contains(t, logs.String(), "dropped 2 invalid statsd lines")
+	require.NotContains(t, logs.String(), "_e{")
+	require.NotContains(t, logs.String(), "_sc|")
+}
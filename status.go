@@ -0,0 +1,50 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import "time"
+
+// BufferStats describes how full a PacketBuffer or MetricBuffer is.
+type BufferStats struct {
+	Len int
+	Cap int
+	// Dropped is the number of packets or metrics dropped because the buffer
+	// was full.
+	Dropped int64
+}
+
+// SinkStatus describes whether a destination reaches the service it writes
+// to.
+type SinkStatus struct {
+	// LastFlush is the time of the last successful write, zero if there was
+	// none yet.
+	LastFlush time.Time
+	// LastError is the error of the last write, empty if it succeeded.
+	LastError string
+}
+
+// Sink is implemented by destinations that write to another service in the
+// background, like Influx, Graphite or a database, to report whether they
+// reach it.
+type Sink interface {
+	SinkStatus() SinkStatus
+}
+
+var (
+	_ Sink = (*DBDest)(nil)
+	_ Sink = (*ForwardDest)(nil)
+	_ Sink = (*GraphiteDest)(nil)
+	_ Sink = (*InfluxDest)(nil)
+	_ Sink = (*InfluxMultiDest)(nil)
+	_ Sink = (*OTLPDest)(nil)
+	_ Sink = (*PostgresCopyDest)(nil)
+)
+
+func newSinkStatus(lastFlush time.Time, lastErr error) SinkStatus {
+	status := SinkStatus{LastFlush: lastFlush}
+	if lastErr != nil {
+		status.LastError = lastErr.Error()
+	}
+	return status
+}
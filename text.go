@@ -0,0 +1,137 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TextFileSource reads metrics in the "application instance key value" text
+// format written by FileDest.Metric. The format has no timestamps, so metrics
+// get the time they are read.
+type TextFileSource struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	scanner *bufio.Scanner
+}
+
+// NewTextFileSource creates a TextFileSource.
+func NewTextFileSource(path string) *TextFileSource {
+	return &TextFileSource{path: path}
+}
+
+var _ MetricSource = (*TextFileSource)(nil)
+
+// NextMetric implements MetricSource. It returns io.EOF at the end of the
+// file.
+func (f *TextFileSource) NextMetric() (Metric, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.scanner == nil {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return Metric{}, err
+		}
+		f.file = file
+		f.scanner = bufio.NewScanner(file)
+		f.scanner.Buffer(nil, 1024*1024)
+	}
+
+	for f.scanner.Scan() {
+		line := bytes.TrimRight(f.scanner.Bytes(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		return parseTextMetric(line, time.Now())
+	}
+	if err := f.scanner.Err(); err != nil {
+		return Metric{}, err
+	}
+	return Metric{}, io.EOF
+}
+
+// Close closes the file.
+func (f *TextFileSource) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
+
+// TextSource is a MetricSource that listens for metrics in the
+// "application instance key value" text format, as sent by UDPDest.Metric.
+// Metrics get the time they are received.
+type TextSource struct {
+	*lineSource
+}
+
+// NewTextSource creates a TextSource listening on address. The option
+// network=udp|tcp selects the transport (default udp).
+func NewTextSource(address string, opts ...string) (*TextSource, error) {
+	o := parseOptions(opts)
+	network := o.String("network", "udp")
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	source, err := newLineSource("text", network, address, func(line []byte, now time.Time) ([]Metric, error) {
+		m, err := parseTextMetric(line, now)
+		if err != nil {
+			return nil, err
+		}
+		return []Metric{m}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TextSource{lineSource: source}, nil
+}
+
+var _ MetricSource = (*TextSource)(nil)
+
+// parseTextMetric parses a line of the "application instance key value"
+// format. The instance may be empty and the key may contain spaces, so the
+// application and instance are the first two space separated fields, the
+// value is the last and the key is everything in between.
+func parseTextMetric(line []byte, ts time.Time) (Metric, error) {
+	app := bytes.IndexByte(line, ' ')
+	if app < 0 {
+		return Metric{}, fmt.Errorf("invalid metric line %q", line)
+	}
+	inst := bytes.IndexByte(line[app+1:], ' ')
+	if inst < 0 {
+		return Metric{}, fmt.Errorf("invalid metric line %q", line)
+	}
+	inst += app + 1
+	val := bytes.LastIndexByte(line, ' ')
+	if val <= inst+1 {
+		return Metric{}, fmt.Errorf("invalid metric line %q", line)
+	}
+
+	v, err := strconv.ParseFloat(string(line[val+1:]), 64)
+	if err != nil {
+		return Metric{}, fmt.Errorf("invalid metric value in %q", line)
+	}
+
+	return Metric{
+		Application: string(line[:app]),
+		Instance:    string(line[app+1 : inst]),
+		Key:         append([]byte(nil), line[inst+1:val]...),
+		Val:         v,
+		TS:          ts,
+	}, nil
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver_test
+
+import (
+	"io"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"storj.io/statreceiver"
+)
+
+func TestTextFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.txt")
+
+	dest, err := statreceiver.NewFileDest(path)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, dest.Metric("app", "inst", []byte("function_times,name=a p50"), 1.5, now))
+	require.NoError(t, dest.Metric("app", "", []byte("env.process.uptime"), 1e6, now))
+	require.NoError(t, dest.Metric("other", "x", []byte("weird"), math.Inf(1), now))
+	require.NoError(t, dest.Close())
+
+	source := statreceiver.NewTextFileSource(path)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	expected := []statreceiver.Metric{
+		{Application: "app", Instance: "inst", Key: []byte("function_times,name=a p50"), Val: 1.5},
+		{Application: "app", Instance: "", Key: []byte("env.process.uptime"), Val: 1e6},
+		{Application: "other", Instance: "x", Key: []byte("weird"), Val: math.Inf(1)},
+	}
+	for _, exp := range expected {
+		m, err := source.NextMetric()
+		require.NoError(t, err)
+		m.TS = time.Time{}
+		require.Equal(t, exp, m)
+	}
+	_, err = source.NextMetric()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestTextSource(t *testing.T) {
+	source, err := statreceiver.NewTextSource("127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, source.Close()) }()
+
+	dest, err := statreceiver.NewUDPDest(source.Addr().String())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, dest.Close()) }()
+	require.NoError(t, dest.Metric("app", "inst", []byte("requests,path=/ count"), 7, time.Now()))
+
+	m, err := source.NextMetric()
+	require.NoError(t, err)
+	require.Equal(t, "app", m.Application)
+	require.Equal(t, "inst", m.Instance)
+	require.Equal(t, "requests,path=/ count", string(m.Key))
+	require.Equal(t, 7.0, m.Val)
+}
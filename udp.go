@@ -5,6 +5,7 @@ package statreceiver
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"time"
@@ -12,49 +13,91 @@ import (
 
 // UDPSource is a packet source.
 type UDPSource struct {
-	address string
+	address  string
+	envelope bool
+
+	// buf is only used by the reader, as Next must not be called
+	// concurrently.
+	buf [1024 * 10]byte
 
 	mu     sync.Mutex
 	conn   *net.UDPConn
-	buf    [1024 * 10]byte
 	closed bool
 }
 
-// NewUDPSource creates a UDPSource that listens on address.
-func NewUDPSource(address string) *UDPSource {
-	return &UDPSource{address: address}
+// NewUDPSource creates a UDPSource that listens on address. With the option
+// envelope=true, packets wrapped by a UDPDest with envelope=true are unwrapped
+// and keep their original timestamp and sender. Plain packets are still
+// accepted.
+func NewUDPSource(address string, opts ...string) (*UDPSource, error) {
+	o := parseOptions(opts)
+	envelope := o.Bool("envelope", false)
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	return &UDPSource{address: address, envelope: envelope}, nil
 }
 
-var _ Source = (*UDPSource)(nil)
+var _ SenderSource = (*UDPSource)(nil)
 
 // Next implements the Source interface.
 func (s *UDPSource) Next() ([]byte, time.Time, error) {
+	data, ts, _, err := s.NextFrom()
+	return data, ts, err
+}
+
+// NextFrom implements the SenderSource interface. The sender is the one
+// recorded in the envelope, if any, and otherwise the address the packet
+// came from. Once the source is closed, it returns io.EOF.
+func (s *UDPSource) NextFrom() ([]byte, time.Time, string, error) {
+	conn, err := s.listen()
+	if err != nil {
+		return nil, time.Time{}, "", err
+	}
+
+	n, addr, err := conn.ReadFrom(s.buf[:])
+	if err != nil {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return nil, time.Time{}, "", io.EOF
+		}
+		return nil, time.Time{}, "", err
+	}
+	if s.envelope && isEnvelope(s.buf[:n]) {
+		data, ts, sender, err := unwrapPacket(s.buf[:n])
+		if err == nil && sender == "" {
+			sender = addr.String()
+		}
+		return data, ts, sender, err
+	}
+	return s.buf[:n], time.Now(), addr.String(), nil
+}
+
+// listen returns the connection, listening on the first call.
+func (s *UDPSource) listen() (*net.UDPConn, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.closed {
-		return nil, time.Time{}, fmt.Errorf("udp source closed")
+		return nil, io.EOF
 	}
 	if s.conn == nil {
 		addr, err := net.ResolveUDPAddr("udp", s.address)
 		if err != nil {
-			return nil, time.Time{}, err
+			return nil, err
 		}
 		conn, err := net.ListenUDP("udp", addr)
 		if err != nil {
-			return nil, time.Time{}, err
+			return nil, err
 		}
 		s.conn = conn
 	}
-
-	n, _, err := s.conn.ReadFrom(s.buf[:])
-	if err != nil {
-		return nil, time.Time{}, err
-	}
-	return s.buf[:n], time.Now(), nil
+	return s.conn, nil
 }
 
-// Close closes the source.
+// Close closes the source, which makes a waiting Next return.
 func (s *UDPSource) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -66,9 +109,12 @@ func (s *UDPSource) Close() error {
 	return nil
 }
 
-// UDPDest is a packet destination. IMPORTANT: It throws away timestamps.
+// UDPDest is a packet destination. IMPORTANT: It throws away timestamps,
+// unless packets are wrapped in envelopes for a UDPSource with envelope=true.
 type UDPDest struct {
-	address string
+	address  string
+	envelope bool
+	sender   string
 
 	mu     sync.Mutex
 	addr   *net.UDPAddr
@@ -76,15 +122,46 @@ type UDPDest struct {
 	closed bool
 }
 
-// NewUDPDest creates a UDPDest that sends incoming packets to address.
-func NewUDPDest(address string) *UDPDest {
-	return &UDPDest{address: address}
+// NewUDPDest creates a UDPDest that sends incoming packets to address. The
+// following options are supported:
+//
+//   - envelope=true wraps packets in an envelope keeping their timestamp,
+//     for another statreceiver. Other receivers, like rothko, do not
+//     understand envelopes.
+//   - sender=NAME records NAME as the sender in envelopes. Without it,
+//     envelopes keep the sender of the packet, like the address a UDPSource
+//     received it from, or the sender of the envelope it came in.
+func NewUDPDest(address string, opts ...string) (*UDPDest, error) {
+	o := parseOptions(opts)
+	envelope := o.Bool("envelope", false)
+	sender := o.String("sender", "")
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+	return &UDPDest{address: address, envelope: envelope, sender: sender}, nil
 }
 
-var _ PacketDest = (*UDPDest)(nil)
+var _ SenderPacketDest = (*UDPDest)(nil)
 
 // Packet implements PacketDest and MetricDest. Later is only for debugging...
 func (d *UDPDest) Packet(data []byte, ts time.Time) error {
+	return d.PacketFrom(data, ts, "")
+}
+
+// PacketFrom implements SenderPacketDest. The sender is recorded in the
+// envelope, unless the destination has its own.
+func (d *UDPDest) PacketFrom(data []byte, ts time.Time, sender string) error {
+	if d.envelope {
+		if d.sender != "" {
+			sender = d.sender
+		}
+		data = wrapPacket(data, ts, sender)
+	}
+	return d.write(data)
+}
+
+// write sends data as a single datagram.
+func (d *UDPDest) write(data []byte) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -112,7 +189,7 @@ func (d *UDPDest) Packet(data []byte, ts time.Time) error {
 // Metric implements MetricDest.
 func (d *UDPDest) Metric(application, instance string, key []byte, val float64, ts time.Time) error {
 	out := fmt.Sprintf("%s %s %s %v\n", application, instance, string(key), val)
-	return d.Packet([]byte(out), time.Now())
+	return d.write([]byte(out))
 }
 
 var _ MetricDest = &UDPDest{}
@@ -0,0 +1,75 @@
+// Copyright (C) 2026 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package statreceiver
+
+import (
+	"sort"
+	"strings"
+)
+
+// keyTag is a single tag of a monkit v3 key.
+type keyTag struct {
+	name, value string
+}
+
+// splitV3Key splits a monkit v3 key into its measurement, tags and field,
+// removing the influx style backslash escapes.
+func splitV3Key(key []byte) (measurement string, tags []keyTag, field string) {
+	var parts []string
+	var seps []byte
+	var cur strings.Builder
+	inField := false
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c == '\\' && i+1 < len(key):
+			i++
+			c = key[i]
+		case !inField && (c == ',' || c == ' '):
+			parts = append(parts, cur.String())
+			seps = append(seps, c)
+			cur.Reset()
+			inField = c == ' '
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	parts = append(parts, cur.String())
+
+	measurement = parts[0]
+	for i, part := range parts[1:] {
+		if seps[i] == ' ' {
+			field = part
+			break
+		}
+		eq := strings.IndexByte(part, '=')
+		if eq < 0 {
+			continue
+		}
+		tags = append(tags, keyTag{name: part[:eq], value: part[eq+1:]})
+	}
+	return measurement, tags, field
+}
+
+// makeV3Key builds a monkit v3 key from a measurement, tags and field,
+// escaping them as needed. Tags are sorted by name and tags with an empty
+// name or value are left out.
+func makeV3Key(measurement string, tags []keyTag, field string) []byte {
+	sorted := make([]keyTag, len(tags))
+	copy(sorted, tags)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	key := appendTag(nil, measurement)
+	for _, tag := range sorted {
+		if tag.name == "" || tag.value == "" {
+			continue
+		}
+		key = append(key, ',')
+		key = appendTag(key, tag.name)
+		key = append(key, '=')
+		key = appendTag(key, tag.value)
+	}
+	key = append(key, ' ')
+	return appendTag(key, field)
+}